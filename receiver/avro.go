@@ -0,0 +1,352 @@
+package receiver
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/linkedin/goavro/v2"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// AvroContentType is the content-type property of the events encoded by the sender AvroCodec.
+	AvroContentType = "avro/binary"
+
+	avroMagicByte   = 0
+	avroHeaderSize  = 5
+	registryContent = "application/vnd.schemaregistry.v1+json"
+)
+
+// ErrNotAvro is returned when the payload does not start with the zero byte and the schema id.
+var ErrNotAvro = errors.New("payload is not avro prefixed with a schema id")
+
+type (
+	// SchemaRegistry resolves the Avro schemas by the id written before the payload.
+	SchemaRegistry interface {
+		Schema(ctx context.Context, id int) (string, error)
+	}
+
+	// httpSchemaRegistry is a client of a registry speaking the Confluent schema registry REST API.
+	httpSchemaRegistry struct {
+		baseURL string
+		client  *http.Client
+	}
+
+	// AvroDecoder decodes the payloads of the sender AvroCodec, the schemas are fetched from the registry once per id.
+	AvroDecoder struct {
+		registry SchemaRegistry
+		mutex    sync.Mutex
+		schemas  map[int]*avroSchema
+	}
+
+	avroSchema struct {
+		codec  *goavro.Codec
+		schema interface{}            // the parsed schema
+		names  map[string]interface{} // full name -> named type
+	}
+)
+
+// NewHTTPSchemaRegistry(baseURL string, client *http.Client) returns a client of the schema registry at baseURL,
+// compatible with the Confluent schema registry REST API. http.DefaultClient is used when client is nil.
+func NewHTTPSchemaRegistry(baseURL string, client *http.Client) SchemaRegistry {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpSchemaRegistry{baseURL: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+func (registry *httpSchemaRegistry) Schema(ctx context.Context, id int) (string, error) {
+	path := "/schemas/ids/" + strconv.Itoa(id)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, registry.baseURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", registryContent)
+
+	response, err := registry.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var body struct {
+		Schema    string `json:"schema"`
+		ErrorCode int    `json:"error_code"`
+		Message   string `json:"message"`
+	}
+	decodeErr := json.Unmarshal(content, &body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		if decodeErr == nil && body.Message != "" {
+			return "", fmt.Errorf("schema registry: GET %s: %d %s", path, body.ErrorCode, body.Message)
+		}
+		return "", fmt.Errorf("schema registry: GET %s: %s", path, response.Status)
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("schema registry: invalid response to GET %s: %w", path, decodeErr)
+	}
+
+	return body.Schema, nil
+}
+
+// NewAvroDecoder(registry SchemaRegistry) returns a decoder resolving the schemas through the registry.
+func NewAvroDecoder(registry SchemaRegistry) *AvroDecoder {
+	return &AvroDecoder{registry: registry, schemas: make(map[int]*avroSchema)}
+}
+
+// SchemaID(data []byte) returns the schema id written before the payload.
+func SchemaID(data []byte) (int, error) {
+	if len(data) < avroHeaderSize || data[0] != avroMagicByte {
+		return 0, ErrNotAvro
+	}
+
+	return int(binary.BigEndian.Uint32(data[1:avroHeaderSize])), nil
+}
+
+// Decode(ctx context.Context, data []byte) returns the payload decoded with the schema of its id. Records are
+// map[string]interface{}, arrays []interface{} and a union field holds its plain value or nil.
+func (decoder *AvroDecoder) Decode(ctx context.Context, data []byte) (interface{}, error) {
+	id, err := SchemaID(data)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := decoder.schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	native, rest, err := schema.codec.NativeFromBinary(data[avroHeaderSize:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro payload for schema %d: %w", id, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid avro payload for schema %d: %d bytes left", id, len(rest))
+	}
+
+	return plainAvro(schema.schema, native, schema.names, ""), nil
+}
+
+// DecodeInto(ctx context.Context, data []byte, v interface{}) decodes the payload into v as encoding/json would
+// unmarshal the same record, v is usually a pointer to a struct with json tags.
+func (decoder *AvroDecoder) DecodeInto(ctx context.Context, data []byte, v interface{}) error {
+	value, err := decoder.Decode(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(document, v)
+}
+
+func (decoder *AvroDecoder) schema(ctx context.Context, id int) (*avroSchema, error) {
+	decoder.mutex.Lock()
+	schema, ok := decoder.schemas[id]
+	decoder.mutex.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	specification, err := decoder.registry.Schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	schema = &avroSchema{names: make(map[string]interface{})}
+	if schema.codec, err = goavro.NewCodec(specification); err != nil {
+		return nil, fmt.Errorf("invalid avro schema %d: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(specification), &schema.schema); err != nil {
+		// a schema given as a bare primitive name, as string
+		schema.schema = specification
+	}
+	collectAvroNames(schema.schema, "", schema.names)
+
+	decoder.mutex.Lock()
+	decoder.schemas[id] = schema
+	decoder.mutex.Unlock()
+
+	return schema, nil
+}
+
+// isAvroPrimitive returns whether the type name is a primitive type.
+func isAvroPrimitive(name string) bool {
+	switch name {
+	case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+		return true
+	}
+
+	return false
+}
+
+// avroFullName returns the name qualified with the namespace, unless it is already qualified.
+func avroFullName(name string, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+
+	return namespace + "." + name
+}
+
+// avroNamespace returns the namespace of a named type definition.
+func avroNamespace(definition map[string]interface{}, enclosing string) string {
+	name, _ := definition["name"].(string)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	if namespace, ok := definition["namespace"].(string); ok {
+		return namespace
+	}
+
+	return enclosing
+}
+
+// collectAvroNames registers every record, enum and fixed definition by its full name.
+func collectAvroNames(schema interface{}, namespace string, names map[string]interface{}) {
+	switch s := schema.(type) {
+	case []interface{}:
+		for _, member := range s {
+			collectAvroNames(member, namespace, names)
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "error", "enum", "fixed":
+			name, _ := s["name"].(string)
+			namespace = avroNamespace(s, namespace)
+			names[avroFullName(name[strings.LastIndex(name, ".")+1:], namespace)] = s
+
+			fields, _ := s["fields"].([]interface{})
+			for _, field := range fields {
+				if definition, ok := field.(map[string]interface{}); ok {
+					collectAvroNames(definition["type"], namespace, names)
+				}
+			}
+		case "array":
+			collectAvroNames(s["items"], namespace, names)
+		case "map":
+			collectAvroNames(s["values"], namespace, names)
+		default:
+			collectAvroNames(s["type"], namespace, names)
+		}
+	}
+}
+
+// avroTypeName returns the name goavro gives to a union member.
+func avroTypeName(schema interface{}, namespace string) string {
+	switch s := schema.(type) {
+	case string:
+		if isAvroPrimitive(s) {
+			return s
+		}
+		return avroFullName(s, namespace)
+	case map[string]interface{}:
+		switch t := s["type"].(type) {
+		case string:
+			switch t {
+			case "record", "error", "enum", "fixed":
+				name, _ := s["name"].(string)
+				return avroFullName(name[strings.LastIndex(name, ".")+1:], avroNamespace(s, namespace))
+			case "array", "map":
+				return t
+			}
+			return avroTypeName(t, namespace)
+		default:
+			return avroTypeName(t, namespace)
+		}
+	}
+
+	return ""
+}
+
+// plainAvro converts a goavro native value to plain values, replacing every union by its value.
+func plainAvro(schema interface{}, value interface{}, names map[string]interface{}, namespace string) interface{} {
+	switch s := schema.(type) {
+	case string:
+		if isAvroPrimitive(s) {
+			return value
+		}
+		if named, ok := names[avroFullName(s, namespace)]; ok {
+			return plainAvro(named, value, names, namespace)
+		}
+		if named, ok := names[s]; ok {
+			return plainAvro(named, value, names, namespace)
+		}
+		return value
+
+	case []interface{}:
+		union, ok := value.(map[string]interface{})
+		if !ok || len(union) != 1 {
+			return value
+		}
+		for name, inner := range union {
+			for _, member := range s {
+				if avroTypeName(member, namespace) == name {
+					return plainAvro(member, inner, names, namespace)
+				}
+			}
+			return inner
+		}
+
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record", "error":
+			record, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			namespace = avroNamespace(s, namespace)
+			fields, _ := s["fields"].([]interface{})
+			plain := make(map[string]interface{}, len(record))
+			for _, field := range fields {
+				definition, _ := field.(map[string]interface{})
+				name, _ := definition["name"].(string)
+				if fieldValue, ok := record[name]; ok {
+					plain[name] = plainAvro(definition["type"], fieldValue, names, namespace)
+				}
+			}
+			return plain
+		case "array":
+			items, ok := value.([]interface{})
+			if !ok {
+				return value
+			}
+			plain := make([]interface{}, len(items))
+			for i, item := range items {
+				plain[i] = plainAvro(s["items"], item, names, namespace)
+			}
+			return plain
+		case "map":
+			values, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			plain := make(map[string]interface{}, len(values))
+			for key, item := range values {
+				plain[key] = plainAvro(s["values"], item, names, namespace)
+			}
+			return plain
+		case "enum", "fixed":
+			return value
+		default:
+			return plainAvro(s["type"], value, names, namespace)
+		}
+	}
+
+	return value
+}
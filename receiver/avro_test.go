@@ -0,0 +1,147 @@
+package receiver
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/linkedin/goavro/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const orderSchema = `{
+  "type": "record",
+  "name": "Order",
+  "namespace": "shop",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "quantity", "type": "int"},
+    {"name": "note", "type": ["null", "string"], "default": null},
+    {"name": "customer", "type": ["null", {
+      "type": "record", "name": "Customer",
+      "fields": [{"name": "email", "type": "string"}, {"name": "vip", "type": "boolean"}]
+    }]},
+    {"name": "previous", "type": {"type": "array", "items": ["null", "Customer"]}},
+    {"name": "labels", "type": {"type": "map", "values": ["null", "long"]}}
+  ]
+}`
+
+type testOrder struct {
+	ID       string  `json:"id"`
+	Quantity int     `json:"quantity"`
+	Note     *string `json:"note"`
+	Customer *struct {
+		Email string `json:"email"`
+		VIP   bool   `json:"vip"`
+	} `json:"customer"`
+	Labels map[string]*int64 `json:"labels"`
+}
+
+// standInRegistry serves GET /schemas/ids/{id} as a schema registry does, and counts the requests.
+func standInRegistry(schemas map[int]string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(requests, 1)
+		for id, schema := range schemas {
+			if request.Method == http.MethodGet && request.URL.Path == "/schemas/ids/"+strconv.Itoa(id) {
+				_ = json.NewEncoder(writer).Encode(map[string]string{"schema": schema})
+				return
+			}
+		}
+		writer.WriteHeader(http.StatusNotFound)
+		_, _ = writer.Write([]byte(`{"error_code": 40403, "message": "Schema not found"}`))
+	}))
+}
+
+func encodeAvro(t *testing.T, id int, schema string, native interface{}) []byte {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(id))
+	data, err := codec.BinaryFromNative(header, native)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestAvroDecoder_Decode(t *testing.T) {
+	var requests int32
+	server := standInRegistry(map[int]string{3: orderSchema}, &requests)
+	defer server.Close()
+
+	data := encodeAvro(t, 3, orderSchema, map[string]interface{}{
+		"id":       "o-1",
+		"quantity": 2,
+		"note":     nil,
+		"customer": goavro.Union("shop.Customer", map[string]interface{}{"email": "ada@example.com", "vip": true}),
+		"previous": []interface{}{nil, goavro.Union("shop.Customer", map[string]interface{}{"email": "bob", "vip": false})},
+		"labels":   map[string]interface{}{"a": goavro.Union("long", int64(7)), "b": nil},
+	})
+
+	decoder := NewAvroDecoder(NewHTTPSchemaRegistry(server.URL, nil))
+	value, err := decoder.Decode(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := value.(map[string]interface{})
+	customer, ok := order["customer"].(map[string]interface{})
+	if !ok || customer["email"] != "ada@example.com" || order["note"] != nil {
+		t.Errorf("the unions should be unwrapped, got %v", order)
+	}
+	previous := order["previous"].([]interface{})
+	if previous[0] != nil || previous[1].(map[string]interface{})["email"] != "bob" {
+		t.Errorf("unexpected array %v", previous)
+	}
+	if order["labels"].(map[string]interface{})["a"] != int64(7) {
+		t.Errorf("unexpected map %v", order["labels"])
+	}
+
+	var typed testOrder
+	if err := decoder.DecodeInto(context.Background(), data, &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.ID != "o-1" || typed.Quantity != 2 || typed.Customer == nil || !typed.Customer.VIP ||
+		*typed.Labels["a"] != 7 || typed.Labels["b"] != nil {
+		t.Errorf("unexpected order %+v", typed)
+	}
+
+	if requests != 1 {
+		t.Errorf("the schema should be fetched once but was fetched %d times", requests)
+	}
+}
+
+func TestAvroDecoder_Errors(t *testing.T) {
+	var requests int32
+	server := standInRegistry(map[int]string{1: `"string"`}, &requests)
+	defer server.Close()
+
+	decoder := NewAvroDecoder(NewHTTPSchemaRegistry(server.URL, nil))
+	ctx := context.Background()
+
+	if _, err := decoder.Decode(ctx, []byte(`{"id": 1}`)); !errors.Is(err, ErrNotAvro) {
+		t.Errorf("expected ErrNotAvro but got %v", err)
+	}
+
+	unknown := encodeAvro(t, 9, `"string"`, "text")
+	if _, err := decoder.Decode(ctx, unknown); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a schema not found error but got %v", err)
+	}
+
+	text := encodeAvro(t, 1, `"string"`, "text")
+	if value, err := decoder.Decode(ctx, text); err != nil || value != "text" {
+		t.Errorf("expected text but got %v: %v", value, err)
+	}
+	if _, err := decoder.Decode(ctx, append(text, 1)); err == nil {
+		t.Error("expected an error for trailing bytes")
+	}
+}
@@ -0,0 +1,330 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ChunkGroupProperty holds the message group id shared by the chunks of an event.
+	ChunkGroupProperty = "chunk-group-id"
+	// ChunkIndexProperty holds the position of the chunk in its group, from 0.
+	ChunkIndexProperty = "chunk-index"
+	// ChunkCountProperty holds the number of chunks of the group.
+	ChunkCountProperty = "chunk-count"
+	// ChunkTotalSizeProperty holds the size of the whole payload.
+	ChunkTotalSizeProperty = "chunk-total-size"
+
+	defaultChunkTimeout  = time.Minute
+	defaultChunkMaxBytes = 64 * 1024 * 1024
+)
+
+var (
+	// ErrChunkTimeout is the reason a group is discarded when its chunks did not arrive in time.
+	ErrChunkTimeout = errors.New("chunk group timed out")
+	// ErrChunkMemoryLimit is the reason a group is discarded to stay under ChunkOptions.MaxBytes.
+	ErrChunkMemoryLimit = errors.New("chunk group exceeds the memory limit")
+	// ErrInvalidChunk is the reason a group is discarded when a chunk does not match the others, or when its index,
+	// count or total size is missing or out of range.
+	ErrInvalidChunk = errors.New("invalid chunk")
+)
+
+type (
+	// ChunkOptions configures the reassembly of the events chunked by the sender, every field is optional.
+	ChunkOptions struct {
+		// Timeout is the max time between the first and the last chunk of a group, default 1 minute. The groups are
+		// checked while the listener runs, OnDiscard is called even when no other chunk arrives.
+		Timeout time.Duration
+		// MaxBytes is the max size of the chunks kept for the incomplete groups, default 64MB. The oldest groups are
+		// discarded to make room.
+		MaxBytes int
+		// OnDiscard is called with the groups which are not delivered, reason is ErrChunkTimeout, ErrChunkMemoryLimit
+		// or wraps ErrInvalidChunk.
+		OnDiscard func(groupID string, received int, count int, reason error)
+	}
+
+	// assembler keeps the chunks of the incomplete groups.
+	assembler struct {
+		options ChunkOptions
+		mutex   sync.Mutex
+		groups  map[string]*chunkGroup
+		bytes   int
+		now     func() time.Time
+		stop    chan struct{} // closed to stop the expiry of the groups, nil when it is not running
+	}
+
+	chunkGroup struct {
+		id       string
+		first    *eventhub.Event
+		chunks   map[int][]byte // received chunks by index, the count is not trusted to size anything
+		count    int
+		received int
+		size     int
+		total    int
+		started  time.Time
+	}
+
+	discarded struct {
+		group  *chunkGroup
+		reason error
+	}
+)
+
+// SetChunkReassembly(options ChunkOptions) reassembles the events chunked by the sender before they are decrypted,
+// filtered and delivered, the handler sees the whole event once every chunk has arrived. Without it the chunks are
+// delivered as they are.
+func (builder *Builder) SetChunkReassembly(options ChunkOptions) IReceiveBuilder {
+	builder.Chunks = &options
+
+	return builder
+}
+
+// newAssembler returns nil without options, a nil assembler delivers the chunks as they are.
+func newAssembler(options *ChunkOptions) *assembler {
+	if options == nil {
+		return nil
+	}
+
+	result := &assembler{options: *options, groups: make(map[string]*chunkGroup), now: time.Now}
+	if result.options.Timeout <= 0 {
+		result.options.Timeout = defaultChunkTimeout
+	}
+	if result.options.MaxBytes <= 0 {
+		result.options.MaxBytes = defaultChunkMaxBytes
+	}
+
+	return result
+}
+
+// add returns the event to deliver: the event itself when it is not a chunk, the reassembled event with its last
+// chunk, nil while its group is incomplete or when the group is discarded.
+func (a *assembler) add(event *eventhub.Event) *eventhub.Event {
+	if a == nil || event.Properties[ChunkGroupProperty] == nil {
+		return event
+	}
+
+	var dropped []discarded
+	defer func() {
+		a.report(dropped)
+	}()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.now()
+	dropped = a.sweep(now)
+
+	groupID := fmt.Sprint(event.Properties[ChunkGroupProperty])
+	index, indexErr := chunkNumber(event.Properties[ChunkIndexProperty])
+	count, countErr := chunkNumber(event.Properties[ChunkCountProperty])
+	total, totalErr := chunkNumber(event.Properties[ChunkTotalSizeProperty])
+
+	group, ok := a.groups[groupID]
+	if !ok {
+		// the properties come with the event, they are checked before anything is allocated for them
+		group = &chunkGroup{id: groupID, started: now, count: count, total: total}
+		if indexErr != nil || countErr != nil || totalErr != nil || total <= 0 || count <= 0 || count > total ||
+			index < 0 || index >= count {
+			reason := fmt.Errorf("%w: bad index, count or total size", ErrInvalidChunk)
+			dropped = append(dropped, discarded{group, reason})
+			return nil
+		}
+		if total > a.options.MaxBytes {
+			dropped = append(dropped, discarded{group, ErrChunkMemoryLimit})
+			return nil
+		}
+		group.chunks = make(map[int][]byte)
+		a.groups[groupID] = group
+	}
+
+	if indexErr != nil || countErr != nil || totalErr != nil || count != group.count || total != group.total ||
+		index < 0 || index >= count {
+		dropped = append(dropped, a.discard(group, fmt.Errorf("%w: bad index, count or total size", ErrInvalidChunk)))
+		return nil
+	}
+	if _, ok := group.chunks[index]; ok {
+		return nil // delivered again
+	}
+	if group.size+len(event.Data) > group.total {
+		dropped = append(dropped, a.discard(group, fmt.Errorf("%w: chunks bigger than the total size", ErrInvalidChunk)))
+		return nil
+	}
+
+	// make room for the chunk, the oldest groups go first
+	for a.bytes+len(event.Data) > a.options.MaxBytes {
+		oldest := a.oldest()
+		dropped = append(dropped, a.discard(oldest, ErrChunkMemoryLimit))
+		if oldest == group {
+			return nil
+		}
+	}
+
+	group.chunks[index] = event.Data
+	group.received++
+	group.size += len(event.Data)
+	a.bytes += len(event.Data)
+	if index == 0 {
+		group.first = event
+	}
+
+	if group.received < group.count {
+		return nil
+	}
+
+	delete(a.groups, groupID)
+	a.bytes -= group.size
+	if group.size != group.total {
+		dropped = append(dropped, discarded{group, fmt.Errorf("%w: chunks smaller than the total size", ErrInvalidChunk)})
+		return nil
+	}
+
+	data := make([]byte, 0, group.size)
+	for i := 0; i < group.count; i++ {
+		data = append(data, group.chunks[i]...)
+	}
+
+	result := *group.first
+	result.Data = data
+	result.Properties = make(map[string]interface{}, len(group.first.Properties))
+	for key, value := range group.first.Properties {
+		result.Properties[key] = value
+	}
+	delete(result.Properties, ChunkGroupProperty)
+	delete(result.Properties, ChunkIndexProperty)
+	delete(result.Properties, ChunkCountProperty)
+	delete(result.Properties, ChunkTotalSizeProperty)
+
+	return &result
+}
+
+// startExpiry discards the groups which time out while no other chunk arrives, it checks them every quarter of the
+// timeout until stopExpiry is called.
+func (a *assembler) startExpiry() {
+	if a == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.stop != nil {
+		return
+	}
+	a.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		interval := a.options.Timeout / 4
+		if interval <= 0 {
+			interval = a.options.Timeout
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				a.mutex.Lock()
+				dropped := a.sweep(a.now())
+				a.mutex.Unlock()
+				a.report(dropped)
+			}
+		}
+	}(a.stop)
+}
+
+// stopExpiry stops the expiry started by startExpiry.
+func (a *assembler) stopExpiry() {
+	if a == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+}
+
+// sweep discards the groups started more than the timeout before now, the mutex must be held.
+func (a *assembler) sweep(now time.Time) []discarded {
+	var dropped []discarded
+	for _, group := range a.groups {
+		if now.Sub(group.started) > a.options.Timeout {
+			dropped = append(dropped, a.discard(group, ErrChunkTimeout))
+		}
+	}
+
+	return dropped
+}
+
+// report gives the discarded groups to OnDiscard, it is called without the mutex.
+func (a *assembler) report(dropped []discarded) {
+	if a.options.OnDiscard == nil {
+		return
+	}
+
+	for _, d := range dropped {
+		a.options.OnDiscard(d.group.id, d.group.received, d.group.count, d.reason)
+	}
+}
+
+// pending returns the number of incomplete groups and the bytes of their chunks.
+func (a *assembler) pending() (int, int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return len(a.groups), a.bytes
+}
+
+func (a *assembler) discard(group *chunkGroup, reason error) discarded {
+	delete(a.groups, group.id)
+	a.bytes -= group.size
+
+	return discarded{group, reason}
+}
+
+func (a *assembler) oldest() *chunkGroup {
+	var oldest *chunkGroup
+	for _, group := range a.groups {
+		if oldest == nil || group.started.Before(oldest.started) {
+			oldest = group
+		}
+	}
+
+	return oldest
+}
+
+// chunkNumber reads a chunk property, the numbers can arrive with any integer type or as text.
+func chunkNumber(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+
+	return 0, fmt.Errorf("invalid chunk number %v", value)
+}
+
+// ChunkStats() returns the number of incomplete chunk groups and the bytes they hold.
+func (receiver *Receiver) ChunkStats() (groups int, bytes int) {
+	if receiver.chunks == nil {
+		return 0, 0
+	}
+
+	return receiver.chunks.pending()
+}
@@ -0,0 +1,217 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunkEvent splits the event as the sender does.
+func chunkEvent(event *eventhub.Event, group string, size int) []*eventhub.Event {
+	count := (len(event.Data) + size - 1) / size
+
+	var chunks []*eventhub.Event
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(event.Data) {
+			end = len(event.Data)
+		}
+
+		chunk := eventhub.NewEvent(event.Data[i*size : end])
+		for key, value := range event.Properties {
+			chunk.Set(key, value)
+		}
+		chunk.Set(ChunkGroupProperty, group)
+		chunk.Set(ChunkIndexProperty, int64(i))
+		chunk.Set(ChunkCountProperty, int64(count))
+		chunk.Set(ChunkTotalSizeProperty, int64(len(event.Data)))
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+type discard struct {
+	group  string
+	reason error
+}
+
+func newChunkReceiver(options ChunkOptions, received *[]*eventhub.Event, discards *[]discard) *Receiver {
+	options.OnDiscard = func(groupID string, receivedChunks int, count int, reason error) {
+		*discards = append(*discards, discard{groupID, reason})
+	}
+
+	receiver, _ := NewReceiverBuilder().SetConnectionString("endpoint://...").
+		AddDataFilter("needle").
+		SetChunkReassembly(options).
+		SetReceiverHandler(func(ctx context.Context, event *eventhub.Event) error {
+			*received = append(*received, event)
+			return nil
+		}).GetReceiver()
+
+	return receiver
+}
+
+func TestReceiver_Reassembles_Chunks(t *testing.T) {
+	var received []*eventhub.Event
+	var discards []discard
+	receiver := newChunkReceiver(ChunkOptions{}, &received, &discards)
+
+	document := strings.Repeat("a", 25) + "needle" + strings.Repeat("b", 25)
+	event := eventhub.NewEventFromString(document)
+	event.Set("kind", "document")
+	chunks := chunkEvent(event, "g1", 10)
+
+	// out of order, with a chunk delivered twice
+	for _, i := range []int{5, 0, 3, 3, 1, 4, 2} {
+		if err := receiver.onReceive(context.Background(), chunks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(received) != 1 || string(received[0].Data) != document {
+		t.Fatalf("expected the reassembled document once but got %d events", len(received))
+	}
+	if received[0].Properties["kind"] != "document" || received[0].Properties[ChunkGroupProperty] != nil {
+		t.Errorf("unexpected properties %v", received[0].Properties)
+	}
+	if groups, bytes := receiver.ChunkStats(); groups != 0 || bytes != 0 || len(discards) != 0 {
+		t.Errorf("nothing should be pending, got %d groups, %d bytes and %v", groups, bytes, discards)
+	}
+}
+
+func TestReceiver_Reassembles_Encrypted_Chunks(t *testing.T) {
+	var received []*eventhub.Event
+	receiver := newDecryptingReceiver(t, &received)
+	receiver.chunks = newAssembler(&ChunkOptions{})
+
+	for _, chunk := range chunkEvent(encryptEvent(t, "k2", testKey(2), strings.Repeat("personal data ", 10)), "g1", 16) {
+		if err := receiver.onReceive(context.Background(), chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(received) != 1 || string(received[0].Data) != strings.Repeat("personal data ", 10) {
+		t.Errorf("expected the decrypted document but got %d events", len(received))
+	}
+}
+
+func TestReceiver_Chunk_Timeout_And_Memory_Limit(t *testing.T) {
+	var received []*eventhub.Event
+	var discards []discard
+	receiver := newChunkReceiver(ChunkOptions{Timeout: time.Second, MaxBytes: 25}, &received, &discards)
+
+	now := time.Now()
+	receiver.chunks.now = func() time.Time { return now }
+	receive := func(event *eventhub.Event) {
+		if err := receiver.onReceive(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g1 := chunkEvent(eventhub.NewEventFromString(strings.Repeat("x", 20)), "g1", 10)
+	g2 := chunkEvent(eventhub.NewEventFromString(strings.Repeat("y", 20)), "g2", 10)
+	g3 := chunkEvent(eventhub.NewEventFromString(strings.Repeat("z", 20)), "g3", 10)
+
+	receive(g1[0])
+	now = now.Add(10 * time.Millisecond)
+	receive(g2[0])
+	receive(g3[0]) // 30 bytes would be kept, g1 is the oldest
+	if len(discards) != 1 || discards[0].group != "g1" || !errors.Is(discards[0].reason, ErrChunkMemoryLimit) {
+		t.Fatalf("expected g1 discarded for the memory limit but got %v", discards)
+	}
+
+	now = now.Add(2 * time.Second)
+	receive(g1[1])
+	if len(discards) != 3 || !errors.Is(discards[1].reason, ErrChunkTimeout) ||
+		!errors.Is(discards[2].reason, ErrChunkTimeout) {
+		t.Fatalf("expected g2 and g3 discarded for the timeout but got %v", discards)
+	}
+
+	receive(chunkEvent(eventhub.NewEventFromString(strings.Repeat("w", 30)), "g4", 10)[0])
+	if len(discards) != 4 || discards[3].group != "g4" || !errors.Is(discards[3].reason, ErrChunkMemoryLimit) {
+		t.Errorf("expected g4 refused for its total size but got %v", discards)
+	}
+
+	if len(received) != 0 {
+		t.Errorf("no event should be delivered, got %d", len(received))
+	}
+}
+
+func TestReceiver_Refuses_Malformed_Chunks(t *testing.T) {
+	var received []*eventhub.Event
+	var discards []discard
+	receiver := newChunkReceiver(ChunkOptions{}, &received, &discards)
+
+	hostile := eventhub.NewEventFromString("x")
+	hostile.Set(ChunkGroupProperty, "g1")
+	hostile.Set(ChunkIndexProperty, int64(0))
+	hostile.Set(ChunkCountProperty, int64(1)<<40)
+	hostile.Set(ChunkTotalSizeProperty, int64(1)<<40)
+
+	withoutTotal := eventhub.NewEventFromString("x")
+	withoutTotal.Set(ChunkGroupProperty, "g2")
+	withoutTotal.Set(ChunkIndexProperty, int64(0))
+	withoutTotal.Set(ChunkCountProperty, int64(1)<<40)
+
+	moreChunksThanBytes := chunkEvent(eventhub.NewEventFromString("xy"), "g3", 1)[0]
+	moreChunksThanBytes.Set(ChunkCountProperty, int64(3))
+
+	oversized := chunkEvent(eventhub.NewEventFromString(strings.Repeat("z", 20)), "g4", 10)
+	oversized[1].Data = []byte(strings.Repeat("z", 11))
+
+	for _, event := range []*eventhub.Event{hostile, withoutTotal, moreChunksThanBytes, oversized[0], oversized[1]} {
+		if err := receiver.onReceive(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(discards) != 4 || !errors.Is(discards[0].reason, ErrChunkMemoryLimit) {
+		t.Fatalf("expected the 4 groups discarded but got %v", discards)
+	}
+	for _, d := range discards[1:] {
+		if !errors.Is(d.reason, ErrInvalidChunk) {
+			t.Errorf("expected ErrInvalidChunk for %s but got %v", d.group, d.reason)
+		}
+	}
+	if groups, bytes := receiver.ChunkStats(); groups != 0 || bytes != 0 || len(received) != 0 {
+		t.Errorf("nothing should be kept or delivered, got %d groups, %d bytes, %d events", groups, bytes, len(received))
+	}
+}
+
+func TestReceiver_Chunk_Groups_Expire_Without_Traffic(t *testing.T) {
+	discarded := make(chan string, 1)
+	receiver, _ := NewReceiverBuilder().SetConnectionString("endpoint://...").
+		SetChunkReassembly(ChunkOptions{
+			Timeout: 40 * time.Millisecond,
+			OnDiscard: func(groupID string, received int, count int, reason error) {
+				if errors.Is(reason, ErrChunkTimeout) {
+					discarded <- groupID
+				}
+			},
+		}).
+		SetReceiverHandler(func(ctx context.Context, event *eventhub.Event) error { return nil }).GetReceiver()
+
+	receiver.chunks.startExpiry()
+	defer receiver.chunks.stopExpiry()
+
+	chunks := chunkEvent(eventhub.NewEventFromString(strings.Repeat("x", 20)), "g1", 10)
+	if err := receiver.onReceive(context.Background(), chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case group := <-discarded:
+		if group != "g1" {
+			t.Errorf("expected g1 discarded but got %s", group)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the incomplete group should time out without other chunks")
+	}
+	if groups, bytes := receiver.ChunkStats(); groups != 0 || bytes != 0 {
+		t.Errorf("nothing should be kept, got %d groups and %d bytes", groups, bytes)
+	}
+}
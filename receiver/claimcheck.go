@@ -0,0 +1,187 @@
+package receiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ClaimCheckProperty holds the name of the blob with the payload of the event.
+	ClaimCheckProperty = "claim-check"
+	// ClaimCheckSizeProperty holds the size of the payload.
+	ClaimCheckSizeProperty = "claim-check-size"
+	// ClaimCheckDigestProperty holds the hex SHA-256 of the payload.
+	ClaimCheckDigestProperty = "claim-check-sha256"
+)
+
+// ErrBlobNotFound is returned by the stores when the blob of a claim check does not exist.
+var ErrBlobNotFound = errors.New("blob not found")
+
+type (
+	// BlobStore reads the payloads stored by the claim check of the sender.
+	BlobStore interface {
+		// Get(ctx context.Context, name string) returns the payload stored under name, ErrBlobNotFound when it does
+		// not exist.
+		Get(ctx context.Context, name string) ([]byte, error)
+	}
+
+	// FileBlobStore reads the payloads from the files of a directory.
+	FileBlobStore struct {
+		dir string
+	}
+
+	// httpBlobStore downloads the payloads with a GET per blob, as Azure Blob Storage, Azurite and S3 compatible stores.
+	httpBlobStore struct {
+		container *url.URL
+		headers   map[string]string
+		client    *http.Client
+	}
+
+	// claimFetcher puts back the payloads of the claim checks in the events.
+	claimFetcher struct {
+		store BlobStore
+	}
+)
+
+// SetBlobStore(store BlobStore) fetches the payloads of the events claim checked by the sender, after the chunks are
+// reassembled and before the event is decrypted, filtered and delivered. An event whose payload cannot be fetched is
+// not delivered, the error is returned.
+func (builder *Builder) SetBlobStore(store BlobStore) IReceiveBuilder {
+	builder.BlobStore = store
+
+	return builder
+}
+
+// newClaimFetcher returns nil without a store, a nil claimFetcher delivers the reference events as they are.
+func newClaimFetcher(store BlobStore) *claimFetcher {
+	if store == nil {
+		return nil
+	}
+
+	return &claimFetcher{store: store}
+}
+
+// fetch replaces the body of a reference event by the payload and removes the claim check properties. The size and
+// the digest are checked when the event has them.
+func (f *claimFetcher) fetch(ctx context.Context, event *eventhub.Event) error {
+	if f == nil || event.Properties[ClaimCheckProperty] == nil {
+		return nil
+	}
+
+	name := fmt.Sprint(event.Properties[ClaimCheckProperty])
+	data, err := f.store.Get(ctx, name)
+	if err != nil {
+		return fmt.Errorf("cannot fetch the payload of the claim check %q: %w", name, err)
+	}
+
+	if size := event.Properties[ClaimCheckSizeProperty]; size != nil {
+		if expected, err := chunkNumber(size); err != nil || expected != len(data) {
+			return fmt.Errorf("payload of the claim check %q has %d bytes instead of %v", name, len(data), size)
+		}
+	}
+	if expected, ok := event.Properties[ClaimCheckDigestProperty].(string); ok {
+		digest := sha256.Sum256(data)
+		if !strings.EqualFold(expected, hex.EncodeToString(digest[:])) {
+			return fmt.Errorf("payload of the claim check %q does not match its digest", name)
+		}
+	}
+
+	event.Data = data
+	delete(event.Properties, ClaimCheckProperty)
+	delete(event.Properties, ClaimCheckSizeProperty)
+	delete(event.Properties, ClaimCheckDigestProperty)
+
+	return nil
+}
+
+// NewFileBlobStore(dir string) returns a BlobStore reading the payloads from the files of dir.
+func NewFileBlobStore(dir string) *FileBlobStore {
+	return &FileBlobStore{dir: dir}
+}
+
+// Get(ctx context.Context, name string) reads the file name of the directory, the names with a path are refused so an
+// event cannot read outside of it.
+func (store *FileBlobStore) Get(ctx context.Context, name string) ([]byte, error) {
+	if !validBlobName(name) {
+		return nil, fmt.Errorf("invalid blob name %q", name)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(store.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+
+	return data, err
+}
+
+// validBlobName refuses the names which are not a single path element, the names come with the events.
+func validBlobName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// NewHTTPBlobStore(containerURL string, headers map[string]string, client *http.Client) returns a BlobStore
+// downloading every payload with a GET of containerURL/name, the query of containerURL (ex: a SAS token) is kept and
+// headers are added to every request (ex: an authorization). It works with Azure Blob Storage, Azurite and the S3
+// compatible stores. http.DefaultClient is used when client is nil.
+func NewHTTPBlobStore(containerURL string, headers map[string]string, client *http.Client) (BlobStore, error) {
+	container, err := url.Parse(containerURL)
+	if err != nil {
+		return nil, err
+	}
+	if container.Scheme != "http" && container.Scheme != "https" {
+		return nil, fmt.Errorf("invalid blob container url %q", containerURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpBlobStore{container: container, headers: headers, client: client}, nil
+}
+
+func (store *httpBlobStore) Get(ctx context.Context, name string) ([]byte, error) {
+	if !validBlobName(name) {
+		return nil, fmt.Errorf("invalid blob name %q", name)
+	}
+
+	blobURL := *store.container
+	blobURL.Path = strings.TrimSuffix(store.container.Path, "/") + "/" + name
+	blobURL.RawPath = strings.TrimSuffix(store.container.EscapedPath(), "/") + "/" + url.PathEscape(name)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, blobURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range store.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := store.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrBlobNotFound
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("blob store: GET %s: %s", name, response.Status)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,107 @@
+package receiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// referenceEvent returns the event the sender sends in place of the payload stored as name.
+func referenceEvent(name string, payload string) *eventhub.Event {
+	digest := sha256.Sum256([]byte(payload))
+	event := eventhub.NewEventFromString(name)
+	event.Set(ClaimCheckProperty, name)
+	event.Set(ClaimCheckSizeProperty, int64(len(payload)))
+	event.Set(ClaimCheckDigestProperty, hex.EncodeToString(digest[:]))
+	event.Set("kind", "document")
+
+	return event
+}
+
+func TestReceiver_Fetches_Claim_Checks(t *testing.T) {
+	dir := t.TempDir()
+	payload := strings.Repeat("large document ", 100)
+	if err := ioutil.WriteFile(filepath.Join(dir, "blob-1"), []byte(payload), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var received []*eventhub.Event
+	receiver, _ := NewReceiverBuilder().SetConnectionString("endpoint://...").
+		SetBlobStore(NewFileBlobStore(dir)).
+		SetReceiverHandler(func(ctx context.Context, event *eventhub.Event) error {
+			received = append(received, event)
+			return nil
+		}).GetReceiver()
+
+	if err := receiver.onReceive(context.Background(), referenceEvent("blob-1", payload)); err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.onReceive(context.Background(), eventhub.NewEventFromString("small document")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 2 || string(received[0].Data) != payload || string(received[1].Data) != "small document" {
+		t.Fatalf("expected the payload and the small document but got %d events", len(received))
+	}
+	if received[0].Properties["kind"] != "document" || received[0].Properties[ClaimCheckProperty] != nil ||
+		received[0].Properties[ClaimCheckDigestProperty] != nil {
+		t.Errorf("unexpected properties %v", received[0].Properties)
+	}
+
+	tampered := referenceEvent("blob-1", "another document")
+	if err := receiver.onReceive(context.Background(), tampered); err == nil || len(received) != 2 {
+		t.Error("a payload which does not match the digest should not be delivered")
+	}
+
+	if err := receiver.onReceive(context.Background(), referenceEvent("blob-2", payload)); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound but got %v", err)
+	}
+
+	if _, err := NewFileBlobStore(dir).Get(context.Background(), "../secret"); err == nil {
+		t.Error("a name with a path should be refused")
+	}
+}
+
+func TestHTTPBlobStore_Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != "secret" || r.Header.Get("x-tenant") != "t1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != "/devstoreaccount1/payloads/blob-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("payload"))
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPBlobStore(server.URL+"/devstoreaccount1/payloads?sv=2020-08-04&sig=secret",
+		map[string]string{"x-tenant": "t1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := store.Get(context.Background(), "blob-1"); err != nil || string(data) != "payload" {
+		t.Errorf("expected the payload but got %q, %v", data, err)
+	}
+	if _, err := store.Get(context.Background(), "blob-2"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound but got %v", err)
+	}
+	if _, err := store.Get(context.Background(), ".."); err == nil {
+		t.Error("a name outside of the container should be refused")
+	}
+
+	store, _ = NewHTTPBlobStore(server.URL+"/devstoreaccount1/payloads", nil, nil)
+	if _, err := store.Get(context.Background(), "blob-1"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the status of the store but got %v", err)
+	}
+}
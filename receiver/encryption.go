@@ -0,0 +1,201 @@
+package receiver
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io/ioutil"
+	"sync"
+)
+
+const (
+	// EncryptionAlgorithm is the algorithm of the payloads encrypted by the sender, AES-256 in GCM mode.
+	EncryptionAlgorithm = "AES-256-GCM"
+
+	// EncryptionAlgorithmProperty holds the algorithm of an encrypted event.
+	EncryptionAlgorithmProperty = "encryption-algorithm"
+	// EncryptionKeyIDProperty holds the id of the key which wrapped the data key.
+	EncryptionKeyIDProperty = "encryption-key-id"
+	// EncryptionDataKeyProperty holds the data key wrapped by the key provider, in base64.
+	EncryptionDataKeyProperty = "encryption-data-key"
+
+	keySize = 32
+	// maxCachedDataKeys bounds the unwrapped data keys kept, the sender reuses a data key for many events.
+	maxCachedDataKeys = 1024
+)
+
+type (
+	// KeyProvider unwraps the data keys of the encrypted events with the key of their id.
+	KeyProvider interface {
+		UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	}
+
+	// FileKeyProvider is a KeyProvider reading its keys from the JSON file of the sender FileKeyProvider:
+	// {"current": "2024-02", "keys": {"2024-01": "<base64 of 32 bytes>", "2024-02": "<base64 of 32 bytes>"}}
+	// Every key of the file unwraps, call Reload once the file has a new key.
+	FileKeyProvider struct {
+		path  string
+		mutex sync.RWMutex
+		keys  map[string]cipher.AEAD
+	}
+
+	// decryptor decrypts the events encrypted by the sender, it keeps the unwrapped data keys.
+	decryptor struct {
+		provider KeyProvider
+		mutex    sync.Mutex
+		dataKeys map[string]cipher.AEAD // key id and wrapped data key -> data key
+	}
+)
+
+// NewFileKeyProvider(path string) returns a KeyProvider with the keys of the file.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	provider := &FileKeyProvider{path: path}
+	if err := provider.Reload(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// Reload() reads the keys of the file again, the keys in use are kept when the file is invalid.
+func (provider *FileKeyProvider) Reload() error {
+	content, err := ioutil.ReadFile(provider.path)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Keys map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("invalid key file %s: %w", provider.path, err)
+	}
+
+	keys := make(map[string]cipher.AEAD, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := b64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return fmt.Errorf("invalid key file %s: key %q must be 32 bytes in base64", provider.path, id)
+		}
+		if keys[id], err = newGCM(key); err != nil {
+			return err
+		}
+	}
+
+	provider.mutex.Lock()
+	provider.keys = keys
+	provider.mutex.Unlock()
+
+	return nil
+}
+
+func (provider *FileKeyProvider) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	provider.mutex.RLock()
+	aead, ok := provider.keys[keyID]
+	provider.mutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+
+	return open(aead, wrapped, []byte(keyID))
+}
+
+// newDecryptor returns nil without key provider, a nil decryptor leaves the events as they are.
+func newDecryptor(provider KeyProvider) *decryptor {
+	if provider == nil {
+		return nil
+	}
+
+	return &decryptor{provider: provider, dataKeys: make(map[string]cipher.AEAD)}
+}
+
+// decrypt replaces the payload of an encrypted event by the plaintext and removes the encryption properties, the
+// events which are not encrypted are left as they are.
+func (dec *decryptor) decrypt(ctx context.Context, event *eventhub.Event) error {
+	if dec == nil || event.Properties[EncryptionAlgorithmProperty] == nil {
+		return nil
+	}
+
+	if algorithm := event.Properties[EncryptionAlgorithmProperty]; algorithm != EncryptionAlgorithm {
+		return fmt.Errorf("unsupported encryption algorithm %v", algorithm)
+	}
+	keyID, _ := event.Properties[EncryptionKeyIDProperty].(string)
+	wrapped, _ := event.Properties[EncryptionDataKeyProperty].(string)
+	if keyID == "" || wrapped == "" {
+		return errors.New("encrypted event without key id or data key")
+	}
+
+	aead, err := dec.dataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return err
+	}
+
+	data, err := open(aead, event.Data, []byte(keyID))
+	if err != nil {
+		return fmt.Errorf("cannot decrypt the event with key %q: %w", keyID, err)
+	}
+
+	event.Data = data
+	delete(event.Properties, EncryptionAlgorithmProperty)
+	delete(event.Properties, EncryptionKeyIDProperty)
+	delete(event.Properties, EncryptionDataKeyProperty)
+
+	return nil
+}
+
+func (dec *decryptor) dataKey(ctx context.Context, keyID string, wrapped string) (cipher.AEAD, error) {
+	cacheKey := keyID + "/" + wrapped
+
+	dec.mutex.Lock()
+	aead, ok := dec.dataKeys[cacheKey]
+	dec.mutex.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	wrappedKey, err := b64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+
+	dataKey, err := dec.provider.UnwrapKey(ctx, keyID, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap the data key with key %q: %w", keyID, err)
+	}
+	if aead, err = newGCM(dataKey); err != nil {
+		return nil, err
+	}
+
+	dec.mutex.Lock()
+	if len(dec.dataKeys) >= maxCachedDataKeys {
+		dec.dataKeys = make(map[string]cipher.AEAD)
+	}
+	dec.dataKeys[cacheKey] = aead
+	dec.mutex.Unlock()
+
+	return aead, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// open decrypts a nonce followed by the ciphertext and its tag.
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+}
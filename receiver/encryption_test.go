@@ -0,0 +1,120 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	b64 "encoding/base64"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(i int) []byte {
+	return bytes.Repeat([]byte{byte(i)}, 32)
+}
+
+func seal(t *testing.T, aead cipher.AEAD, plaintext []byte, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+// encryptEvent encrypts as the sender does: a data key encrypts the message and the key of keyID wraps the data key.
+func encryptEvent(t *testing.T, keyID string, key []byte, message string) *eventhub.Event {
+	dataKey := make([]byte, 32)
+	_, _ = rand.Read(dataKey)
+
+	kek, _ := newGCM(key)
+	aead, _ := newGCM(dataKey)
+
+	event := eventhub.NewEvent(seal(t, aead, []byte(message), []byte(keyID)))
+	event.Set(EncryptionAlgorithmProperty, EncryptionAlgorithm)
+	event.Set(EncryptionKeyIDProperty, keyID)
+	event.Set(EncryptionDataKeyProperty, b64.StdEncoding.EncodeToString(seal(t, kek, dataKey, []byte(keyID))))
+	event.Set("tenant", "contoso")
+
+	return event
+}
+
+func newDecryptingReceiver(t *testing.T, received *[]*eventhub.Event) *Receiver {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"current": "k2", "keys": {"k1": "` + b64.StdEncoding.EncodeToString(testKey(1)) + `", "k2": "` +
+		b64.StdEncoding.EncodeToString(testKey(2)) + `"}}`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiver, _ := NewReceiverBuilder().SetConnectionString("endpoint://...").
+		AddDataFilter("personal").
+		SetKeyProvider(provider).
+		SetReceiverHandler(func(ctx context.Context, event *eventhub.Event) error {
+			*received = append(*received, event)
+			return nil
+		}).GetReceiver()
+
+	return receiver
+}
+
+func TestReceiver_Decrypts_Before_The_Filters(t *testing.T) {
+	var received []*eventhub.Event
+	receiver := newDecryptingReceiver(t, &received)
+
+	// events of the old and the current key
+	for i, keyID := range []string{"k1", "k2"} {
+		if err := receiver.onReceive(context.Background(), encryptEvent(t, keyID, testKey(i+1), "personal data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := receiver.onReceive(context.Background(), eventhub.NewEventFromString("personal plain")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("expected the 3 events to pass the data filter but got %d", len(received))
+	}
+	for _, event := range received[:2] {
+		if string(event.Data) != "personal data" || event.Properties["tenant"] != "contoso" {
+			t.Errorf("unexpected event %s %v", event.Data, event.Properties)
+		}
+		if _, ok := event.Properties[EncryptionDataKeyProperty]; ok {
+			t.Error("the encryption properties should be removed")
+		}
+	}
+}
+
+func TestReceiver_Decryption_Failures(t *testing.T) {
+	var received []*eventhub.Event
+	receiver := newDecryptingReceiver(t, &received)
+	ctx := context.Background()
+
+	if err := receiver.onReceive(ctx, encryptEvent(t, "k3", testKey(3), "personal data")); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+
+	tampered := encryptEvent(t, "k1", testKey(1), "personal data")
+	tampered.Data[len(tampered.Data)-1] ^= 1
+	if err := receiver.onReceive(ctx, tampered); err == nil {
+		t.Error("expected an error for a tampered payload")
+	}
+
+	other := encryptEvent(t, "k1", testKey(1), "personal data")
+	other.Set(EncryptionAlgorithmProperty, "ROT13")
+	if err := receiver.onReceive(ctx, other); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+
+	if len(received) != 0 {
+		t.Errorf("the handler should not see the events which cannot be decrypted, got %d", len(received))
+	}
+}
@@ -2,4 +2,7 @@ module github.com/azure-open-tools/event-hubs/receiver
 
 go 1.16
 
-require github.com/Azure/azure-event-hubs-go/v3 v3.3.6
+require (
+	github.com/Azure/azure-event-hubs-go/v3 v3.3.6
+	github.com/linkedin/goavro/v2 v2.11.1
+)
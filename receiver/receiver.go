@@ -18,6 +18,10 @@ type (
 		SetConnectionString(connStr string) IReceiveBuilder
 		SetConsumerGroup(consumerGroup string) IReceiveBuilder
 		SetReceiverHandler(handler func(ctx context.Context, event *eventhub.Event) error) IReceiveBuilder
+		SetKeyProvider(provider KeyProvider) IReceiveBuilder
+		SetSignatureVerification(options SignatureOptions) IReceiveBuilder
+		SetChunkReassembly(options ChunkOptions) IReceiveBuilder
+		SetBlobStore(store BlobStore) IReceiveBuilder
 		GetReceiver() (*Receiver, error)
 	}
 
@@ -34,6 +38,10 @@ type (
 		connString       string
 		consumerGroup    string
 		onReceiveHandler func(ctx context.Context, event *eventhub.Event) error
+		decryption       *decryptor
+		signature        *verifier
+		chunks           *assembler
+		claimCheck       *claimFetcher
 
 		eHub           *eventhub.Hub
 	}
@@ -46,6 +54,10 @@ type (
 		ConsumerGroup    string
 
 		OnReceiveHandler func(ctx context.Context, event *eventhub.Event) error
+		KeyProvider      KeyProvider
+		Signature        *SignatureOptions
+		Chunks           *ChunkOptions
+		BlobStore        BlobStore
 	}
 )
 
@@ -125,6 +137,14 @@ func (builder *Builder) SetReceiverHandler(handler func(ctx context.Context, eve
 	return builder
 }
 
+// SetKeyProvider(provider KeyProvider) decrypts the events encrypted by the sender before the filters and the handler
+// see them, the events which are not encrypted are delivered as they are.
+func (builder *Builder) SetKeyProvider(provider KeyProvider) IReceiveBuilder {
+	builder.KeyProvider = provider
+
+	return builder
+}
+
 func (builder *Builder) GetReceiver() (*Receiver, error) {
 	if len(strings.TrimSpace(builder.ConnString)) == 0 {
 		return nil, errors.New("connection string is missing")
@@ -143,6 +163,10 @@ func (builder *Builder) GetReceiver() (*Receiver, error) {
 	receiver.propertyFilter = builder.PropertyFilter
 	receiver.partitionIds = builder.PartitionIds
 	receiver.onReceiveHandler = builder.OnReceiveHandler
+	receiver.decryption = newDecryptor(builder.KeyProvider)
+	receiver.signature = newVerifier(builder.Signature)
+	receiver.chunks = newAssembler(builder.Chunks)
+	receiver.claimCheck = newClaimFetcher(builder.BlobStore)
 
 	hub, err := eventhub.NewHubFromConnectionString(receiver.connString)
 	if err == nil {
@@ -155,6 +179,8 @@ func (builder *Builder) GetReceiver() (*Receiver, error) {
 func (receiver *Receiver) StartListener(ctx context.Context) error {
 	var err error
 
+	receiver.chunks.startExpiry()
+
 	if len(receiver.partitionIds) > 0 {
 		err = listenToSpecificPartitions(ctx, receiver)
 	} else {
@@ -165,6 +191,7 @@ func (receiver *Receiver) StartListener(ctx context.Context) error {
 }
 
 func (receiver *Receiver) StopListener(ctx context.Context) error {
+	receiver.chunks.stopExpiry()
 	if receiver.eHub != nil {
 		return receiver.eHub.Close(ctx)
 	}
@@ -173,6 +200,25 @@ func (receiver *Receiver) StopListener(ctx context.Context) error {
 }
 
 func (receiver *Receiver) onReceive(ctx context.Context, event *eventhub.Event) error {
+	// the signature covers the encrypted payload
+	if !receiver.signature.accept(ctx, event) {
+		return nil
+	}
+
+	// the chunks are signed one by one and the whole payload is encrypted
+	if event = receiver.chunks.add(event); event == nil {
+		return nil
+	}
+
+	// the blob holds the encrypted payload
+	if err := receiver.claimCheck.fetch(ctx, event); err != nil {
+		return err
+	}
+
+	if err := receiver.decryption.decrypt(ctx, event); err != nil {
+		return err
+	}
+
 	if len(receiver.dataFilter) > 0 {
 		evt := checkDataFilter(event, receiver)
 		if evt != nil {
@@ -0,0 +1,219 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// SignatureProperty holds the signature of the event, in base64.
+	SignatureProperty = "signature"
+	// SignatureKeyIDProperty holds the id of the key which signed the event.
+	SignatureKeyIDProperty = "signature-key-id"
+	// SignedPropertiesProperty holds the comma separated names of the properties covered by the signature.
+	SignedPropertiesProperty = "signed-properties"
+)
+
+var (
+	// ErrUnsignedEvent is the reason of the rejection of an event without signature.
+	ErrUnsignedEvent = errors.New("event is not signed")
+	// ErrInvalidSignature is the reason of the rejection of an event whose signature does not match, or whose key is
+	// unknown.
+	ErrInvalidSignature = errors.New("invalid event signature")
+)
+
+type (
+	// SignatureOptions configures the verification of the events signed by the sender.
+	SignatureOptions struct {
+		// Keys are the signing keys by id, several ids can be accepted during a rotation.
+		Keys map[string][]byte
+		// OnReject is called with the events which are not delivered, reason is ErrUnsignedEvent or wraps
+		// ErrInvalidSignature.
+		OnReject func(ctx context.Context, event *eventhub.Event, reason error)
+		// Audit delivers every event and only counts the unsigned and invalid ones, OnReject is not called.
+		Audit bool
+	}
+
+	// SignatureStats counts the verified events by outcome.
+	SignatureStats struct {
+		Verified int64
+		Unsigned int64
+		Invalid  int64
+	}
+
+	// verifier checks the signatures and counts the outcomes.
+	verifier struct {
+		options  SignatureOptions
+		verified int64
+		unsigned int64
+		invalid  int64
+	}
+)
+
+// SetSignatureVerification(options SignatureOptions) verifies the signature of every event before it is decrypted,
+// filtered and delivered. The unsigned events and the events with a bad signature are given to OnReject instead of the
+// handler, or only counted in audit mode.
+func (builder *Builder) SetSignatureVerification(options SignatureOptions) IReceiveBuilder {
+	builder.Signature = &options
+
+	return builder
+}
+
+// SignatureStats() returns the number of verified, unsigned and invalid events since the receiver was created.
+func (receiver *Receiver) SignatureStats() SignatureStats {
+	if receiver.signature == nil {
+		return SignatureStats{}
+	}
+
+	return SignatureStats{
+		Verified: atomic.LoadInt64(&receiver.signature.verified),
+		Unsigned: atomic.LoadInt64(&receiver.signature.unsigned),
+		Invalid:  atomic.LoadInt64(&receiver.signature.invalid),
+	}
+}
+
+// newVerifier returns nil without options, a nil verifier accepts every event.
+func newVerifier(options *SignatureOptions) *verifier {
+	if options == nil {
+		return nil
+	}
+
+	return &verifier{options: *options}
+}
+
+// accept verifies and counts the event, it returns whether the event is delivered.
+func (v *verifier) accept(ctx context.Context, event *eventhub.Event) bool {
+	if v == nil {
+		return true
+	}
+
+	err := v.verify(event)
+	switch {
+	case err == nil:
+		atomic.AddInt64(&v.verified, 1)
+		return true
+	case errors.Is(err, ErrUnsignedEvent):
+		atomic.AddInt64(&v.unsigned, 1)
+	default:
+		atomic.AddInt64(&v.invalid, 1)
+	}
+
+	if v.options.Audit {
+		return true
+	}
+	if v.options.OnReject != nil {
+		v.options.OnReject(ctx, event, err)
+	}
+
+	return false
+}
+
+func (v *verifier) verify(event *eventhub.Event) error {
+	signature, _ := event.Properties[SignatureProperty].(string)
+	if signature == "" {
+		return ErrUnsignedEvent
+	}
+
+	keyID, _ := event.Properties[SignatureKeyIDProperty].(string)
+	secret, ok := v.options.Keys[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, keyID)
+	}
+
+	decoded, err := b64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	names, _ := event.Properties[SignedPropertiesProperty].(string)
+	var properties []string
+	if names != "" {
+		properties = strings.Split(names, ",")
+	}
+
+	input, err := signatureInput(event, keyID, names, properties)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(input)
+	if !hmac.Equal(mac.Sum(nil), decoded) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signatureInput returns the bytes covered by the signature, as the sender computes them: the key id, the names of
+// the signed properties, the body and the signed properties, each of them prefixed with its length. A signed property
+// is a tag followed by its value: 0 when it is missing, 1 and the length prefixed utf-8 bytes for a string, 2 and 8 big
+// endian bytes for a signed integer, 3 and 8 big endian bytes for an unsigned integer. The other types are refused.
+func signatureInput(event *eventhub.Event, keyID string, names string, properties []string) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	write := func(value []byte) {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(value)))
+		buffer.Write(size[:])
+		buffer.Write(value)
+	}
+	writeInteger := func(tag byte, value uint64) {
+		var integer [8]byte
+		binary.BigEndian.PutUint64(integer[:], value)
+		buffer.WriteByte(tag)
+		buffer.Write(integer[:])
+	}
+
+	write([]byte(keyID))
+	write([]byte(names))
+	write(event.Data)
+	for _, name := range properties {
+		write([]byte(name))
+
+		value, ok := event.Properties[name]
+		if !ok {
+			buffer.WriteByte(0)
+			continue
+		}
+
+		switch value := value.(type) {
+		case string:
+			buffer.WriteByte(1)
+			write([]byte(value))
+		case int:
+			writeInteger(2, uint64(value))
+		case int8:
+			writeInteger(2, uint64(value))
+		case int16:
+			writeInteger(2, uint64(value))
+		case int32:
+			writeInteger(2, uint64(value))
+		case int64:
+			writeInteger(2, uint64(value))
+		case uint:
+			writeInteger(3, uint64(value))
+		case uint8:
+			writeInteger(3, uint64(value))
+		case uint16:
+			writeInteger(3, uint64(value))
+		case uint32:
+			writeInteger(3, uint64(value))
+		case uint64:
+			writeInteger(3, value)
+		default:
+			return nil, fmt.Errorf("signed property %q is a %T, only strings and integers can be signed", name, value)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,125 @@
+package receiver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"testing"
+	"time"
+)
+
+var signingKeys = map[string][]byte{
+	"s1": []byte("0123456789abcdef0123456789abcdef"),
+	"s2": []byte("fedcba9876543210fedcba9876543210"),
+}
+
+// signedEvent signs the event as the sender does, with the tenant property.
+func signedEvent(keyID string, secret []byte, message string) *eventhub.Event {
+	event := eventhub.NewEventFromString(message)
+	event.Set("tenant", "contoso")
+
+	input, _ := signatureInput(event, keyID, "tenant", []string{"tenant"})
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(input)
+	event.Set(SignatureKeyIDProperty, keyID)
+	event.Set(SignedPropertiesProperty, "tenant")
+	event.Set(SignatureProperty, b64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return event
+}
+
+func receiveAll(t *testing.T, options SignatureOptions, events []*eventhub.Event) (*Receiver, int) {
+	var delivered int
+	receiver, _ := NewReceiverBuilder().SetConnectionString("endpoint://...").
+		SetSignatureVerification(options).
+		SetReceiverHandler(func(ctx context.Context, event *eventhub.Event) error {
+			delivered++
+			return nil
+		}).GetReceiver()
+
+	for _, event := range events {
+		if err := receiver.onReceive(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return receiver, delivered
+}
+
+func testEvents() []*eventhub.Event {
+	tampered := signedEvent("s1", signingKeys["s1"], "message")
+	tampered.Set("tenant", "fabrikam")
+
+	return []*eventhub.Event{
+		signedEvent("s1", signingKeys["s1"], "message"),
+		signedEvent("s2", signingKeys["s2"], "message"),
+		tampered,
+		signedEvent("s3", []byte("0123456789abcdef"), "message"),
+		eventhub.NewEventFromString("message"),
+	}
+}
+
+func TestReceiver_Signature_Rejects(t *testing.T) {
+	var reasons []error
+	receiver, delivered := receiveAll(t, SignatureOptions{
+		Keys: signingKeys,
+		OnReject: func(ctx context.Context, event *eventhub.Event, reason error) {
+			reasons = append(reasons, reason)
+		},
+	}, testEvents())
+
+	if delivered != 2 {
+		t.Errorf("expected the 2 valid events delivered but got %d", delivered)
+	}
+	if len(reasons) != 3 || !errors.Is(reasons[0], ErrInvalidSignature) || !errors.Is(reasons[1], ErrInvalidSignature) ||
+		!errors.Is(reasons[2], ErrUnsignedEvent) {
+		t.Errorf("unexpected rejections %v", reasons)
+	}
+	if stats := receiver.SignatureStats(); stats != (SignatureStats{Verified: 2, Unsigned: 1, Invalid: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReceiver_Signature_Audit_Mode(t *testing.T) {
+	var rejected int
+	receiver, delivered := receiveAll(t, SignatureOptions{
+		Keys:     signingKeys,
+		OnReject: func(ctx context.Context, event *eventhub.Event, reason error) { rejected++ },
+		Audit:    true,
+	}, testEvents())
+
+	if delivered != 5 || rejected != 0 {
+		t.Errorf("audit mode should deliver every event, delivered %d and rejected %d", delivered, rejected)
+	}
+	if stats := receiver.SignatureStats(); stats != (SignatureStats{Verified: 2, Unsigned: 1, Invalid: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReceiver_Signature_Known_Answer(t *testing.T) {
+	// signed by the sender, the sender test checks the same value
+	event := eventhub.NewEventFromString("message")
+	event.Set("tenant", "contoso")
+	event.Set("sequence", int64(7))
+	event.Set(SignatureKeyIDProperty, "s1")
+	event.Set(SignedPropertiesProperty, "missing,sequence,tenant")
+	event.Set(SignatureProperty, "Lk2RYSIeOb62L2WzWFLgiVcr76Q/jzNJrRQEi9vwf+o=")
+
+	verifier := newVerifier(&SignatureOptions{Keys: signingKeys})
+	if err := verifier.verify(event); err != nil {
+		t.Errorf("the signature of the sender should be valid: %v", err)
+	}
+
+	event.Set("sequence", "7")
+	if err := verifier.verify(event); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("a string should not be signed as the integer, got %v", err)
+	}
+
+	event.Set("sequence", time.Unix(7, 0))
+	if err := verifier.verify(event); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for a signed property of another type but got %v", err)
+	}
+}
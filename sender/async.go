@@ -0,0 +1,323 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAsyncLinger     = 5 * time.Millisecond
+	defaultAsyncBufferSize = 100000
+)
+
+// ErrAsyncBufferFull is returned by Produce when the buffer of the AsyncSender is full, the event is not sent.
+var ErrAsyncBufferFull = errors.New("async sender buffer is full")
+
+type (
+	// AsyncOptions configures an AsyncSender, every field is optional.
+	AsyncOptions struct {
+		Linger         time.Duration               // max time an open batch waits for more events, default 5ms
+		MaxInFlight    int                         // max batches being sent at once, default the number of workers of the sender
+		BufferSize     int                         // max events buffered before Produce returns ErrAsyncBufferFull, default 100000
+		OnDelivery     func(report DeliveryReport) // called once per event, sent or failed
+		DeliveryBuffer int                         // when above 0, the reports are also written to Deliveries(), which must be read
+	}
+
+	// DeliveryReport is the outcome of an event given to Produce, Err is nil when the event was sent or, with Queued,
+	// kept in the outbox of the sender to be sent later by its drainer.
+	DeliveryReport struct {
+		Event  *eventhub.Event
+		Err    error
+		Queued bool
+	}
+
+	// AsyncSender buffers the events given to Produce and sends them in batches from background go routines. A batch
+	// is sent when it is full or when its first event has waited for the linger time.
+	AsyncSender struct {
+		sender     *Sender
+		options    AsyncOptions
+		session    *sendSession
+		input      chan *eventhub.Event
+		flush      chan struct{}
+		batches    chan []*eventhub.Event
+		deliveries chan DeliveryReport
+		ctx        context.Context
+		cancel     context.CancelFunc
+		done       sync.WaitGroup
+		mutex      sync.Mutex
+		closed     bool
+		pending    int64
+		changed    chan struct{} // closed, and replaced, on every delivery
+		index      int64
+	}
+)
+
+// NewAsyncSender(options AsyncOptions) returns a producer which sends the events in background, the sender connection
+// and its settings (workers, rate limit, outbox, handlers...) are shared. Close it before closing the sender.
+func (sender *Sender) NewAsyncSender(options AsyncOptions) (*AsyncSender, error) {
+	if options.Linger <= 0 {
+		options.Linger = defaultAsyncLinger
+	}
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = sender.workerCount()
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = defaultAsyncBufferSize
+	}
+
+	session, err := sender.newSession(false)
+	if err != nil {
+		return nil, err
+	}
+
+	async := &AsyncSender{
+		sender:  sender,
+		options: options,
+		session: session,
+		input:   make(chan *eventhub.Event, options.BufferSize),
+		flush:   make(chan struct{}, 1),
+		batches: make(chan []*eventhub.Event),
+		changed: make(chan struct{}),
+	}
+	if options.DeliveryBuffer > 0 {
+		async.deliveries = make(chan DeliveryReport, options.DeliveryBuffer)
+	}
+	async.ctx, async.cancel = context.WithCancel(context.Background())
+
+	async.done.Add(options.MaxInFlight + 1)
+	go async.batch()
+	for j := 0; j < options.MaxInFlight; j++ {
+		go async.work(j)
+	}
+
+	return async, nil
+}
+
+// Produce(event *eventhub.Event) buffers the event and returns immediately, the outcome of the send is given to
+// OnDelivery and to Deliveries(). It returns ErrAsyncBufferFull when the buffer is full and ErrSenderClosed after Close.
+// The interceptors are called before the event is buffered, their error is returned and a dropped event is not
+// reported. A chunked event is buffered, and reported, chunk by chunk. The event is left as it is, the sender stamps
+// and prepares a copy which is the Event of the DeliveryReport.
+func (async *AsyncSender) Produce(event *eventhub.Event) error {
+	if async.sender.hasEventMetadata() || async.sender.preparesEvents() {
+		event = copyEvent(event)
+		async.sender.stampEvent(async.sender.idStrategy, atomic.AddInt64(&async.index, 1)-1, event)
+	}
+
+	events, err := async.sender.prepareEvent(async.ctx, event)
+	if err != nil {
+		return err
+	}
+
+	async.mutex.Lock()
+	defer async.mutex.Unlock()
+
+	if async.closed {
+		return ErrSenderClosed
+	}
+
+	// the chunks of an event are buffered all together or not at all, Produce is the only writer of the buffer
+	if len(async.input)+len(events) > cap(async.input) {
+		return ErrAsyncBufferFull
+	}
+	for _, event := range events {
+		async.input <- event
+		async.pending++
+	}
+
+	return nil
+}
+
+// Deliveries() returns the channel of the delivery reports, nil unless AsyncOptions.DeliveryBuffer is set. It is closed
+// by Close.
+func (async *AsyncSender) Deliveries() <-chan DeliveryReport {
+	return async.deliveries
+}
+
+// Pending() returns the number of events produced and not delivered yet.
+func (async *AsyncSender) Pending() int64 {
+	async.mutex.Lock()
+	defer async.mutex.Unlock()
+
+	return async.pending
+}
+
+// Flush(ctx context.Context) sends the open batch without waiting for the linger time and waits until every event
+// produced so far has been delivered, or ctx is done.
+func (async *AsyncSender) Flush(ctx context.Context) error {
+	for {
+		async.mutex.Lock()
+		pending, changed := async.pending, async.changed
+		async.mutex.Unlock()
+
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case async.flush <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close(ctx context.Context) stops accepting events and waits until the buffered events have been delivered. When ctx
+// is done first, the sends in progress are cancelled and the events left are delivered with the error.
+func (async *AsyncSender) Close(ctx context.Context) error {
+	async.mutex.Lock()
+	if async.closed {
+		async.mutex.Unlock()
+		return nil
+	}
+	async.closed = true
+	close(async.input)
+	async.mutex.Unlock()
+
+	err := async.Flush(ctx)
+	async.cancel()
+	async.done.Wait()
+
+	async.session.close()
+	if async.deliveries != nil {
+		close(async.deliveries)
+	}
+
+	return err
+}
+
+// batch packs the buffered events and hands the batches to the workers, it closes a batch when the next event does
+// not fit, when the linger time of its first event has elapsed or on Flush.
+func (async *AsyncSender) batch() {
+	defer async.done.Done()
+	defer close(async.batches)
+
+	var timer *time.Timer
+	var linger <-chan time.Time
+	stopLinger := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, linger = nil, nil
+		}
+	}
+	publish := func(batch *packedBatch) {
+		if batch != nil {
+			async.batches <- batch.events
+		}
+	}
+
+	packer := newBatchPacker(eventhub.DefaultMaxMessageSizeInBytes)
+	add := func(event *eventhub.Event) {
+		batch, err := packer.add(event)
+		if batch != nil {
+			stopLinger()
+			publish(batch)
+		}
+		if err != nil {
+			async.deliver(event, err)
+		}
+		if timer == nil && len(packer.events) > 0 {
+			timer = time.NewTimer(async.options.Linger)
+			linger = timer.C
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-async.input:
+			if !ok {
+				stopLinger()
+				publish(packer.flush())
+				return
+			}
+			add(event)
+		case <-linger:
+			timer, linger = nil, nil
+			publish(packer.flush())
+		case <-async.flush:
+			// the events produced before Flush may still be in the buffer
+			for buffered := len(async.input); buffered > 0; buffered-- {
+				event, ok := <-async.input
+				if !ok {
+					break
+				}
+				add(event)
+			}
+			stopLinger()
+			publish(packer.flush())
+		}
+	}
+}
+
+func (async *AsyncSender) work(workerIndex int) {
+	defer async.done.Done()
+
+	sender := async.sender
+	for events := range async.batches {
+		if sender.onBeforeSendBatchMessage != nil {
+			sender.handlerMutex.Lock()
+			sender.onBeforeSendBatchMessage(len(events), workerIndex)
+			sender.handlerMutex.Unlock()
+		}
+
+		queued, sent, err := async.session.sendBatch(async.ctx, workerIndex, events)
+		if sent > 0 && sender.onAfterSendBatchMessage != nil {
+			sender.handlerMutex.Lock()
+			sender.onAfterSendBatchMessage(sent, workerIndex)
+			sender.handlerMutex.Unlock()
+		}
+
+		// the events before the failed chunk were sent or queued, only the next ones failed
+		done := sent + len(queued)
+		inOutbox := make(map[*eventhub.Event]bool, len(queued))
+		for _, event := range queued {
+			inOutbox[event] = true
+		}
+		for i, event := range events {
+			switch {
+			case inOutbox[event]:
+				async.deliverQueued(event)
+			case i < done:
+				async.deliver(event, nil)
+			default:
+				async.deliver(event, err)
+			}
+		}
+	}
+}
+
+// deliver reports the outcome of an event and releases its place in the pending count.
+func (async *AsyncSender) deliver(event *eventhub.Event, err error) {
+	async.report(DeliveryReport{Event: event, Err: err})
+}
+
+// deliverQueued reports an event kept in the outbox, it is no longer pending for the AsyncSender.
+func (async *AsyncSender) deliverQueued(event *eventhub.Event) {
+	async.report(DeliveryReport{Event: event, Queued: true})
+}
+
+func (async *AsyncSender) report(report DeliveryReport) {
+	if async.options.OnDelivery != nil {
+		async.sender.handlerMutex.Lock()
+		async.options.OnDelivery(report)
+		async.sender.handlerMutex.Unlock()
+	}
+	if async.deliveries != nil {
+		async.deliveries <- report
+	}
+
+	async.mutex.Lock()
+	async.pending--
+	close(async.changed)
+	async.changed = make(chan struct{})
+	async.mutex.Unlock()
+}
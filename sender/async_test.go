@@ -0,0 +1,170 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAsyncSender_Produce_And_Flush(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+
+	var delivered, failed int
+	async, err := sender.NewAsyncSender(AsyncOptions{
+		Linger:      time.Hour, // only Flush sends the last batch
+		MaxInFlight: 4,
+		OnDelivery: func(report DeliveryReport) {
+			delivered++
+			if report.Err != nil {
+				failed++
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := async.Produce(eventhub.NewEvent([]byte("event " + strconv.Itoa(i)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := async.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 1000 || delivered != 1000 || failed != 0 || async.Pending() != 0 {
+		t.Errorf("expected 1000 events sent and delivered, sent %d delivered %d failed %d", hub.sent(), delivered,
+			failed)
+	}
+
+	if err := async.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.Produce(eventhub.NewEvent([]byte("late"))); err != ErrSenderClosed {
+		t.Errorf("expected ErrSenderClosed but got %v", err)
+	}
+}
+
+func TestAsyncSender_Linger(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+
+	async, err := sender.NewAsyncSender(AsyncOptions{Linger: 20 * time.Millisecond, DeliveryBuffer: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer async.Close(context.Background())
+
+	start := time.Now()
+	async.Produce(eventhub.NewEvent([]byte("alone")))
+
+	select {
+	case report := <-async.Deliveries():
+		if report.Err != nil || string(report.Event.Data) != "alone" {
+			t.Errorf("unexpected report %+v", report)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("the batch should wait for the linger time, sent after %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event should be sent once the linger time has elapsed")
+	}
+}
+
+func TestAsyncSender_Reports_Failures(t *testing.T) {
+	hub := &fakeHub{sendErr: errors.New("unauthorized")}
+	sender, _ := newFakeSender(hub)
+
+	async, err := sender.NewAsyncSender(AsyncOptions{DeliveryBuffer: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		async.Produce(eventhub.NewEvent([]byte("event")))
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed int
+	for report := range async.Deliveries() {
+		if report.Err != nil {
+			failed++
+		}
+	}
+	if failed != 10 {
+		t.Errorf("expected 10 failed deliveries but got %d", failed)
+	}
+}
+
+func TestAsyncSender_Buffer_Full_And_Close_Timeout(t *testing.T) {
+	hub := &fakeHub{gate: make(chan struct{})}
+	sender, _ := newFakeSender(hub)
+
+	async, err := sender.NewAsyncSender(AsyncOptions{BufferSize: 1, MaxInFlight: 1, Linger: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var full bool
+	for i := 0; i < 1000 && !full; i++ {
+		if err := async.Produce(eventhub.NewEvent([]byte("event"))); err == ErrAsyncBufferFull {
+			full = true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !full {
+		t.Error("expected ErrAsyncBufferFull while the hub blocks")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := async.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the close to time out but got %v", err)
+	}
+	if async.Pending() != 0 {
+		t.Errorf("every event should be delivered, even with an error, %d pending", async.Pending())
+	}
+}
+
+func TestAsyncSender_Rate_Limited_Partial_Batch(t *testing.T) {
+	hub := &batchLimitHub{fakeHub: &fakeHub{}, limit: 1}
+	sender, _ := newFakeSender(hub.fakeHub)
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+	sender.rateLimit = RateLimit{EventsPerSecond: ConstantRate(100)} // chunks of 10 events
+
+	var sent, batches int
+	sender.onAfterSendBatchMessage = func(batchSizeSent int, workerIndex int) { batches += batchSizeSent }
+	async, err := sender.NewAsyncSender(AsyncOptions{Linger: time.Hour, DeliveryBuffer: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		async.Produce(eventhub.NewEvent([]byte("event")))
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed int
+	for report := range async.Deliveries() {
+		if report.Err == nil {
+			sent++
+		} else {
+			failed++
+		}
+	}
+	if sent != 10 || failed != 20 || batches != 10 || hub.sent() != 10 {
+		t.Errorf("the events of the sent chunk should be delivered, got %d sent, %d failed, %d in the batch handler "+
+			"and %d received", sent, failed, batches, hub.sent())
+	}
+}
@@ -0,0 +1,301 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/linkedin/goavro/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// AvroContentType is the content-type property of the events created by an AvroCodec.
+	AvroContentType = "avro/binary"
+
+	// avroMagicByte starts every payload, it is followed by the schema id as a big endian uint32.
+	avroMagicByte   = 0
+	avroHeaderSize  = 5
+	registryContent = "application/vnd.schemaregistry.v1+json"
+)
+
+type (
+	// SchemaRegistry stores the Avro schemas and gives every schema an id, the id is written before the payload.
+	SchemaRegistry interface {
+		// Register(ctx context.Context, subject string, schema string) registers the schema under the subject and
+		// returns its id, registering the same schema again returns the same id.
+		Register(ctx context.Context, subject string, schema string) (int, error)
+		// Schema(ctx context.Context, id int) returns the schema registered with the id.
+		Schema(ctx context.Context, id int) (string, error)
+	}
+
+	// httpSchemaRegistry is a client of a registry speaking the Confluent schema registry REST API.
+	httpSchemaRegistry struct {
+		baseURL string
+		client  *http.Client
+	}
+
+	// LocalSchemaRegistry is an in memory SchemaRegistry, it also serves the REST API of NewHTTPSchemaRegistry so it
+	// can stand in for a real registry in tests, see httptest.NewServer.
+	LocalSchemaRegistry struct {
+		mutex    sync.Mutex
+		schemas  []string       // schemas[id-1]
+		ids      map[string]int // schema -> id
+		subjects map[string][]int
+	}
+
+	// AvroCodec encodes values against a registered Avro schema.
+	AvroCodec struct {
+		id    int
+		codec *goavro.Codec
+	}
+
+	registrySchema struct {
+		Schema string `json:"schema"`
+	}
+
+	registryID struct {
+		ID int `json:"id"`
+	}
+
+	registryError struct {
+		ErrorCode int    `json:"error_code"`
+		Message   string `json:"message"`
+	}
+)
+
+// NewHTTPSchemaRegistry(baseURL string, client *http.Client) returns a client of the schema registry at baseURL,
+// compatible with the Confluent schema registry REST API. http.DefaultClient is used when client is nil.
+func NewHTTPSchemaRegistry(baseURL string, client *http.Client) SchemaRegistry {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpSchemaRegistry{baseURL: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+func (registry *httpSchemaRegistry) Register(ctx context.Context, subject string, schema string) (int, error) {
+	body, err := json.Marshal(registrySchema{Schema: schema})
+	if err != nil {
+		return 0, err
+	}
+
+	var response registryID
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := registry.do(ctx, http.MethodPost, path, body, &response); err != nil {
+		return 0, err
+	}
+
+	return response.ID, nil
+}
+
+func (registry *httpSchemaRegistry) Schema(ctx context.Context, id int) (string, error) {
+	var response registrySchema
+	if err := registry.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &response); err != nil {
+		return "", err
+	}
+
+	return response.Schema, nil
+}
+
+func (registry *httpSchemaRegistry) do(ctx context.Context, method string, path string, body []byte, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, registry.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", registryContent)
+	if body != nil {
+		request.Header.Set("Content-Type", registryContent)
+	}
+
+	response, err := registry.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		var registryErr registryError
+		if json.Unmarshal(content, &registryErr) == nil && registryErr.Message != "" {
+			return fmt.Errorf("schema registry: %s %s: %d %s", method, path, registryErr.ErrorCode, registryErr.Message)
+		}
+		return fmt.Errorf("schema registry: %s %s: %s", method, path, response.Status)
+	}
+
+	if err := json.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("schema registry: invalid response to %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
+
+// NewLocalSchemaRegistry() returns an empty in memory registry.
+func NewLocalSchemaRegistry() *LocalSchemaRegistry {
+	return &LocalSchemaRegistry{ids: make(map[string]int), subjects: make(map[string][]int)}
+}
+
+func (registry *LocalSchemaRegistry) Register(_ context.Context, subject string, schema string) (int, error) {
+	if _, err := goavro.NewCodec(schema); err != nil {
+		return 0, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	id, ok := registry.ids[schema]
+	if !ok {
+		registry.schemas = append(registry.schemas, schema)
+		id = len(registry.schemas)
+		registry.ids[schema] = id
+	}
+
+	for _, version := range registry.subjects[subject] {
+		if version == id {
+			return id, nil
+		}
+	}
+	registry.subjects[subject] = append(registry.subjects[subject], id)
+
+	return id, nil
+}
+
+func (registry *LocalSchemaRegistry) Schema(_ context.Context, id int) (string, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if id < 1 || id > len(registry.schemas) {
+		return "", fmt.Errorf("schema %d not found", id)
+	}
+
+	return registry.schemas[id-1], nil
+}
+
+// ServeHTTP serves POST /subjects/{subject}/versions and GET /schemas/ids/{id}.
+func (registry *LocalSchemaRegistry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", registryContent)
+
+	path := request.URL.EscapedPath()
+	switch {
+	case request.Method == http.MethodPost && strings.HasPrefix(path, "/subjects/") && strings.HasSuffix(path, "/versions"):
+		subject, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(path, "/subjects/"), "/versions"))
+		var body registrySchema
+		if err == nil {
+			err = json.NewDecoder(request.Body).Decode(&body)
+		}
+		if err != nil {
+			writeRegistryError(writer, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+
+		id, err := registry.Register(request.Context(), subject, body.Schema)
+		if err != nil {
+			writeRegistryError(writer, http.StatusUnprocessableEntity, 42201, err.Error())
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(registryID{ID: id})
+
+	case request.Method == http.MethodGet && strings.HasPrefix(path, "/schemas/ids/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/schemas/ids/"))
+		var schema string
+		if err == nil {
+			schema, err = registry.Schema(request.Context(), id)
+		}
+		if err != nil {
+			writeRegistryError(writer, http.StatusNotFound, 40403, "schema not found")
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(registrySchema{Schema: schema})
+
+	default:
+		writeRegistryError(writer, http.StatusNotFound, 404, "not found")
+	}
+}
+
+func writeRegistryError(writer http.ResponseWriter, status int, code int, message string) {
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(registryError{ErrorCode: code, Message: message})
+}
+
+// NewAvroCodec(ctx context.Context, registry SchemaRegistry, subject string, schema string) registers the schema under
+// the subject and returns a codec encoding values against it.
+func NewAvroCodec(ctx context.Context, registry SchemaRegistry, subject string, schema string) (*AvroCodec, error) {
+	codec, err := goavro.NewCodecForStandardJSON(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+
+	id, err := registry.Register(ctx, subject, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvroCodec{id: id, codec: codec}, nil
+}
+
+// SchemaID() returns the id of the schema in the registry.
+func (codec *AvroCodec) SchemaID() int {
+	return codec.id
+}
+
+// Encode(value interface{}) returns the value encoded with the schema, prefixed with a zero byte and the schema id.
+// The value is any Go value marshalling to a JSON document valid against the schema (struct, map...), a union field
+// takes the plain value or null.
+func (codec *AvroCodec) Encode(value interface{}) ([]byte, error) {
+	document, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.codec.NativeFromTextual(document)
+	if err != nil {
+		return nil, fmt.Errorf("value does not match the avro schema: %w", err)
+	}
+
+	return codec.EncodeNative(native)
+}
+
+// EncodeNative(native interface{}) is Encode for a value already in the goavro native form, where union fields are
+// given as map[string]interface{}{"type": value}.
+func (codec *AvroCodec) EncodeNative(native interface{}) ([]byte, error) {
+	buffer := make([]byte, avroHeaderSize, avroHeaderSize+64)
+	buffer[0] = avroMagicByte
+	binary.BigEndian.PutUint32(buffer[1:], uint32(codec.id))
+
+	buffer, err := codec.codec.BinaryFromNative(buffer, native)
+	if err != nil {
+		return nil, fmt.Errorf("value does not match the avro schema: %w", err)
+	}
+
+	return buffer, nil
+}
+
+// Event(value interface{}) returns an event with the encoded value as body and the content-type property set.
+func (codec *AvroCodec) Event(value interface{}) (*eventhub.Event, error) {
+	data, err := codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	event := eventhub.NewEvent(data)
+	event.Set(ContentTypeProperty, AvroContentType)
+
+	return event, nil
+}
@@ -0,0 +1,118 @@
+package sender
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/linkedin/goavro/v2"
+	"net/http/httptest"
+	"testing"
+)
+
+const userSchema = `{
+  "type": "record",
+  "name": "User",
+  "namespace": "test",
+  "fields": [
+    {"name": "name", "type": "string"},
+    {"name": "age", "type": "int"},
+    {"name": "email", "type": ["null", "string"], "default": null},
+    {"name": "tags", "type": {"type": "array", "items": "string"}}
+  ]
+}`
+
+type avroUser struct {
+	Name  string   `json:"name"`
+	Age   int      `json:"age"`
+	Email *string  `json:"email"`
+	Tags  []string `json:"tags"`
+}
+
+func TestAvroCodec_Encode_With_The_Registry_Over_HTTP(t *testing.T) {
+	server := httptest.NewServer(NewLocalSchemaRegistry())
+	defer server.Close()
+
+	ctx := context.Background()
+	registry := NewHTTPSchemaRegistry(server.URL, nil)
+
+	codec, err := NewAvroCodec(ctx, registry, "users-value", userSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewAvroCodec(ctx, registry, "other-value", userSchema)
+	if err != nil || again.SchemaID() != codec.SchemaID() {
+		t.Fatalf("the same schema should keep its id %d, got %d: %v", codec.SchemaID(), again.SchemaID(), err)
+	}
+
+	email := "ada@example.com"
+	event, err := codec.Event(avroUser{Name: "ada", Age: 36, Email: &email, Tags: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Properties[ContentTypeProperty] != AvroContentType {
+		t.Errorf("expected the avro content type but got %v", event.Properties[ContentTypeProperty])
+	}
+
+	data := event.Data
+	if data[0] != 0 || int(binary.BigEndian.Uint32(data[1:5])) != codec.SchemaID() {
+		t.Fatalf("expected the magic byte and schema id %d in % x", codec.SchemaID(), data[:5])
+	}
+
+	schema, err := registry.Schema(ctx, codec.SchemaID())
+	if err != nil || schema != userSchema {
+		t.Fatalf("the registry should return the schema: %v", err)
+	}
+	decoder, _ := goavro.NewCodec(schema)
+	native, _, err := decoder.NativeFromBinary(data[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := native.(map[string]interface{})
+	if user["name"] != "ada" || user["age"] != int32(36) {
+		t.Errorf("unexpected record %v", user)
+	}
+	if union, ok := user["email"].(map[string]interface{}); !ok || union["string"] != email {
+		t.Errorf("unexpected email %v", user["email"])
+	}
+}
+
+func TestAvroCodec_Encode_Null_Union_And_Native(t *testing.T) {
+	codec, err := NewAvroCodec(context.Background(), NewLocalSchemaRegistry(), "users-value", userSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromStruct, err := codec.Encode(avroUser{Name: "bob", Age: 7, Tags: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromNative, err := codec.EncodeNative(map[string]interface{}{
+		"name": "bob", "age": 7, "email": nil, "tags": []interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fromStruct) != string(fromNative) {
+		t.Errorf("expected the same payload, got % x and % x", fromStruct, fromNative)
+	}
+}
+
+func TestAvroCodec_Errors(t *testing.T) {
+	ctx := context.Background()
+	registry := NewLocalSchemaRegistry()
+
+	if _, err := NewAvroCodec(ctx, registry, "users-value", `{"type": "record"}`); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+
+	codec, _ := NewAvroCodec(ctx, registry, "users-value", userSchema)
+	if _, err := codec.Encode(map[string]interface{}{"name": 12}); err == nil {
+		t.Error("expected an error for a value not matching the schema")
+	}
+
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	if _, err := NewHTTPSchemaRegistry(server.URL, nil).Schema(ctx, 99); err == nil {
+		t.Error("expected an error for an unknown schema id")
+	}
+}
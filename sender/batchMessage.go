@@ -8,7 +8,22 @@ import (
 	"sync"
 )
 
-func (sender *Sender) triggerBatches(ctx context.Context, wg *sync.WaitGroup, numGoRoutines int, eventBatches map[int]*List) {
+// triggerBatches starts one go routine per worker and waits for all of them. The first failed batch cancels the
+// other workers, every worker stops at the next batch boundary once ctx is done and none outlives the call.
+func (sender *Sender) triggerBatches(ctx context.Context, session *sendSession, wg *sync.WaitGroup, numGoRoutines int, eventBatches map[int]*List) error {
+	var errOnce sync.Once
+	var sendErr error
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fail := func(err error) {
+		errOnce.Do(func() {
+			sendErr = err
+			cancel()
+		})
+	}
+
 	wg.Add(len(eventBatches)) //the number of the event batches must to be less or equals to numGoRoutines.
 
 	for j := 0; j < numGoRoutines; j++ {
@@ -20,10 +35,12 @@ func (sender *Sender) triggerBatches(ctx context.Context, wg *sync.WaitGroup, nu
 			batchTotalOfMessage := getAmountOfBatchMessages(eventBatches[j])
 			sender.onBeforeSendBatchMessage(batchTotalOfMessage, j)
 		}
-		go sendBatchMessages(sender, eventBatches[j], wg, ctx, j)
+		go sendBatchMessages(sender, session, eventBatches[j], wg, ctx, j, fail)
 	}
 
 	wg.Wait()
+
+	return sendErr
 }
 
 func getAmountOfBatchMessages(list *List) int {
@@ -41,32 +58,38 @@ func getAmountOfBatchMessages(list *List) int {
 	return totalOfMessages
 }
 
-func sendBatchMessages(sender *Sender, eventBatches *List, wg *sync.WaitGroup, ctx context.Context, workerIndex int) {
-	defer func() {
-		wg.Done()
-		<- ctx.Done()
-	}()
+func sendBatchMessages(sender *Sender, session *sendSession, eventBatches *List, wg *sync.WaitGroup, ctx context.Context, workerIndex int, fail func(err error)) {
+	defer wg.Done()
 
 	if eventBatches != nil && eventBatches.Size() > 0 {
 		batchSize := eventBatches.Size()
-		var mutex sync.Mutex
 
 		for i := 0; i < batchSize; i++ {
+			if ctx.Err() != nil {
+				return
+			}
+
 			events, _ := eventBatches.Get(i)
 			runtime.Gosched()
-			_ = sender.eHub.SendBatch(ctx, eventhub.NewEventBatchIterator(events...))
+			queued, _, err := session.sendBatch(ctx, workerIndex, events)
+			if err == ErrMaxDurationElapsed {
+				break
+			} else if err != nil {
+				fail(err)
+				return
+			}
 
-			if sender.onAfterSendBatchMessage != nil {
-				mutex.Lock()
-				sender.onAfterSendBatchMessage(len(events), workerIndex)
-				mutex.Unlock()
+			if sender.onAfterSendBatchMessage != nil && len(queued) < len(events) {
+				sender.handlerMutex.Lock()
+				sender.onAfterSendBatchMessage(len(events) - len(queued), workerIndex)
+				sender.handlerMutex.Unlock()
 			}
 		}
 	}
 }
 
 func createEventBatchCollection(sender *Sender, numGoRoutines int, limit int64, numMessages int64,
-	message string, withSuffix bool) map[int]*List {
+	message string, withSuffix bool, random *randomSource) map[int]*List {
 
 	var result = make(map[int]*List)
 	var numOfBatches = int(math.Round(float64(numMessages / limit)))
@@ -77,7 +100,8 @@ func createEventBatchCollection(sender *Sender, numGoRoutines int, limit int64,
 			if result[j] == nil {
 				result[j] = New()
 			}
-			events := getEventsToBatch(limit, numMessages, message, sender.properties,	sender.base64String, withSuffix)
+			events := getEventsToBatch(limit, numMessages, message, sender.properties,	sender.base64String, withSuffix,
+				random, sender.compression)
 			result[j].Add(events)
 
 			messagesCounter = messagesCounter + int64(len(events))
@@ -85,7 +109,7 @@ func createEventBatchCollection(sender *Sender, numGoRoutines int, limit int64,
 				left := numMessages - messagesCounter
 				if left > 0 {
 					eventsLeft := getEventsToBatch(left, numMessages, message, sender.properties, sender.base64String,
-						withSuffix)
+						withSuffix, random, sender.compression)
 					if eventsLeft != nil {
 						result[len(result) - 1].Add(eventsLeft)
 					}
@@ -101,7 +125,7 @@ func createEventBatchCollection(sender *Sender, numGoRoutines int, limit int64,
 }
 
 func getEventsToBatch(limit int64, numMessages int64, message string, properties []string, base64 bool,
-	withSuffix bool) []*eventhub.Event {
+	withSuffix bool, random *randomSource, compression *compressor) []*eventhub.Event {
 
 	var events []*eventhub.Event
 	var event *eventhub.Event
@@ -109,7 +133,7 @@ func getEventsToBatch(limit int64, numMessages int64, message string, properties
 
 	for d = 0; d < limit; d++ {
 		//any change in the line bellow affect the limit calculation
-		event = createAnEvent(base64, message, withSuffix)
+		event = createAnEvent(base64, message, withSuffix, random, compression)
 		addProperties(event, properties)
 		events = append(events, event)
 
@@ -121,62 +145,80 @@ func getEventsToBatch(limit int64, numMessages int64, message string, properties
 	return events
 }
 
-func createEventBatchCollectionWithEvents(eventsSeed *[]*eventhub.Event, numGoRoutines int, limit int64,
-	numMessages int64) map[int]*List {
+// createEventBatchCollectionWithEvents packs numMessages events, cycling through eventsSeed when numMessages is bigger
+// than the seed, and spreads the batches among the workers.
+func createEventBatchCollectionWithEvents(eventsSeed *[]*eventhub.Event, numGoRoutines int,
+	numMessages int64) (map[int]*List, error) {
 
-	var result = make(map[int]*List)
-	var numOfBatches = int(math.Round(float64(numMessages / limit)))
-	var messagesCounter int64 = 0
-	var offset int64 = 0
+	return createStampedEventBatchCollection(context.Background(), nil, eventsSeed, numGoRoutines, numMessages)
+}
 
-	for i := 0; i <= numOfBatches; i++ {
-		for j := 0; j < numGoRoutines; j++ {
-			if result[j] == nil {
-				result[j] = New()
-			}
+// createStampedEventBatchCollection is createEventBatchCollectionWithEvents stamping the events with the metadata
+// of the sender and preparing them, see prepareEvent. Every stamped or prepared event is a copy, so the repeated
+// events each get their own id and the given events are left as they are.
+func createStampedEventBatchCollection(ctx context.Context, sender *Sender, eventsSeed *[]*eventhub.Event,
+	numGoRoutines int, numMessages int64) (map[int]*List, error) {
 
-			events := getEventsToBatchWithEvents(limit, numMessages, eventsSeed, offset)
-			offset = offset + int64(len(events))
-			if offset >= int64(len(*eventsSeed)) {
-				offset = 0
-			}
-			result[j].Add(events)
+	var size = int64(len(*eventsSeed))
 
-			messagesCounter = messagesCounter + int64(len(events))
-			if messagesCounter + limit >= numMessages {
-				left := numMessages - messagesCounter
-				if left > 0 {
-					eventsLeft := getEventsToBatchWithEvents(left, numMessages, eventsSeed, offset)
-					if eventsLeft != nil {
-						result[len(result) - 1].Add(eventsLeft)
-					}
-				}
+	if size == 0 {
+		return make(map[int]*List), nil
+	}
 
-				return result
-			}
+	next := func(index int64) ([]*eventhub.Event, error) {
+		event := (*eventsSeed)[index%size]
+		if sender == nil || (!sender.hasEventMetadata() && !sender.preparesEvents()) {
+			return []*eventhub.Event{event}, nil
 		}
-		i = i + (numGoRoutines - 1)
+
+		event = copyEvent(event)
+		sender.stampEvent(sender.idStrategy, index, event)
+
+		return sender.prepareEvent(ctx, event)
 	}
 
-	return result
+	return packEventBatchCollection(numGoRoutines, numMessages, next)
 }
 
-func getEventsToBatchWithEvents(limit int64, numMessages int64, eventsSeed *[]*eventhub.Event, index int64) []*eventhub.Event {
-	var events []*eventhub.Event
-	var event *eventhub.Event
-	var d int64
-	var size = int64(len(*eventsSeed))
+// packEventBatchCollection packs the events returned by the numMessages calls of next using their real encoded size,
+// so events of different sizes are supported, and spreads the batches among the workers. next returns the events
+// prepared from a single event: none when it is dropped, several when it is chunked.
+func packEventBatchCollection(numGoRoutines int, numMessages int64,
+	next func(index int64) ([]*eventhub.Event, error)) (map[int]*List, error) {
 
-	for d = index; d < size; d++ {
-		//any change in the line bellow affect the limit calculation
-		event = (*eventsSeed)[d]
-		events = append(events, event)
+	var result = make(map[int]*List)
+	var batchIndex int
+	var i int64
 
-		eventsSize := int64(len(events))
-		if eventsSize == numMessages || eventsSize == limit {
-			break
+	packer := newBatchPacker(eventhub.DefaultMaxMessageSizeInBytes)
+	addBatch := func(batch *packedBatch) {
+		if batch == nil {
+			return
+		}
+
+		worker := batchIndex % numGoRoutines
+		if result[worker] == nil {
+			result[worker] = New()
 		}
+		result[worker].Add(batch.events)
+		batchIndex++
 	}
 
-	return events
-}
\ No newline at end of file
+	for i = 0; i < numMessages; i++ {
+		events, err := next(i)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			batch, err := packer.add(event)
+			addBatch(batch)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	addBatch(packer.flush())
+
+	return result, nil
+}
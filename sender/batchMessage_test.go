@@ -11,7 +11,7 @@ func TestEventBatch_with_100_messages_with_limit_10_return_with_success(t *testi
 	sender.base64String = false
 	sender.properties = []string{"messageId:1234" }
 
-	eventBatches := createEventBatchCollection(sender, 12, 10, 100, message, false)
+	eventBatches := createEventBatchCollection(sender, 12, 10, 100, message, false, sender.random)
 
 	if len(eventBatches) == 9 {
 		for i := 0; i < len(eventBatches); i++ {
@@ -36,8 +36,8 @@ func TestEventBatch_with_100_messages_and_real_limit_return_one_batch_with_100_m
 	sender.base64String = false
 	sender.properties = []string{"messageId:1234" }
 
-	limit, _ := calcBatchLimit(sender, message, false)
-	eventBatches := createEventBatchCollection(sender, runtime.NumCPU(), int64(limit), 100, message, false)
+	limit, _ := calcBatchLimit(sender, message, false, sender.random)
+	eventBatches := createEventBatchCollection(sender, runtime.NumCPU(), int64(limit), 100, message, false, sender.random)
 
 	if len(eventBatches) == 1 {
 		events, _ := eventBatches[0].Get(0)
@@ -57,8 +57,8 @@ func TestEventBatch_with_1million_messages_and_real_limit_success(t *testing.T)
 	sender.base64String = false
 	sender.properties = []string{"messageId:1234" }
 
-	limit, _ := calcBatchLimit(sender, message, false)
-	eventBatches := createEventBatchCollection(sender, runtime.NumCPU(), int64(limit), 1000000, message, false)
+	limit, _ := calcBatchLimit(sender, message, false, sender.random)
+	eventBatches := createEventBatchCollection(sender, runtime.NumCPU(), int64(limit), 1000000, message, false, sender.random)
 
 	if len(eventBatches) == runtime.NumCPU() {
 		var count int
@@ -0,0 +1,100 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cancellingHub cancels the send after a number of batches.
+type cancellingHub struct {
+	*fakeHub
+	after   int32
+	batches int32
+	cancel  context.CancelFunc
+}
+
+func (hub *cancellingHub) SendBatch(ctx context.Context, iterator eventhub.BatchIterator, opts ...eventhub.BatchOption) error {
+	if err := hub.fakeHub.SendBatch(ctx, iterator, opts...); err != nil {
+		return err
+	}
+	if atomic.AddInt32(&hub.batches, 1) == hub.after {
+		hub.cancel()
+	}
+
+	return nil
+}
+
+func TestSender_SendBatchMessage_Does_Not_Leak_Workers(t *testing.T) {
+	sender, _ := newFakeSender(&fakeHub{})
+	sender.numberOfMessages = 1000
+	sender.workers = 8
+
+	before := runtime.NumGoroutine()
+	if err := sender.SendBatchMessage("message", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("the workers should end with the send, %d go routines before and %d after", before, after)
+	}
+}
+
+func TestSender_SendEventsAsBatch_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := &cancellingHub{fakeHub: &fakeHub{}, after: 3, cancel: cancel}
+	sender, _ := newFakeSender(nil)
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+	sender.numberOfMessages = 50
+	sender.workers = 1
+
+	// one event per batch
+	events := []*eventhub.Event{eventhub.NewEvent(make([]byte, 600000))}
+	err := sender.SendEventsAsBatch(ctx, &events)
+
+	var partial *PartialSendError
+	if !errors.As(err, &partial) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled *PartialSendError but got %v", err)
+	}
+	if partial.Sent != 3 || partial.Total != 50 || int64(hub.sent()) != partial.Sent {
+		t.Errorf("expected 3 of 50 events sent, got %d of %d, the hub received %d", partial.Sent, partial.Total,
+			hub.sent())
+	}
+}
+
+func TestSender_SendBatchMessage_Failure_Stops_The_Workers(t *testing.T) {
+	failure := errors.New("quota exceeded")
+	sender, _ := newFakeSender(&fakeHub{sendErr: failure})
+	sender.numberOfMessages = 100
+	sender.workers = 4
+
+	err := sender.SendBatchMessage("message", context.Background())
+
+	var partial *PartialSendError
+	if !errors.As(err, &partial) || !errors.Is(err, failure) || partial.Sent != 0 {
+		t.Errorf("expected a failed *PartialSendError with nothing sent but got %v", err)
+	}
+}
+
+func TestSender_SendMessage_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sender, _ := newFakeSender(&fakeHub{})
+	sender.numberOfMessages = 10
+
+	var partial *PartialSendError
+	if err := sender.SendMessage("message", ctx); !errors.As(err, &partial) || partial.Sent != 0 {
+		t.Errorf("expected a *PartialSendError with nothing sent but got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package sender
+
+import (
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/google/uuid"
+)
+
+const (
+	// ChunkGroupProperty holds the message group id shared by the chunks of an event.
+	ChunkGroupProperty = "chunk-group-id"
+	// ChunkIndexProperty holds the position of the chunk in its group, from 0.
+	ChunkIndexProperty = "chunk-index"
+	// ChunkCountProperty holds the number of chunks of the group.
+	ChunkCountProperty = "chunk-count"
+	// ChunkTotalSizeProperty holds the size of the whole payload, so the receiver can refuse a group early.
+	ChunkTotalSizeProperty = "chunk-total-size"
+
+	// DefaultChunkSize is the size of the chunks unless another one is set, it leaves room for the properties.
+	DefaultChunkSize = 512 * 1024
+	// maxChunkSize keeps a chunk and its properties below the max event size.
+	maxChunkSize = 900 * 1024
+)
+
+// chunker splits the payloads bigger than its size into numbered chunks.
+type chunker struct {
+	size int
+}
+
+// SetChunking(chunkSize int) splits the payloads bigger than chunkSize bytes into chunks sent as separate events, so
+// payloads above the max event size of 1MB can be sent. The chunks of an event share a message group id, carry their
+// index and the number of chunks, and go to the same partition; the receiver reassembles them. 0 uses
+// DefaultChunkSize.
+func (builder *Builder) SetChunking(chunkSize int) ISenderBuilder {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	builder.chunkSize = chunkSize
+
+	return builder
+}
+
+// newChunker returns nil when size is 0, a nil chunker leaves the events whole.
+func newChunker(size int) (*chunker, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	if size > maxChunkSize {
+		return nil, fmt.Errorf("chunk size cannot exceed %d bytes", maxChunkSize)
+	}
+
+	return &chunker{size: size}, nil
+}
+
+// split returns the chunks of the event, or the event itself when it fits in a chunk. Every chunk has the properties,
+// the id and the partition key of the event, the group id is the partition key when the event has none.
+func (c *chunker) split(event *eventhub.Event) []*eventhub.Event {
+	if c == nil || len(event.Data) <= c.size {
+		return []*eventhub.Event{event}
+	}
+
+	group := uuid.New().String()
+	count := (len(event.Data) + c.size - 1) / c.size
+
+	chunks := make([]*eventhub.Event, count)
+	for i := range chunks {
+		end := (i + 1) * c.size
+		if end > len(event.Data) {
+			end = len(event.Data)
+		}
+
+		chunk := copyEvent(event)
+		chunk.Data = event.Data[i*c.size : end]
+		chunk.Set(ChunkGroupProperty, group)
+		chunk.Set(ChunkIndexProperty, int64(i))
+		chunk.Set(ChunkCountProperty, int64(count))
+		chunk.Set(ChunkTotalSizeProperty, int64(len(event.Data)))
+		if chunk.PartitionKey == nil {
+			partitionKey := group
+			chunk.PartitionKey = &partitionKey
+		}
+		chunks[i] = chunk
+	}
+
+	return chunks
+}
@@ -0,0 +1,133 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSender_SendMessage_Chunks_Large_Payloads(t *testing.T) {
+	hub := &fakeHub{}
+	sender, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(1).
+		SetChunking(0).AddProperty("kind:document").GetSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	payload := make([]byte, 5*DefaultChunkSize/2)
+	rand.Read(payload)
+	if err := sender.SendMessage(string(payload), context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 3 {
+		t.Fatalf("expected 3 chunks but got %d", hub.sent())
+	}
+
+	var reassembled []byte
+	group := hub.events[0].Properties[ChunkGroupProperty]
+	for i, chunk := range hub.events {
+		if chunk.Properties[ChunkGroupProperty] != group || chunk.Properties[ChunkIndexProperty] != int64(i) ||
+			chunk.Properties[ChunkCountProperty] != int64(3) ||
+			chunk.Properties[ChunkTotalSizeProperty] != int64(len(payload)) || chunk.Properties["kind"] != "document" {
+			t.Errorf("unexpected properties of chunk %d: %v", i, chunk.Properties)
+		}
+		if chunk.PartitionKey == nil || *chunk.PartitionKey != group {
+			t.Errorf("the chunks should share the group as partition key")
+		}
+		reassembled = append(reassembled, chunk.Data...)
+	}
+	if !bytes.Equal(reassembled, payload) {
+		t.Error("the chunks should hold the payload")
+	}
+}
+
+func TestSender_SendEventsAsBatch_Chunks_Large_Payloads(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.chunking, _ = newChunker(DefaultChunkSize)
+
+	partitionKey := "customer-1"
+	large := eventhub.NewEvent(make([]byte, 5*1024*1024))
+	large.PartitionKey = &partitionKey
+	events := []*eventhub.Event{large, eventhub.NewEventFromString("small")}
+
+	if err := sender.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 11 {
+		t.Fatalf("expected 10 chunks and the small event but got %d events", hub.sent())
+	}
+	for _, event := range hub.events {
+		_, chunked := event.Properties[ChunkGroupProperty]
+		if chunked != (string(event.Data) != "small") {
+			t.Errorf("only the large event should be chunked")
+		}
+		if chunked && *event.PartitionKey != partitionKey {
+			t.Errorf("the chunks should keep the partition key of the event")
+		}
+	}
+	if len(large.Data) != 5*1024*1024 || large.Properties != nil {
+		t.Error("the given event should be left as it is")
+	}
+}
+
+func TestSender_Chunking_Invalid_Size(t *testing.T) {
+	if _, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetChunking(2 * 1024 * 1024).GetSender(); err == nil {
+		t.Error("expected an error for a chunk above the max event size")
+	}
+}
+
+// batchLimitHub stops after the given number of batches, with an error or by cancelling the send.
+type batchLimitHub struct {
+	*fakeHub
+	limit   int32
+	batches int32
+	cancel  context.CancelFunc
+}
+
+func (hub *batchLimitHub) SendBatch(ctx context.Context, iterator eventhub.BatchIterator, opts ...eventhub.BatchOption) error {
+	if atomic.AddInt32(&hub.batches, 1) > hub.limit {
+		return errors.New("server busy")
+	}
+
+	err := hub.fakeHub.SendBatch(ctx, iterator, opts...)
+	if hub.cancel != nil && atomic.LoadInt32(&hub.batches) == hub.limit {
+		hub.cancel()
+	}
+
+	return err
+}
+
+func TestSender_Chunked_Partial_Send_Counts_Messages(t *testing.T) {
+	for _, cancelled := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		hub := &batchLimitHub{fakeHub: &fakeHub{}, limit: 1}
+		if cancelled {
+			hub.cancel = cancel
+		}
+
+		sender, _ := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(10).SetWorkers(1).
+			SetChunking(100 * 1024).GetSender()
+		sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+		err := sender.SendBatchMessage(strings.Repeat("x", 300*1024), ctx)
+		cancel()
+
+		var partial *PartialSendError
+		if !errors.As(err, &partial) {
+			t.Fatalf("expected a partial send but got %v", err)
+		}
+		if partial.Total != 10 || partial.Sent >= 10 || partial.Sent != int64(hub.sent()/3) {
+			t.Errorf("expected the messages of the %d chunks sent out of 10, got %d of %d", hub.sent(), partial.Sent,
+				partial.Total)
+		}
+	}
+}
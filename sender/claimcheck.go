@@ -0,0 +1,207 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ClaimCheckProperty holds the name of the blob with the payload, the body of the reference event is the name too.
+	ClaimCheckProperty = "claim-check"
+	// ClaimCheckSizeProperty holds the size of the payload.
+	ClaimCheckSizeProperty = "claim-check-size"
+	// ClaimCheckDigestProperty holds the hex SHA-256 of the payload, the receiver checks the blob against it.
+	ClaimCheckDigestProperty = "claim-check-sha256"
+
+	// DefaultClaimCheckThreshold is the payload size above which the payloads are stored unless another one is set.
+	DefaultClaimCheckThreshold = 256 * 1024
+)
+
+type (
+	// BlobStore stores the payloads of the claim check, the receiver reads them back from the same store.
+	BlobStore interface {
+		// Put(ctx context.Context, name string, data []byte) stores data under name, the name is new on every call.
+		Put(ctx context.Context, name string, data []byte) error
+	}
+
+	// FileBlobStore stores the payloads as files of a directory, ex: a volume shared with the receivers.
+	FileBlobStore struct {
+		dir string
+	}
+
+	// httpBlobStore uploads the payloads with a PUT per blob, as Azure Blob Storage, Azurite and S3 compatible stores.
+	httpBlobStore struct {
+		container *url.URL
+		headers   map[string]string
+		client    *http.Client
+	}
+
+	// claimChecker replaces the payloads above its threshold by a reference to a blob.
+	claimChecker struct {
+		store     BlobStore
+		threshold int
+	}
+
+	claimCheckOptions struct {
+		store     BlobStore
+		threshold int
+	}
+)
+
+// SetClaimCheck(store BlobStore, threshold int) uploads the payloads bigger than threshold bytes to the store and sends
+// a small reference event instead, with the blob name, the size and the digest of the payload in its properties. The
+// receiver fetches the payload and gives the whole event to the handler. 0 uses DefaultClaimCheckThreshold. The payload
+// is stored after the encryption, the reference event is signed.
+func (builder *Builder) SetClaimCheck(store BlobStore, threshold int) ISenderBuilder {
+	if threshold <= 0 {
+		threshold = DefaultClaimCheckThreshold
+	}
+	builder.claimCheck = &claimCheckOptions{store: store, threshold: threshold}
+
+	return builder
+}
+
+// newClaimChecker returns nil without options, a nil claimChecker leaves the payloads in the events.
+func newClaimChecker(options *claimCheckOptions) (*claimChecker, error) {
+	if options == nil {
+		return nil, nil
+	}
+	if options.store == nil {
+		return nil, errors.New("claim check blob store is missing")
+	}
+
+	return &claimChecker{store: options.store, threshold: options.threshold}, nil
+}
+
+// check uploads the payload of the event when it is above the threshold and replaces it by the blob name.
+func (c *claimChecker) check(ctx context.Context, event *eventhub.Event) error {
+	if c == nil || len(event.Data) <= c.threshold {
+		return nil
+	}
+
+	name := uuid.New().String()
+	if err := c.store.Put(ctx, name, event.Data); err != nil {
+		return fmt.Errorf("cannot store the payload of the claim check: %w", err)
+	}
+
+	digest := sha256.Sum256(event.Data)
+	event.Set(ClaimCheckProperty, name)
+	event.Set(ClaimCheckSizeProperty, int64(len(event.Data)))
+	event.Set(ClaimCheckDigestProperty, hex.EncodeToString(digest[:]))
+	event.Data = []byte(name)
+
+	return nil
+}
+
+// estimate replaces a payload above the threshold by a reference of the same size as the one check would send,
+// nothing is stored.
+func (c *claimChecker) estimate(event *eventhub.Event) {
+	if c == nil || len(event.Data) <= c.threshold {
+		return
+	}
+
+	name := strings.Repeat("0", len(uuid.Nil.String()))
+	event.Set(ClaimCheckProperty, name)
+	event.Set(ClaimCheckSizeProperty, int64(len(event.Data)))
+	event.Set(ClaimCheckDigestProperty, strings.Repeat("0", hex.EncodedLen(sha256.Size)))
+	event.Data = []byte(name)
+}
+
+// NewFileBlobStore(dir string) returns a BlobStore writing the payloads as files of dir, dir is created when missing.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// Put(ctx context.Context, name string, data []byte) writes the file through a temporary file, a receiver never sees
+// a partial payload.
+func (store *FileBlobStore) Put(ctx context.Context, name string, data []byte) error {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid blob name %q", name)
+	}
+
+	file, err := ioutil.TempFile(store.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if err := os.Rename(file.Name(), filepath.Join(store.dir, name)); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return nil
+}
+
+// NewHTTPBlobStore(containerURL string, headers map[string]string, client *http.Client) returns a BlobStore uploading
+// every payload with a PUT to containerURL/name, the query of containerURL (ex: a SAS token) is kept and headers are
+// added to every request (ex: an authorization). It works with Azure Blob Storage, Azurite and the S3 compatible
+// stores, the x-ms-blob-type header required by Azure is ignored by the others. http.DefaultClient is used when client
+// is nil.
+func NewHTTPBlobStore(containerURL string, headers map[string]string, client *http.Client) (BlobStore, error) {
+	container, err := url.Parse(containerURL)
+	if err != nil {
+		return nil, err
+	}
+	if container.Scheme != "http" && container.Scheme != "https" {
+		return nil, fmt.Errorf("invalid blob container url %q", containerURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &httpBlobStore{container: container, headers: headers, client: client}, nil
+}
+
+func (store *httpBlobStore) Put(ctx context.Context, name string, data []byte) error {
+	blobURL := *store.container
+	blobURL.Path = strings.TrimSuffix(blobURL.Path, "/") + "/" + name
+	blobURL.RawPath = ""
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, blobURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	request.Header.Set("x-ms-blob-type", "BlockBlob")
+	for key, value := range store.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := store.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = ioutil.ReadAll(response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("blob store: PUT %s: %s", name, response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSender_SendMessage_Claim_Checks_Large_Payloads(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := &fakeHub{}
+	sender, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(1).
+		SetClaimCheck(store, 1024).AddProperty("kind:document").GetSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	payload := strings.Repeat("large document ", 100)
+	if err := sender.SendMessage(payload, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMessage("small document", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 2 {
+		t.Fatalf("expected 2 events but got %d", hub.sent())
+	}
+
+	reference := hub.events[0]
+	name, _ := reference.Properties[ClaimCheckProperty].(string)
+	digest := sha256.Sum256([]byte(payload))
+	if name == "" || string(reference.Data) != name || reference.Properties["kind"] != "document" ||
+		reference.Properties[ClaimCheckSizeProperty] != int64(len(payload)) ||
+		reference.Properties[ClaimCheckDigestProperty] != hex.EncodeToString(digest[:]) {
+		t.Fatalf("unexpected reference event %q %v", reference.Data, reference.Properties)
+	}
+	if stored, err := ioutil.ReadFile(filepath.Join(dir, "blobs", name)); err != nil || string(stored) != payload {
+		t.Errorf("the payload should be stored as %s: %v", name, err)
+	}
+
+	if string(hub.events[1].Data) != "small document" || hub.events[1].Properties[ClaimCheckProperty] != nil {
+		t.Error("the small payload should stay in the event")
+	}
+}
+
+func TestHTTPBlobStore_Put(t *testing.T) {
+	var mutex sync.Mutex
+	blobs := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("x-ms-blob-type") != "BlockBlob" ||
+			r.URL.Query().Get("sig") != "secret" || r.Header.Get("x-tenant") != "t1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		blobs[r.URL.Path] = data
+		mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	store, err := NewHTTPBlobStore(server.URL+"/devstoreaccount1/payloads/?sv=2020-08-04&sig=secret",
+		map[string]string{"x-tenant": "t1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(context.Background(), "blob-1", []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(blobs["/devstoreaccount1/payloads/blob-1"], []byte("payload")) {
+		t.Errorf("the payload should be uploaded to the container, got %v", blobs)
+	}
+
+	store, _ = NewHTTPBlobStore(server.URL+"/devstoreaccount1/payloads", nil, nil)
+	if err := store.Put(context.Background(), "blob-2", []byte("payload")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the status of the store but got %v", err)
+	}
+
+	if _, err := NewHTTPBlobStore("ftp://host/container", nil, nil); err == nil {
+		t.Error("expected an error for a non http url")
+	}
+}
+
+func TestSender_Claim_Check_Without_Store(t *testing.T) {
+	if _, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetClaimCheck(nil, 0).GetSender(); err == nil {
+		t.Error("expected an error without a blob store")
+	}
+}
+
+type countingStore struct {
+	puts int32
+}
+
+func (store *countingStore) Put(ctx context.Context, name string, data []byte) error {
+	atomic.AddInt32(&store.puts, 1)
+	return nil
+}
+
+type countingKeyProvider struct {
+	*FileKeyProvider
+	wraps int32
+}
+
+func (provider *countingKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	atomic.AddInt32(&provider.wraps, 1)
+	return provider.FileKeyProvider.WrapKey(ctx, keyID, dataKey)
+}
+
+func TestSender_Plan_Does_Not_Store_Nor_Encrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "k1", "k1")
+	fileProvider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingKeyProvider{FileKeyProvider: fileProvider}
+	store := &countingStore{}
+
+	hub := &fakeHub{}
+	sender, _ := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(20).
+		SetEncryption(provider).SetClaimCheck(store, 1024).GetSender()
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	message := strings.Repeat("large document ", 1000)
+	plan, err := sender.Plan(context.Background(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.puts != 0 || provider.wraps != 0 || hub.sent() != 0 {
+		t.Fatalf("the plan should have no side effect, got %d uploads and %d wrapped keys", store.puts, provider.wraps)
+	}
+
+	if err := sender.SendBatchMessage(message, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if store.puts != 20 || provider.wraps != 1 {
+		t.Fatalf("the send should upload 20 payloads with 1 data key, got %d and %d", store.puts, provider.wraps)
+	}
+
+	sent := batchSize(hub.events)
+	if plan.TotalEvents != 20 || plan.TotalBytes < int64(sent)*9/10 || plan.TotalBytes > int64(sent)*11/10 {
+		t.Errorf("the plan should estimate the reference events, planned %d bytes for %d sent", plan.TotalBytes, sent)
+	}
+}
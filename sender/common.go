@@ -4,17 +4,16 @@ import (
 	b64 "encoding/base64"
 	eventhub "github.com/Azure/azure-event-hubs-go/v3"
 	"github.com/google/uuid"
-	"math/rand"
 	"strings"
 )
 
 const mLetterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
-func saltRandString(size int) string {
+func saltRandString(random *randomSource, size int) string {
 	randBytes := make([]byte, size)
 
 	for i := range randBytes {
-		randBytes[i] = mLetterBytes[rand.Intn(52)] //52 is the amount of characters in mLetterBytes
+		randBytes[i] = mLetterBytes[random.Intn(52)] //52 is the amount of characters in mLetterBytes
 	}
 
 	return string(randBytes)
@@ -39,11 +38,12 @@ func addProperties(event *eventhub.Event, properties []string) {
 	}
 }
 
-func createAnEvent(base64 bool, message string, withSuffix bool) *eventhub.Event {
+func createAnEvent(base64 bool, message string, withSuffix bool, random *randomSource,
+	compression *compressor) *eventhub.Event {
 	var event *eventhub.Event
 
 	if withSuffix {
-		message = message + "-" + saltRandString(12)
+		message = message + "-" + saltRandString(random, 12)
 	}
 
 	if base64 {
@@ -56,67 +56,36 @@ func createAnEvent(base64 bool, message string, withSuffix bool) *eventhub.Event
 	} else {
 		event = eventhub.NewEvent([]byte(message))
 	}
+	compression.compress(event)
 
 	return event
 }
 
-func calcBatchLimit(sender *Sender, message string, withSuffix bool) (int, error) {
-	event := createAnEvent(sender.base64String, message, withSuffix)
+func calcBatchLimit(sender *Sender, message string, withSuffix bool, random *randomSource) (int, error) {
+	event := createAnEvent(sender.base64String, message, withSuffix, random, sender.compression)
 	addProperties(event, sender.properties)
 
 	return getBatchLimit(event)
 }
 
-func calcBatchLimitWithEvents(events *[]*eventhub.Event) (int, error) {
-	var biggestSize uint32 = 0
-	var biggestEvent *eventhub.Event
-
-	for _, event := range *events {
-		size, err := getEventSize(event)
-		if err == nil {
-			if size > biggestSize {
-				biggestEvent = event
-				biggestSize = size
-			}
-		}
-	}
-
-	return getBatchLimit(biggestEvent)
-}
-
-func getEventSize(event *eventhub.Event) (uint32, error) {
+// getBatchLimit returns how many copies of the event fit in a batch message, an *EventTooLargeError when the event
+// does not fit in an empty batch.
+func getBatchLimit(event *eventhub.Event) (int, error) {
 	id := uuid.New()
 	eb := eventhub.NewEventBatch(id.String(), nil)
 	sizeBeforeEvent := eb.Size()
-
-	_, err := eb.Add(event)
-
-	if err == nil {
-		msgSize := uint32(eb.Size() - sizeBeforeEvent)
-		defer func() {
-			eb.Clear()
-			eb = nil
-		}()
-		return msgSize, nil
+	ok, err := eb.Add(event)
+	if err != nil {
+		return 0, err
 	}
 
-	return 0, err
-}
-
-func getBatchLimit(event *eventhub.Event) (int, error) {
-	id := uuid.New()
-	eb := eventhub.NewEventBatch(id.String(), nil)
-	sizeBeforeEvent := eb.Size()
-	_, err := eb.Add(event)
-
-	if err == nil {
-		msgSize := eb.Size() - sizeBeforeEvent
-		defer func() {
-			eb.Clear()
-			eb = nil
-		}()
-		return (int(eb.MaxSize) - 100) / msgSize, nil
+	limit := 0
+	if msgSize := eb.Size() - sizeBeforeEvent; ok && msgSize > 0 {
+		limit = (int(eb.MaxSize) - 100) / msgSize
+	}
+	if limit < 1 {
+		return 0, &EventTooLargeError{Size: encodedSize(event), MaxSize: int(eb.MaxSize)}
 	}
 
-	return 0, err
-}
\ No newline at end of file
+	return limit, nil
+}
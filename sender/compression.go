@@ -0,0 +1,150 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"sync"
+)
+
+// Compression is the algorithm used to compress the event payloads.
+type Compression int
+
+const (
+	// NoCompression sends the payloads as they are, it is the default.
+	NoCompression Compression = iota
+	// Gzip compresses the payloads in the gzip format, levels 1 (fastest) to 9 (best).
+	Gzip
+	// Zlib compresses the payloads in the zlib format, levels 1 (fastest) to 9 (best).
+	Zlib
+	// Zstd compresses the payloads in the zstandard format, levels 1 (fastest) to 22 (best).
+	Zstd
+)
+
+const (
+	// ContentEncodingProperty is the event property holding the encoding of a compressed payload, its values are
+	// the ones used by the http Content-Encoding header: "gzip", "deflate" (zlib format) and "zstd".
+	ContentEncodingProperty = "content-encoding"
+	// DefaultCompressionThreshold is the size, in bytes, under which payloads are sent uncompressed.
+	DefaultCompressionThreshold = 256
+)
+
+// String returns the content encoding of the algorithm.
+func (compression Compression) String() string {
+	switch compression {
+	case NoCompression:
+		return "identity"
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "deflate"
+	case Zstd:
+		return "zstd"
+	}
+
+	return fmt.Sprintf("Compression(%d)", int(compression))
+}
+
+// compressor compresses the payloads of the events created by the sender, it is safe to be used by multiple go
+// routines.
+type compressor struct {
+	algorithm Compression
+	threshold int
+	writers   sync.Pool // *gzip.Writer or *zlib.Writer, they are expensive to allocate
+	zstd      *zstd.Encoder
+}
+
+// newCompressor validates the level, 0 selects the default level of the algorithm. It returns nil without
+// compression.
+func newCompressor(algorithm Compression, level int, threshold int) (*compressor, error) {
+	if algorithm == NoCompression {
+		return nil, nil
+	}
+
+	result := &compressor{algorithm: algorithm, threshold: threshold}
+
+	switch algorithm {
+	case Gzip, Zlib:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		if level != gzip.DefaultCompression && (level < gzip.BestSpeed || level > gzip.BestCompression) {
+			return nil, fmt.Errorf("invalid %s compression level %d, expected 1 to 9", algorithm, level)
+		}
+		result.writers.New = func() interface{} {
+			var writer io.WriteCloser
+			if algorithm == Gzip {
+				writer, _ = gzip.NewWriterLevel(nil, level)
+			} else {
+				writer, _ = zlib.NewWriterLevel(nil, level)
+			}
+			return writer
+		}
+	case Zstd:
+		options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			if level < 1 || level > 22 {
+				return nil, fmt.Errorf("invalid zstd compression level %d, expected 1 to 22", level)
+			}
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		encoder, err := zstd.NewWriter(nil, options...)
+		if err != nil {
+			return nil, err
+		}
+		result.zstd = encoder
+	default:
+		return nil, fmt.Errorf("unknown compression %d", int(algorithm))
+	}
+
+	return result, nil
+}
+
+// compress replaces the payload of the event by its compressed form and stamps the ContentEncodingProperty.
+// Payloads smaller than the threshold are left untouched, so is an event when compression makes it bigger.
+func (compressor *compressor) compress(event *eventhub.Event) {
+	if compressor == nil || len(event.Data) < compressor.threshold {
+		return
+	}
+
+	var compressed []byte
+	if compressor.algorithm == Zstd {
+		compressed = compressor.zstd.EncodeAll(event.Data, make([]byte, 0, len(event.Data)/2))
+	} else {
+		compressed = compressor.deflate(event.Data)
+	}
+
+	if len(compressed) >= len(event.Data) {
+		return
+	}
+
+	event.Data = compressed
+	if event.Properties == nil {
+		event.Properties = make(map[string]interface{})
+	}
+	event.Properties[ContentEncodingProperty] = compressor.algorithm.String()
+}
+
+func (compressor *compressor) deflate(data []byte) []byte {
+	var buffer bytes.Buffer
+
+	writer := compressor.writers.Get().(io.WriteCloser)
+	defer compressor.writers.Put(writer)
+
+	switch w := writer.(type) {
+	case *gzip.Writer:
+		w.Reset(&buffer)
+	case *zlib.Writer:
+		w.Reset(&buffer)
+	}
+
+	// writing to a bytes.Buffer never fails
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,119 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func decompress(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+
+	var result []byte
+	var err error
+
+	switch encoding {
+	case "gzip":
+		reader, e := gzip.NewReader(bytes.NewReader(data))
+		if e != nil {
+			t.Fatal(e)
+		}
+		result, err = ioutil.ReadAll(reader)
+	case "deflate":
+		reader, e := zlib.NewReader(bytes.NewReader(data))
+		if e != nil {
+			t.Fatal(e)
+		}
+		result, err = ioutil.ReadAll(reader)
+	case "zstd":
+		decoder, e := zstd.NewReader(nil)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer decoder.Close()
+		result, err = decoder.DecodeAll(data, nil)
+	default:
+		t.Fatalf("unexpected encoding %q", encoding)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(result)
+}
+
+func TestCompressor_RoundTrip(t *testing.T) {
+	message := strings.Repeat(`{"device": "sensor-1", "temperature": 21.5}`, 50)
+
+	for _, algorithm := range []Compression{Gzip, Zlib, Zstd} {
+		compression, err := newCompressor(algorithm, 0, DefaultCompressionThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event := createAnEvent(false, message, false, nil, compression)
+		if len(event.Data) >= len(message) {
+			t.Errorf("%s: payload was not compressed, %d bytes", algorithm, len(event.Data))
+		}
+
+		encoding, _ := event.Properties[ContentEncodingProperty].(string)
+		if encoding != algorithm.String() {
+			t.Errorf("%s: expected content-encoding %q, got %q", algorithm, algorithm.String(), encoding)
+		}
+
+		if decompressed := decompress(t, encoding, event.Data); decompressed != message {
+			t.Errorf("%s: decompressed payload differs from the message", algorithm)
+		}
+	}
+}
+
+func TestCompressor_Threshold(t *testing.T) {
+	compression, _ := newCompressor(Gzip, 9, 100)
+
+	event := createAnEvent(false, "tiny message", false, nil, compression)
+	if string(event.Data) != "tiny message" {
+		t.Errorf("expected the payload under the threshold to be sent as is, got %q", event.Data)
+	}
+	if _, ok := event.Properties[ContentEncodingProperty]; ok {
+		t.Error("expected no content-encoding on an uncompressed payload")
+	}
+}
+
+func TestCompressor_InvalidLevel(t *testing.T) {
+	builder := NewSenderBuilder()
+	builder.SetConnectionString("Endpoint=sb://localhost/;EntityPath=hub")
+	builder.SetCompression(Gzip, 12)
+
+	if _, err := builder.GetSender(); err == nil {
+		t.Error("expected an error for an invalid gzip level")
+	}
+
+	builder.SetCompression(Zstd, 3)
+	if _, err := builder.GetSender(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCalcBatchLimit_Compressed(t *testing.T) {
+	message := strings.Repeat("compressible telemetry ", 200)
+	compression, _ := newCompressor(Zstd, 0, DefaultCompressionThreshold)
+
+	plain, err := calcBatchLimit(&Sender{}, message, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := calcBatchLimit(&Sender{compression: compression}, message, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if compressed <= plain*10 {
+		t.Errorf("expected the batch limit to account for the compressed size, plain %d compressed %d", plain,
+			compressed)
+	}
+}
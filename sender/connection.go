@@ -0,0 +1,67 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// ErrSenderClosed is returned by every send operation issued after Close has been called.
+var ErrSenderClosed = errors.New("sender is closed")
+
+// hubClient is the subset of *eventhub.Hub used by the sender. It allows the connection to be replaced in tests.
+type hubClient interface {
+	Send(ctx context.Context, event *eventhub.Event, opts ...eventhub.SendOption) error
+	SendBatch(ctx context.Context, iterator eventhub.BatchIterator, opts ...eventhub.BatchOption) error
+	Close(ctx context.Context) error
+}
+
+func newHubFromConnectionString(connStr string) (hubClient, error) {
+	return eventhub.NewHubFromConnectionString(connStr)
+}
+
+// hub returns the connected hub, creating it on first use. The same hub (and its AMQP link) is shared by every
+// send issued through this sender until Close is called.
+func (sender *Sender) hub() (hubClient, error) {
+	sender.connMutex.Lock()
+	defer sender.connMutex.Unlock()
+
+	if sender.closed {
+		return nil, ErrSenderClosed
+	}
+
+	if sender.eHub == nil {
+		newHub := sender.newHub
+		if newHub == nil {
+			newHub = newHubFromConnectionString
+		}
+
+		hub, err := newHub(sender.connString)
+		if err != nil {
+			return nil, err
+		}
+		sender.eHub = hub
+	}
+
+	return sender.eHub, nil
+}
+
+// Close(ctx context.Context) closes the connection to event hubs. After Close any send returns ErrSenderClosed.
+// The events left in the outbox stay on disk, they are sent by the next sender using the same outbox directory.
+// It is safe to call Close more than once.
+func (sender *Sender) Close(ctx context.Context) error {
+	sender.outbox.stop()
+
+	sender.connMutex.Lock()
+	defer sender.connMutex.Unlock()
+
+	sender.closed = true
+	if sender.eHub == nil {
+		return nil
+	}
+
+	hub := sender.eHub
+	sender.eHub = nil
+
+	return hub.Close(ctx)
+}
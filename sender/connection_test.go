@@ -0,0 +1,224 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeHub is an in memory hubClient. attachDelay simulates the cost of opening the AMQP link on the first send.
+type fakeHub struct {
+	mutex       sync.Mutex
+	attachDelay time.Duration
+	attached    bool
+	closed      bool
+	events      []*eventhub.Event
+	batches     int
+	sendErr     error
+	gate        chan struct{} // when set, every SendBatch waits until the gate is closed
+}
+
+func (hub *fakeHub) attach() error {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		return errors.New("hub is closed")
+	}
+	if !hub.attached {
+		time.Sleep(hub.attachDelay)
+		hub.attached = true
+	}
+
+	return hub.sendErr
+}
+
+func (hub *fakeHub) Send(ctx context.Context, event *eventhub.Event, opts ...eventhub.SendOption) error {
+	if err := hub.attach(); err != nil {
+		return err
+	}
+
+	hub.mutex.Lock()
+	hub.events = append(hub.events, event)
+	hub.mutex.Unlock()
+
+	return nil
+}
+
+func (hub *fakeHub) SendBatch(ctx context.Context, iterator eventhub.BatchIterator, opts ...eventhub.BatchOption) error {
+	if err := hub.attach(); err != nil {
+		return err
+	}
+
+	if hub.gate != nil {
+		select {
+		case <-hub.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	ebi := iterator.(*eventhub.EventBatchIterator)
+	hub.mutex.Lock()
+	for key, events := range ebi.PartitionEventsMap {
+		hub.events = append(hub.events, events...)
+		ebi.Cursors[key] = len(events)
+	}
+	hub.batches++
+	hub.mutex.Unlock()
+
+	return nil
+}
+
+func (hub *fakeHub) Close(ctx context.Context) error {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.closed = true
+	hub.attached = false
+
+	return nil
+}
+
+func (hub *fakeHub) sent() int {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return len(hub.events)
+}
+
+func newFakeSender(hub *fakeHub) (*Sender, *int32) {
+	var connections int32
+
+	sender, _ := NewSenderBuilder().SetConnectionString("endpoint://...").GetSender()
+	sender.newHub = func(connStr string) (hubClient, error) {
+		atomic.AddInt32(&connections, 1)
+		return hub, nil
+	}
+
+	return sender, &connections
+}
+
+func TestSender_Connects_Lazily(t *testing.T) {
+	sender, connections := newFakeSender(&fakeHub{})
+
+	if *connections != 0 {
+		t.Error("sender should not connect before the first send")
+	}
+
+	sender.numberOfMessages = 1
+	if err := sender.SendMessage("message", context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if *connections != 1 {
+		t.Errorf("sender should connect once, connected %v times", *connections)
+	}
+}
+
+func TestSender_SendMessage_Reuses_The_Hub(t *testing.T) {
+	hub := &fakeHub{}
+	sender, connections := newFakeSender(hub)
+	sender.numberOfMessages = 10
+
+	if err := sender.SendMessage("message", context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := sender.SendMessage("message", context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if hub.sent() != 20 {
+		t.Errorf("hub should receive 20 events but received %v", hub.sent())
+	}
+	if *connections != 1 || hub.closed {
+		t.Error("hub should be opened once and kept open between sends")
+	}
+}
+
+func TestSender_Close(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 1
+
+	_ = sender.SendMessage("message", context.Background())
+	if err := sender.Close(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !hub.closed {
+		t.Error("hub should be closed")
+	}
+	if err := sender.Close(context.Background()); err != nil {
+		t.Error("closing twice should not fail")
+	}
+	if err := sender.SendMessage("message", context.Background()); err != ErrSenderClosed {
+		t.Errorf("expected ErrSenderClosed but got %v", err)
+	}
+}
+
+func TestSender_Close_Without_Connection(t *testing.T) {
+	sender, connections := newFakeSender(&fakeHub{})
+
+	if err := sender.Close(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if *connections != 0 {
+		t.Error("close should not open a connection")
+	}
+}
+
+func TestSender_Concurrent_Sends(t *testing.T) {
+	hub := &fakeHub{}
+	sender, connections := newFakeSender(hub)
+	sender.numberOfMessages = 5
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sender.SendMessage("message", context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if hub.sent() != 40 {
+		t.Errorf("hub should receive 40 events but received %v", hub.sent())
+	}
+	if *connections != 1 {
+		t.Errorf("concurrent sends should share one connection, connected %v times", *connections)
+	}
+}
+
+func BenchmarkSender_SendMessage_ReusedLink(b *testing.B) {
+	sender, _ := newFakeSender(&fakeHub{attachDelay: time.Millisecond})
+	sender.numberOfMessages = 1
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sender.SendMessage("message", context.Background())
+	}
+	b.StopTimer()
+
+	_ = sender.Close(context.Background())
+}
+
+// BenchmarkSender_SendMessage_LinkPerSend reproduces the previous behaviour, where the hub was closed after each send.
+func BenchmarkSender_SendMessage_LinkPerSend(b *testing.B) {
+	sender, _ := newFakeSender(&fakeHub{attachDelay: time.Millisecond})
+	sender.numberOfMessages = 1
+	sender.newHub = func(connStr string) (hubClient, error) {
+		return &fakeHub{attachDelay: time.Millisecond}, nil
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sender.SendMessage("message", context.Background())
+		_ = sender.Close(context.Background())
+		sender.closed = false
+	}
+}
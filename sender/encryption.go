@@ -0,0 +1,275 @@
+package sender
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const (
+	// EncryptionAlgorithm is the algorithm of the payloads encrypted by the sender, AES-256 in GCM mode.
+	EncryptionAlgorithm = "AES-256-GCM"
+
+	// EncryptionAlgorithmProperty holds the algorithm of an encrypted event.
+	EncryptionAlgorithmProperty = "encryption-algorithm"
+	// EncryptionKeyIDProperty holds the id of the key which wrapped the data key.
+	EncryptionKeyIDProperty = "encryption-key-id"
+	// EncryptionDataKeyProperty holds the data key wrapped by the key provider, in base64.
+	EncryptionDataKeyProperty = "encryption-data-key"
+
+	dataKeySize  = 32
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+	// maxDataKeyUses bounds the events encrypted with a data key, random nonces stay far from collisions.
+	maxDataKeyUses = 1 << 24
+)
+
+type (
+	// KeyProvider wraps the data keys of the envelope encryption with a key encryption key. Several keys can be
+	// active at once, the current one wraps the new data keys, the receiver unwraps them with the key of their id.
+	KeyProvider interface {
+		// CurrentKeyID() returns the id of the key wrapping the new data keys, the sender creates a new data key when
+		// it changes.
+		CurrentKeyID() string
+		// WrapKey(ctx context.Context, keyID string, dataKey []byte) encrypts the data key with the key.
+		WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	}
+
+	// FileKeyProvider is a KeyProvider reading its keys from a JSON file:
+	// {"current": "2024-02", "keys": {"2024-01": "<base64 of 32 bytes>", "2024-02": "<base64 of 32 bytes>"}}
+	// To rotate, add the new key, make it current and call Reload, keep the old keys while their events are read.
+	FileKeyProvider struct {
+		path    string
+		mutex   sync.RWMutex
+		current string
+		keys    map[string]cipher.AEAD
+	}
+
+	keyFile struct {
+		Current string            `json:"current"`
+		Keys    map[string]string `json:"keys"`
+	}
+
+	// encryptor encrypts the payloads with a data key wrapped by the key provider, the data key is replaced when the
+	// current key of the provider changes.
+	encryptor struct {
+		provider KeyProvider
+		mutex    sync.Mutex
+		keyID    string
+		aead     cipher.AEAD
+		wrapped  string
+		uses     int64
+	}
+)
+
+// SetEncryption(provider KeyProvider) encrypts the payload of every event with AES-256-GCM, the data key is wrapped
+// by the provider and travels with the event in its properties, with the key id and the algorithm. The receiver
+// decrypts the events given the same keys.
+func (builder *Builder) SetEncryption(provider KeyProvider) ISenderBuilder {
+	builder.keyProvider = provider
+
+	return builder
+}
+
+// NewFileKeyProvider(path string) returns a KeyProvider with the keys of the file.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	provider := &FileKeyProvider{path: path}
+	if err := provider.Reload(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// Reload() reads the keys of the file again, the keys in use are kept when the file is invalid.
+func (provider *FileKeyProvider) Reload() error {
+	content, err := ioutil.ReadFile(provider.path)
+	if err != nil {
+		return err
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("invalid key file %s: %w", provider.path, err)
+	}
+
+	keys := make(map[string]cipher.AEAD, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := b64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return fmt.Errorf("invalid key file %s: key %q must be 32 bytes in base64", provider.path, id)
+		}
+		if keys[id], err = newGCM(key); err != nil {
+			return err
+		}
+	}
+	if _, ok := keys[file.Current]; !ok {
+		return fmt.Errorf("invalid key file %s: current key %q not found", provider.path, file.Current)
+	}
+
+	provider.mutex.Lock()
+	provider.current, provider.keys = file.Current, keys
+	provider.mutex.Unlock()
+
+	return nil
+}
+
+func (provider *FileKeyProvider) CurrentKeyID() string {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	return provider.current
+}
+
+func (provider *FileKeyProvider) WrapKey(_ context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := provider.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal(aead, dataKey, []byte(keyID))
+}
+
+// UnwrapKey(ctx context.Context, keyID string, wrapped []byte) decrypts a data key wrapped with the key, it makes the
+// provider usable by the receiver as well.
+func (provider *FileKeyProvider) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := provider.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, wrapped, []byte(keyID))
+}
+
+func (provider *FileKeyProvider) key(keyID string) (cipher.AEAD, error) {
+	provider.mutex.RLock()
+	defer provider.mutex.RUnlock()
+
+	aead, ok := provider.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+
+	return aead, nil
+}
+
+// newEncryptor returns nil without key provider, a nil encryptor leaves the events as they are.
+func newEncryptor(provider KeyProvider) *encryptor {
+	if provider == nil {
+		return nil
+	}
+
+	return &encryptor{provider: provider}
+}
+
+// encrypt replaces the payload by nonce | ciphertext | tag and records how to decrypt it in the properties.
+func (enc *encryptor) encrypt(ctx context.Context, event *eventhub.Event) error {
+	if enc == nil {
+		return nil
+	}
+
+	keyID, aead, wrapped, err := enc.dataKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := seal(aead, event.Data, []byte(keyID))
+	if err != nil {
+		return err
+	}
+
+	event.Data = data
+	event.Set(EncryptionAlgorithmProperty, EncryptionAlgorithm)
+	event.Set(EncryptionKeyIDProperty, keyID)
+	event.Set(EncryptionDataKeyProperty, wrapped)
+
+	return nil
+}
+
+// estimate gives the event the size and the properties it would have once encrypted, without creating nor wrapping a
+// data key. The wrapped key is assumed to be as long as one wrapped by a FileKeyProvider when none was wrapped yet.
+func (enc *encryptor) estimate(event *eventhub.Event) {
+	if enc == nil {
+		return
+	}
+
+	enc.mutex.Lock()
+	wrapped := enc.wrapped
+	enc.mutex.Unlock()
+	if wrapped == "" {
+		wrapped = strings.Repeat("A", b64.StdEncoding.EncodedLen(gcmNonceSize+dataKeySize+gcmTagSize))
+	}
+
+	event.Data = append(event.Data, make([]byte, gcmNonceSize+gcmTagSize)...)
+	event.Set(EncryptionAlgorithmProperty, EncryptionAlgorithm)
+	event.Set(EncryptionKeyIDProperty, enc.provider.CurrentKeyID())
+	event.Set(EncryptionDataKeyProperty, wrapped)
+}
+
+// dataKey returns the data key to use, a new one is created and wrapped on the first call, when the current key of
+// the provider changes and after maxDataKeyUses events.
+func (enc *encryptor) dataKey(ctx context.Context) (string, cipher.AEAD, string, error) {
+	enc.mutex.Lock()
+	defer enc.mutex.Unlock()
+
+	keyID := enc.provider.CurrentKeyID()
+	if enc.aead == nil || enc.keyID != keyID || enc.uses >= maxDataKeyUses {
+		dataKey := make([]byte, dataKeySize)
+		if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+			return "", nil, "", err
+		}
+
+		aead, err := newGCM(dataKey)
+		if err != nil {
+			return "", nil, "", err
+		}
+
+		wrapped, err := enc.provider.WrapKey(ctx, keyID, dataKey)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("cannot wrap the data key with key %q: %w", keyID, err)
+		}
+
+		enc.keyID, enc.aead, enc.wrapped, enc.uses = keyID, aead, b64.StdEncoding.EncodeToString(wrapped), 0
+	}
+	enc.uses++
+
+	return enc.keyID, enc.aead, enc.wrapped, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal returns a random nonce followed by the encrypted plaintext and its tag.
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the output of seal.
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+}
@@ -0,0 +1,136 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"encoding/json"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, path string, current string, ids ...string) {
+	keys := make(map[string]string)
+	for i, id := range ids {
+		keys[id] = b64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+
+	content, _ := json.Marshal(keyFile{Current: current, Keys: keys})
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decryptEvent(t *testing.T, provider *FileKeyProvider, event *eventhub.Event) []byte {
+	keyID := event.Properties[EncryptionKeyIDProperty].(string)
+	wrapped, _ := b64.StdEncoding.DecodeString(event.Properties[EncryptionDataKeyProperty].(string))
+
+	dataKey, err := provider.UnwrapKey(context.Background(), keyID, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, _ := newGCM(dataKey)
+	data, err := open(aead, event.Data, []byte(keyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestSender_Encryption_With_Key_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "k1", "k1")
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := &fakeHub{}
+	sender, _ := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(10).
+		SetEncryption(provider).GetSender()
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	if err := sender.SendBatchMessage("personal data", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key k2 becomes current, k1 stays for the events already sent
+	writeKeyFile(t, path, "k2", "k1", "k2")
+	if err := provider.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMessage("personal data", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 20 {
+		t.Fatalf("expected 20 events but got %d", hub.sent())
+	}
+	for i, event := range hub.events {
+		expectedKey := "k1"
+		if i >= 10 {
+			expectedKey = "k2"
+		}
+		if event.Properties[EncryptionAlgorithmProperty] != EncryptionAlgorithm ||
+			event.Properties[EncryptionKeyIDProperty] != expectedKey {
+			t.Errorf("event %d should be encrypted with %s: %v", i, expectedKey, event.Properties)
+		}
+		if bytes.Contains(event.Data, []byte("personal")) {
+			t.Errorf("event %d is not encrypted", i)
+		}
+		if data := decryptEvent(t, provider, event); string(data) != "personal data" {
+			t.Errorf("expected the message once decrypted but got %s", data)
+		}
+	}
+
+	if hub.events[0].Properties[EncryptionDataKeyProperty] != hub.events[9].Properties[EncryptionDataKeyProperty] {
+		t.Error("the data key should be reused while the current key is the same")
+	}
+	if hub.events[0].Properties[EncryptionDataKeyProperty] == hub.events[10].Properties[EncryptionDataKeyProperty] {
+		t.Error("a new data key should be created on rotation")
+	}
+}
+
+func TestSender_SendEventsAsBatch_Encryption_Leaves_The_Events(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, "k1", "k1")
+	provider, _ := NewFileKeyProvider(path)
+
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.encryption = newEncryptor(provider)
+
+	events := []*eventhub.Event{eventhub.NewEventFromString("personal data")}
+	if err := sender.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(events[0].Data) != "personal data" || events[0].Properties != nil {
+		t.Error("the given event should be left as it is")
+	}
+	if data := decryptEvent(t, provider, hub.events[0]); string(data) != "personal data" {
+		t.Errorf("expected the message once decrypted but got %s", data)
+	}
+}
+
+func TestFileKeyProvider_Invalid_Files(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"json":    `{"current": `,
+		"short":   `{"current": "k1", "keys": {"k1": "c2hvcnQ="}}`,
+		"current": `{"current": "k2", "keys": {"k1": "` + b64.StdEncoding.EncodeToString(make([]byte, 32)) + `"}}`,
+	} {
+		path := filepath.Join(dir, name)
+		_ = ioutil.WriteFile(path, []byte(content), 0600)
+		if _, err := NewFileKeyProvider(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := NewFileKeyProvider(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,125 @@
+package sender
+
+import (
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"sync/atomic"
+)
+
+type (
+	// eventFactory creates the events of a send call from the message and the sender settings.
+	eventFactory struct {
+		sender     *Sender
+		message    string
+		template   *messageTemplate
+		properties []propertyTemplate
+		seq        int64
+		random     *randomSource
+		generator  PayloadGenerator
+		ids        IDStrategy
+	}
+
+	// propertyTemplate is a property whose value is a template.
+	propertyTemplate struct {
+		key   string
+		value *messageTemplate
+	}
+)
+
+// newEventFactory compiles the message and the property values when the template mode is enabled. A dry run factory
+// draws from copies of the random source, of the payload generator and of the id strategy, so the events of a plan
+// leave the sender as it was and the send after it creates the same events.
+func (sender *Sender) newEventFactory(message string, dryRun bool) (*eventFactory, error) {
+	factory := &eventFactory{sender: sender, message: message, random: sender.random,
+		generator: sender.payloadGenerator, ids: sender.idStrategy}
+
+	if dryRun {
+		factory.random = sender.random.clone()
+		if generator, ok := factory.generator.(clonedGenerator); ok {
+			factory.generator = generator.clone()
+		}
+		if ids, ok := factory.ids.(statefulIDStrategy); ok {
+			factory.ids = ids.clone()
+		}
+		if ids, ok := factory.ids.(randomIDStrategy); ok {
+			factory.ids = ids.withRandom(factory.random)
+		}
+	}
+
+	if !sender.template {
+		return factory, nil
+	}
+	if factory.generator != nil {
+		message = "" // the body comes from the generator, only the properties are templates
+	}
+
+	tmpl, err := parseTemplate(message)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.random = factory.random
+	factory.template = tmpl
+
+	for _, value := range sender.properties {
+		for _, entry := range strings.Split(value, ";") {
+			keyValue := strings.SplitN(entry, ":", 2)
+			if len(keyValue) != 2 {
+				continue
+			}
+
+			valueTemplate, err := parseTemplate(keyValue[1])
+			if err != nil {
+				return nil, err
+			}
+			valueTemplate.random = factory.random
+			factory.properties = append(factory.properties, propertyTemplate{key: keyValue[0], value: valueTemplate})
+		}
+	}
+
+	return factory, nil
+}
+
+// next creates the next event, it is safe to be called from multiple go routines.
+func (factory *eventFactory) next() *eventhub.Event {
+	var event *eventhub.Event
+
+	sender := factory.sender
+	seq := atomic.AddInt64(&factory.seq, 1) - 1
+
+	body := factory.message
+	if factory.generator != nil {
+		body = string(factory.generator.Generate(seq))
+	} else if factory.template != nil {
+		body = factory.template.render(seq)
+	}
+	event = createAnEvent(sender.base64String, body, sender.messageSuffix, factory.random, nil)
+
+	if factory.template == nil {
+		addProperties(event, sender.properties)
+	} else {
+		event.Properties = make(map[string]interface{}, len(factory.properties))
+		for _, property := range factory.properties {
+			event.Properties[property.key] = property.value.render(seq)
+		}
+	}
+
+	if len(sender.propertyProviders) > 0 {
+		sender.handlerMutex.Lock()
+		sender.provideProperties(seq, event)
+		sender.handlerMutex.Unlock()
+	}
+
+	// the id can be read from the payload, so the event is compressed once stamped
+	sender.stampEvent(factory.ids, seq, event)
+	sender.compression.compress(event)
+
+	return event
+}
+
+// fixedSizeEvents tells if every event created from a message has the same size, a single batch limit calculated on
+// the first event applies to all of them then.
+func (sender *Sender) fixedSizeEvents() bool {
+	return !sender.template && sender.payloadGenerator == nil && !sender.hasEventMetadata() &&
+		!sender.preparesEvents() && len(sender.propertyProviders) == 0 &&
+		!(sender.compression != nil && sender.messageSuffix)
+}
@@ -5,4 +5,6 @@ go 1.16
 require (
 	github.com/Azure/azure-event-hubs-go/v3 v3.3.6
 	github.com/google/uuid v1.2.0
+	github.com/klauspost/compress v1.15.1
+	github.com/linkedin/goavro/v2 v2.11.1
 )
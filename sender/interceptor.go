@@ -0,0 +1,83 @@
+package sender
+
+import (
+	"context"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+)
+
+// Interceptor is called with every event before it is sent. It returns the event to send, which can be the given
+// event changed or another event, nil to drop the event, or an error to abort the send. The interceptors run on
+// SendMessage, SendBatchMessage, SendEventsAsBatch, the streams, Replay and AsyncSender.Produce. On the batch sends
+// they run while the batches are created, before anything is sent, so the batch sizes include their changes.
+type Interceptor func(ctx context.Context, event *eventhub.Event) (*eventhub.Event, error)
+
+// beforeSendInterceptor adapts a SetOnBeforeSendMessage handler, it sees the event and always keeps it.
+func beforeSendInterceptor(handler func(event *eventhub.Event)) Interceptor {
+	return func(ctx context.Context, event *eventhub.Event) (*eventhub.Event, error) {
+		handler(event)
+		return event, nil
+	}
+}
+
+// intercept runs the interceptors in the order they were added, it returns nil when one of them drops the event. The
+// interceptors are called one at a time, as the other handlers.
+func (sender *Sender) intercept(ctx context.Context, event *eventhub.Event) (*eventhub.Event, error) {
+	if len(sender.interceptors) == 0 {
+		return event, nil
+	}
+
+	sender.handlerMutex.Lock()
+	defer sender.handlerMutex.Unlock()
+
+	for _, interceptor := range sender.interceptors {
+		var err error
+		if event, err = interceptor(ctx, event); err != nil || event == nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
+
+// prepareEvent gives the event to the interceptors, then encrypts, claim checks, chunks and signs the event they
+// return. It returns the events to send in place of the event: none when it is dropped, its chunks when it is
+// chunked. It is the last step before the events are packed or sent.
+func (sender *Sender) prepareEvent(ctx context.Context, event *eventhub.Event) ([]*eventhub.Event, error) {
+	return sender.prepare(ctx, event, false)
+}
+
+// prepare is prepareEvent, with dryRun nothing leaves the sender: the payload is neither encrypted nor stored, the
+// events get the size and the properties they would have instead.
+func (sender *Sender) prepare(ctx context.Context, event *eventhub.Event, dryRun bool) ([]*eventhub.Event, error) {
+	event, err := sender.intercept(ctx, event)
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	if dryRun {
+		sender.encryption.estimate(event)
+		sender.claimCheck.estimate(event)
+	} else {
+		if err := sender.encryption.encrypt(ctx, event); err != nil {
+			return nil, err
+		}
+		if err := sender.claimCheck.check(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	events := sender.chunking.split(event)
+	for _, event := range events {
+		if err := sender.signing.sign(event); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// preparesEvents tells if prepareEvent can change the events.
+func (sender *Sender) preparesEvents() bool {
+	return len(sender.interceptors) > 0 || sender.encryption != nil || sender.signing != nil ||
+		sender.chunking != nil || sender.claimCheck != nil
+}
@@ -0,0 +1,115 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strconv"
+	"testing"
+)
+
+// dropEveryThird tags the events with their position and drops every third one.
+func dropEveryThird() Interceptor {
+	var calls int
+	return func(ctx context.Context, event *eventhub.Event) (*eventhub.Event, error) {
+		calls++
+		if calls%3 == 0 {
+			return nil, nil
+		}
+		event.Set("position", strconv.Itoa(calls))
+		return event, nil
+	}
+}
+
+func TestSender_Interceptors_Run_On_Every_Send(t *testing.T) {
+	sends := map[string]func(sender *Sender) error{
+		"SendMessage": func(sender *Sender) error {
+			return sender.SendMessage("message", context.Background())
+		},
+		"SendBatchMessage": func(sender *Sender) error {
+			return sender.SendBatchMessage("message", context.Background())
+		},
+		"SendEventsAsBatch": func(sender *Sender) error {
+			events := []*eventhub.Event{eventhub.NewEventFromString("message")}
+			return sender.SendEventsAsBatch(context.Background(), &events)
+		},
+	}
+
+	for name, send := range sends {
+		hub := &fakeHub{}
+		var seen int
+		builder := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(30).
+			AddInterceptor(dropEveryThird()).
+			SetOnBeforeSendMessage(func(event *eventhub.Event) { seen++ })
+		sender, _ := builder.GetSender()
+		sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+		if err := send(sender); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if hub.sent() != 20 || seen != 20 {
+			t.Errorf("%s: expected 20 events sent and seen, sent %d and seen %d", name, hub.sent(), seen)
+		}
+		for _, event := range hub.events {
+			if event.Properties["position"] == nil {
+				t.Errorf("%s: the event should have the position property", name)
+				break
+			}
+		}
+	}
+}
+
+func TestSender_SendEventsAsBatch_Interceptors_Leave_The_Events(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 3
+	sender.interceptors = []Interceptor{func(ctx context.Context, event *eventhub.Event) (*eventhub.Event, error) {
+		return eventhub.NewEventFromString("rewritten " + string(event.Data)), nil
+	}}
+
+	original := eventhub.NewEventFromString("message")
+	events := []*eventhub.Event{original}
+	if err := sender.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(original.Data) != "message" || events[0] != original {
+		t.Error("the given events should be left as they are")
+	}
+	for _, event := range hub.events {
+		if string(event.Data) != "rewritten message" {
+			t.Errorf("expected the rewritten event but got %s", event.Data)
+		}
+	}
+}
+
+func TestSender_Interceptor_Aborts_The_Send(t *testing.T) {
+	abort := errors.New("forbidden content")
+	interceptor := func(ctx context.Context, event *eventhub.Event) (*eventhub.Event, error) {
+		if event.Properties["n"] == "5" {
+			return nil, abort
+		}
+		return event, nil
+	}
+
+	newSender := func(hub *fakeHub) *Sender {
+		sender, _ := newFakeSender(hub)
+		sender.numberOfMessages = 10
+		sender.template = true
+		sender.properties = []string{"n:{{seq}}"}
+		sender.interceptors = []Interceptor{interceptor}
+		return sender
+	}
+
+	var partial *PartialSendError
+	err := newSender(&fakeHub{}).SendMessage("message", context.Background())
+	if !errors.Is(err, abort) || !errors.As(err, &partial) || partial.Sent != 5 {
+		t.Errorf("expected the send aborted after 5 events but got %v", err)
+	}
+
+	hub := &fakeHub{}
+	if err := newSender(hub).SendBatchMessage("message", context.Background()); !errors.Is(err, abort) || hub.sent() != 0 {
+		t.Errorf("expected the batch send aborted before sending but got %v, %d events sent", err, hub.sent())
+	}
+}
@@ -0,0 +1,178 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// CorrelationIDProperty is the event property holding the correlation id set with SetCorrelationID.
+	CorrelationIDProperty = "correlation-id"
+	// ContentTypeProperty is the event property holding the content type set with SetContentType.
+	ContentTypeProperty = "content-type"
+)
+
+type (
+	// IDStrategy returns the message id of an event, index is the position of the event in the send starting at 0.
+	// An empty id leaves the event without message id. It must be safe to be called from multiple go routines.
+	IDStrategy interface {
+		ID(index int64, event *eventhub.Event) string
+	}
+
+	// IDStrategyFunc is a function used as IDStrategy.
+	IDStrategyFunc func(index int64, event *eventhub.Event) string
+
+	// statefulIDStrategy is an IDStrategy keeping state from one send to the next one, Plan works on a copy.
+	statefulIDStrategy interface {
+		clone() IDStrategy
+	}
+
+	// randomIDStrategy is an IDStrategy drawing from a random source, GetSender binds it to the one of the sender so
+	// the ids follow SetRandomSeed.
+	randomIDStrategy interface {
+		withRandom(random *randomSource) IDStrategy
+	}
+
+	sequenceIDs struct {
+		next int64
+	}
+
+	templateIDs struct {
+		template *messageTemplate
+	}
+)
+
+// ID calls f(index, event).
+func (f IDStrategyFunc) ID(index int64, event *eventhub.Event) string {
+	return f(index, event)
+}
+
+// IDFromUUID() gives every event a random uuid as message id.
+func IDFromUUID() IDStrategy {
+	return IDStrategyFunc(func(index int64, event *eventhub.Event) string {
+		return uuid.New().String()
+	})
+}
+
+// IDFromSequence(start int64) numbers the events starting at start, the sequence goes on from one send to the next
+// one so ids are unique for the life of the sender.
+func IDFromSequence(start int64) IDStrategy {
+	return &sequenceIDs{next: start - 1}
+}
+
+func (ids *sequenceIDs) ID(index int64, event *eventhub.Event) string {
+	return strconv.FormatInt(atomic.AddInt64(&ids.next, 1), 10)
+}
+
+func (ids *sequenceIDs) clone() IDStrategy {
+	return &sequenceIDs{next: atomic.LoadInt64(&ids.next)}
+}
+
+// IDFromTemplate(template string) evaluates the template for every event, it supports the placeholders of
+// SetTemplate, ex: "order-{{seq}}-{{randString 4}}". The random placeholders draw from the random source of the
+// sender, so they follow SetRandomSeed.
+func IDFromTemplate(template string) (IDStrategy, error) {
+	tmpl, err := parseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &templateIDs{template: tmpl}, nil
+}
+
+func (ids *templateIDs) ID(index int64, event *eventhub.Event) string {
+	return ids.template.render(index)
+}
+
+// withRandom returns a copy of the strategy drawing from random, the strategy can be shared by several senders.
+func (ids *templateIDs) withRandom(random *randomSource) IDStrategy {
+	return &templateIDs{template: &messageTemplate{parts: ids.template.parts, random: random}}
+}
+
+// IDFromPayloadField(path string) reads the id from a field of the json payload, nested fields are separated by dots,
+// ex: "order.id". Strings, numbers and booleans are supported, events without the field get no message id.
+func IDFromPayloadField(path string) IDStrategy {
+	fields := strings.Split(path, ".")
+
+	return IDStrategyFunc(func(index int64, event *eventhub.Event) string {
+		return payloadField(event.Data, fields)
+	})
+}
+
+func payloadField(data []byte, fields []string) string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return ""
+	}
+
+	for _, field := range fields {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = object[field]; !ok {
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+
+	return ""
+}
+
+// hasEventMetadata tells if the events need to be stamped with an id, a correlation id or a content type.
+func (sender *Sender) hasEventMetadata() bool {
+	return sender.idStrategy != nil || sender.correlationID != "" || sender.contentType != ""
+}
+
+// stampEvent sets the message id given by ids, the correlation id and the content type of the event. Version 3 of the
+// event hubs library only sends the message id in the amqp properties, correlation id and content type are sent as
+// the CorrelationIDProperty and ContentTypeProperty application properties.
+func (sender *Sender) stampEvent(ids IDStrategy, index int64, event *eventhub.Event) {
+	if ids != nil {
+		event.ID = ids.ID(index, event)
+	}
+
+	if sender.correlationID == "" && sender.contentType == "" {
+		return
+	}
+
+	if event.Properties == nil {
+		event.Properties = make(map[string]interface{})
+	}
+	if sender.correlationID != "" {
+		event.Properties[CorrelationIDProperty] = sender.correlationID
+	}
+	if sender.contentType != "" {
+		event.Properties[ContentTypeProperty] = sender.contentType
+	}
+}
+
+// copyEvent returns a copy of the event which can be stamped without changing the original.
+func copyEvent(event *eventhub.Event) *eventhub.Event {
+	result := *event
+	if event.Properties != nil {
+		result.Properties = make(map[string]interface{}, len(event.Properties))
+		for key, value := range event.Properties {
+			result.Properties[key] = value
+		}
+	}
+
+	return &result
+}
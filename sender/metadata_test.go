@@ -0,0 +1,188 @@
+package sender
+
+import (
+	"context"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+)
+
+func TestIDStrategies(t *testing.T) {
+	event := eventhub.NewEvent([]byte(`{"order": {"id": 42, "ref": "A-1"}, "ok": true}`))
+
+	sequence := IDFromSequence(100)
+	if id := sequence.ID(0, event); id != "100" {
+		t.Errorf("expected 100 but got %q", id)
+	}
+	if id := sequence.ID(0, event); id != "101" {
+		t.Errorf("the sequence should go on, expected 101 but got %q", id)
+	}
+
+	template, err := IDFromTemplate("event-{{seq}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := template.ID(7, event); id != "event-7" {
+		t.Errorf("expected event-7 but got %q", id)
+	}
+
+	if id := IDFromUUID().ID(0, event); len(id) != 36 {
+		t.Errorf("expected a uuid but got %q", id)
+	}
+
+	for path, expected := range map[string]string{"order.id": "42", "order.ref": "A-1", "ok": "true", "order": "",
+		"missing": "", "order.id.deeper": ""} {
+		if id := IDFromPayloadField(path).ID(0, event); id != expected {
+			t.Errorf("path %q: expected %q but got %q", path, expected, id)
+		}
+	}
+
+	if id := IDFromPayloadField("id").ID(0, eventhub.NewEvent([]byte("not json"))); id != "" {
+		t.Errorf("expected no id from a non json payload but got %q", id)
+	}
+}
+
+func TestSender_Stamps_The_Events(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.idStrategy = IDFromSequence(0)
+	sender.correlationID = "run-1"
+	sender.contentType = "application/json"
+	sender.numberOfMessages = 5
+	sender.workers = 2
+
+	events := []*eventhub.Event{eventhub.NewEvent([]byte("1")), eventhub.NewEvent([]byte("2"))}
+	if err := sender.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendBatchMessage("{}", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMessage("{}", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 15 {
+		t.Fatalf("hub should receive 15 events but received %v", hub.sent())
+	}
+
+	ids := make(map[string]bool)
+	for _, event := range hub.events {
+		if ids[event.ID] {
+			t.Errorf("id %q was sent twice", event.ID)
+		}
+		ids[event.ID] = true
+
+		if event.Properties[CorrelationIDProperty] != "run-1" {
+			t.Errorf("expected the correlation id on event %q", event.ID)
+		}
+		if event.Properties[ContentTypeProperty] != "application/json" {
+			t.Errorf("expected the content type on event %q", event.ID)
+		}
+	}
+}
+
+func TestSender_Stamps_Copies_Of_The_Caller_Events(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.idStrategy = IDFromSequence(0)
+	sender.correlationID = "run-1"
+
+	events := []*eventhub.Event{eventhub.NewEvent([]byte("1")), eventhub.NewEvent([]byte("2"))}
+	if err := sender.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan *eventhub.Event, 1)
+	stream <- events[0]
+	close(stream)
+	if err := sender.SendStream(context.Background(), stream); err != nil {
+		t.Fatal(err)
+	}
+
+	async, err := sender.NewAsyncSender(AsyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := async.Produce(events[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 4 {
+		t.Fatalf("hub should receive 4 events but received %v", hub.sent())
+	}
+	for _, event := range events {
+		if event.ID != "" || event.Properties != nil {
+			t.Errorf("the event of the caller should not be stamped, got %q %v", event.ID, event.Properties)
+		}
+	}
+	for _, event := range hub.events {
+		if event.ID == "" || event.Properties[CorrelationIDProperty] != "run-1" {
+			t.Errorf("the sent event should be stamped, got %q %v", event.ID, event.Properties)
+		}
+	}
+}
+
+func TestSender_IDFromPayloadField_With_Compression(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.idStrategy = IDFromPayloadField("id")
+	sender.compression, _ = newCompressor(Gzip, 0, 0)
+	sender.numberOfMessages = 1
+
+	message := `{"id": "abc", "padding": "` + strings.Repeat("a", 500) + `"}`
+	if err := sender.SendMessage(message, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	event := hub.events[0]
+	if event.ID != "abc" {
+		t.Errorf("expected the id to be read before compression, got %q", event.ID)
+	}
+	if event.Properties[ContentEncodingProperty] != "gzip" {
+		t.Error("expected the payload to be compressed")
+	}
+}
+
+// seededTemplateIDs sends 5 events with a seeded sender whose ids come from the template and returns the ids.
+func seededTemplateIDs(t *testing.T, strategy IDStrategy, seed int64) []string {
+	hub := &fakeHub{}
+	sender, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(5).
+		SetIDStrategy(strategy).SetRandomSeed(seed).GetSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	if err := sender.SendMessage("message", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 0, len(hub.events))
+	for _, event := range hub.events {
+		ids = append(ids, event.ID)
+	}
+
+	return ids
+}
+
+func TestIDFromTemplate_Follows_The_Random_Seed(t *testing.T) {
+	strategy, err := IDFromTemplate(`order-{{uuid}}-{{randInt 1 1000000}}-{{pick "a" "b" "c"}}-{{randString 8}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := seededTemplateIDs(t, strategy, 7)
+	second := seededTemplateIDs(t, strategy, 7)
+	other := seededTemplateIDs(t, strategy, 8)
+
+	if len(first) != 5 || strings.Join(first, ",") != strings.Join(second, ",") {
+		t.Errorf("the same seed should create the same ids, got %v and %v", first, second)
+	}
+	if strings.Join(first, ",") == strings.Join(other, ",") {
+		t.Error("another seed should create other ids")
+	}
+}
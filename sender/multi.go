@@ -0,0 +1,253 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FanOutMode tells when a send of a MultiSender succeeds.
+type FanOutMode int
+
+const (
+	// AllMustSucceed waits for every destination, the send fails when one of them fails.
+	AllMustSucceed FanOutMode = iota
+	// BestEffort waits for every destination, the send fails only when all of them fail.
+	BestEffort
+	// PrimaryWithAsyncSecondaries waits for the first destination only, the others are sent in background and their
+	// outcome is given to MultiSenderOptions.OnAsyncResult.
+	PrimaryWithAsyncSecondaries
+)
+
+type (
+	// Destination is a Sender of a MultiSender, Name identifies it in the results.
+	Destination struct {
+		Name   string
+		Sender *Sender
+	}
+
+	// MultiSenderOptions configures a MultiSender.
+	MultiSenderOptions struct {
+		Mode FanOutMode
+		// OnAsyncResult is called with the outcome of every background send of PrimaryWithAsyncSecondaries.
+		OnAsyncResult func(result DestinationResult)
+	}
+
+	// DestinationResult is the outcome of a send for a destination. Async is set for a secondary sent in background,
+	// its Err and Duration are only known by OnAsyncResult.
+	DestinationResult struct {
+		Name     string
+		Err      error
+		Duration time.Duration
+		Async    bool
+	}
+
+	// MultiSendResult holds the outcome of a send per destination, in the order of the destinations.
+	MultiSendResult struct {
+		Destinations []DestinationResult
+	}
+
+	// MultiSendError is returned when a send does not meet the FanOutMode, Failed lists the failed destinations.
+	MultiSendError struct {
+		Mode   FanOutMode
+		Failed []DestinationResult
+	}
+
+	// MultiSender sends the same events to several event hubs, ex: the old and the new namespace during a migration.
+	MultiSender struct {
+		destinations []Destination
+		options      MultiSenderOptions
+		mutex        sync.Mutex
+		closed       bool
+		background   sync.WaitGroup
+		ctx          context.Context
+		cancel       context.CancelFunc
+	}
+)
+
+func (e *MultiSendError) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i, result := range e.Failed {
+		failures[i] = fmt.Sprintf("%s: %v", result.Name, result.Err)
+	}
+
+	return fmt.Sprintf("send failed for %d destination(s): %s", len(e.Failed), strings.Join(failures, "; "))
+}
+
+// Unwrap returns the error of the first failed destination.
+func (e *MultiSendError) Unwrap() error {
+	if len(e.Failed) == 0 {
+		return nil
+	}
+
+	return e.Failed[0].Err
+}
+
+// Failed() returns the destinations whose send failed.
+func (result *MultiSendResult) Failed() []DestinationResult {
+	var failed []DestinationResult
+	for _, destination := range result.Destinations {
+		if destination.Err != nil {
+			failed = append(failed, destination)
+		}
+	}
+
+	return failed
+}
+
+// NewMultiSender(options MultiSenderOptions, destinations ...Destination) returns a sender publishing to every
+// destination, the first one is the primary. A destination without name is named by its position.
+func NewMultiSender(options MultiSenderOptions, destinations ...Destination) (*MultiSender, error) {
+	if len(destinations) == 0 {
+		return nil, errors.New("at least one destination is required")
+	}
+	if options.Mode < AllMustSucceed || options.Mode > PrimaryWithAsyncSecondaries {
+		return nil, fmt.Errorf("unknown fan out mode %d", options.Mode)
+	}
+
+	multi := &MultiSender{destinations: make([]Destination, len(destinations)), options: options}
+	for i, destination := range destinations {
+		if destination.Sender == nil {
+			return nil, fmt.Errorf("destination %d has no sender", i)
+		}
+		if destination.Name == "" {
+			destination.Name = strconv.Itoa(i)
+		}
+		multi.destinations[i] = destination
+	}
+	multi.ctx, multi.cancel = context.WithCancel(context.Background())
+
+	return multi, nil
+}
+
+// SendEventsAsBatch(ctx context.Context, events *[]*eventhub.Event) sends the events to every destination, each
+// destination gets its own copy of the events.
+func (multi *MultiSender) SendEventsAsBatch(ctx context.Context, events *[]*eventhub.Event) (*MultiSendResult, error) {
+	// copied before any send starts, the background sends must not read the events of the caller
+	copies := make([][]*eventhub.Event, len(multi.destinations))
+	for i := range copies {
+		copies[i] = make([]*eventhub.Event, len(*events))
+		for j, event := range *events {
+			copies[i][j] = copyEvent(event)
+		}
+	}
+
+	return multi.send(ctx, func(ctx context.Context, index int, sender *Sender) error {
+		return sender.SendEventsAsBatch(ctx, &copies[index])
+	})
+}
+
+// SendBatchMessage(message string, ctx context.Context) calls SendBatchMessage on every destination. The events are
+// created by each sender with its own settings, use SendEventsAsBatch when templates or random suffixes must produce
+// the same events everywhere.
+func (multi *MultiSender) SendBatchMessage(message string, ctx context.Context) (*MultiSendResult, error) {
+	return multi.send(ctx, func(ctx context.Context, index int, sender *Sender) error {
+		return sender.SendBatchMessage(message, ctx)
+	})
+}
+
+// SendMessage(message string, ctx context.Context) calls SendMessage on every destination, see SendBatchMessage.
+func (multi *MultiSender) SendMessage(message string, ctx context.Context) (*MultiSendResult, error) {
+	return multi.send(ctx, func(ctx context.Context, index int, sender *Sender) error {
+		return sender.SendMessage(message, ctx)
+	})
+}
+
+// Close(ctx context.Context) waits for the background sends, cancels them when ctx is done first, and closes every
+// destination.
+func (multi *MultiSender) Close(ctx context.Context) error {
+	multi.mutex.Lock()
+	multi.closed = true
+	multi.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		multi.background.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		multi.cancel()
+		<-done
+	}
+	multi.cancel()
+
+	for _, destination := range multi.destinations {
+		if closeErr := destination.Sender.Close(ctx); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (multi *MultiSender) send(ctx context.Context, send func(ctx context.Context, index int, sender *Sender) error) (*MultiSendResult, error) {
+	multi.mutex.Lock()
+	if multi.closed {
+		multi.mutex.Unlock()
+		return nil, ErrSenderClosed
+	}
+	async := multi.options.Mode == PrimaryWithAsyncSecondaries
+	if async {
+		multi.background.Add(len(multi.destinations) - 1)
+	}
+	multi.mutex.Unlock()
+
+	result := &MultiSendResult{Destinations: make([]DestinationResult, len(multi.destinations))}
+	run := func(ctx context.Context, index int) DestinationResult {
+		destination := multi.destinations[index]
+		start := time.Now()
+		err := send(ctx, index, destination.Sender)
+
+		return DestinationResult{Name: destination.Name, Err: err, Duration: time.Since(start)}
+	}
+
+	if async {
+		for i, destination := range multi.destinations[1:] {
+			result.Destinations[i+1] = DestinationResult{Name: destination.Name, Async: true}
+
+			go func(index int) {
+				defer multi.background.Done()
+
+				outcome := run(multi.ctx, index)
+				outcome.Async = true
+				if multi.options.OnAsyncResult != nil {
+					multi.options.OnAsyncResult(outcome)
+				}
+			}(i + 1)
+		}
+
+		result.Destinations[0] = run(ctx, 0)
+		if result.Destinations[0].Err != nil {
+			return result, &MultiSendError{Mode: multi.options.Mode, Failed: result.Destinations[:1]}
+		}
+
+		return result, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(multi.destinations))
+	for i := range multi.destinations {
+		go func(i int) {
+			defer wg.Done()
+			result.Destinations[i] = run(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	failed := result.Failed()
+	if len(failed) > 0 && (multi.options.Mode == AllMustSucceed || len(failed) == len(multi.destinations)) {
+		return result, &MultiSendError{Mode: multi.options.Mode, Failed: failed}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,142 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"testing"
+	"time"
+)
+
+func newDestinations(hubs ...*fakeHub) []Destination {
+	destinations := make([]Destination, len(hubs))
+	for i, hub := range hubs {
+		sender, _ := newFakeSender(hub)
+		sender.numberOfMessages = 4
+		destinations[i] = Destination{Sender: sender}
+	}
+	destinations[0].Name = "old"
+
+	return destinations
+}
+
+func TestMultiSender_All_Must_Succeed(t *testing.T) {
+	failure := errors.New("unauthorized")
+	hubs := []*fakeHub{{}, {sendErr: failure}, {}}
+	multi, err := NewMultiSender(MultiSenderOptions{Mode: AllMustSucceed}, newDestinations(hubs...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*eventhub.Event{eventhub.NewEventFromString("message")}
+	result, err := multi.SendEventsAsBatch(context.Background(), &events)
+
+	var multiErr *MultiSendError
+	if !errors.As(err, &multiErr) || !errors.Is(err, failure) || len(multiErr.Failed) != 1 || multiErr.Failed[0].Name != "1" {
+		t.Fatalf("expected the destination 1 to fail but got %v", err)
+	}
+	if len(result.Destinations) != 3 || result.Destinations[0].Name != "old" || result.Destinations[0].Err != nil ||
+		result.Destinations[2].Err != nil {
+		t.Errorf("unexpected results %+v", result.Destinations)
+	}
+	if hubs[0].sent() != 4 || hubs[2].sent() != 4 {
+		t.Errorf("the other destinations should receive the events, got %d and %d", hubs[0].sent(), hubs[2].sent())
+	}
+	if hubs[0].events[0] == hubs[2].events[0] || hubs[0].events[0] == events[0] {
+		t.Error("every destination should get its own copy of the events")
+	}
+}
+
+func TestMultiSender_Best_Effort(t *testing.T) {
+	failure := errors.New("unauthorized")
+	multi, _ := NewMultiSender(MultiSenderOptions{Mode: BestEffort},
+		newDestinations(&fakeHub{sendErr: failure}, &fakeHub{})...)
+
+	result, err := multi.SendBatchMessage("message", context.Background())
+	if err != nil || len(result.Failed()) != 1 || result.Failed()[0].Name != "old" {
+		t.Errorf("best effort should succeed with one destination: %v, %+v", err, result)
+	}
+
+	multi, _ = NewMultiSender(MultiSenderOptions{Mode: BestEffort},
+		newDestinations(&fakeHub{sendErr: failure}, &fakeHub{sendErr: failure})...)
+	if _, err := multi.SendMessage("message", context.Background()); !errors.Is(err, failure) {
+		t.Errorf("best effort should fail when every destination fails, got %v", err)
+	}
+}
+
+func TestMultiSender_Primary_With_Async_Secondaries(t *testing.T) {
+	secondary := &fakeHub{gate: make(chan struct{})}
+	results := make(chan DestinationResult, 1)
+	multi, _ := NewMultiSender(MultiSenderOptions{
+		Mode:          PrimaryWithAsyncSecondaries,
+		OnAsyncResult: func(result DestinationResult) { results <- result },
+	}, newDestinations(&fakeHub{}, secondary)...)
+
+	result, err := multi.SendBatchMessage("message", context.Background())
+	if err != nil || result.Destinations[0].Err != nil || !result.Destinations[1].Async {
+		t.Fatalf("the primary should be sent and the secondary pending: %v, %+v", err, result)
+	}
+
+	select {
+	case <-results:
+		t.Fatal("the secondary should still be sending")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(secondary.gate)
+	if err := multi.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	outcome := <-results
+	if outcome.Name != "1" || outcome.Err != nil || !outcome.Async || secondary.sent() != 4 {
+		t.Errorf("unexpected secondary outcome %+v, %d events sent", outcome, secondary.sent())
+	}
+	if _, err := multi.SendMessage("message", context.Background()); err != ErrSenderClosed {
+		t.Errorf("expected ErrSenderClosed but got %v", err)
+	}
+}
+
+func TestMultiSender_Close_Cancels_The_Secondaries(t *testing.T) {
+	secondary := &fakeHub{gate: make(chan struct{})}
+	results := make(chan DestinationResult, 1)
+	multi, _ := NewMultiSender(MultiSenderOptions{
+		Mode:          PrimaryWithAsyncSecondaries,
+		OnAsyncResult: func(result DestinationResult) { results <- result },
+	}, newDestinations(&fakeHub{}, secondary)...)
+
+	if _, err := multi.SendBatchMessage("message", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := multi.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the close to time out but got %v", err)
+	}
+	if outcome := <-results; !errors.Is(outcome.Err, context.Canceled) {
+		t.Errorf("the secondary send should be cancelled but got %v", outcome.Err)
+	}
+}
+
+func TestMultiSender_Async_Secondaries_Do_Not_Read_The_Caller_Events(t *testing.T) {
+	secondary := &fakeHub{gate: make(chan struct{})}
+	multi, _ := NewMultiSender(MultiSenderOptions{Mode: PrimaryWithAsyncSecondaries},
+		newDestinations(&fakeHub{}, secondary)...)
+
+	events := []*eventhub.Event{eventhub.NewEventFromString("first")}
+	if _, err := multi.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Fatal(err)
+	}
+	// the caller reuses its slice while the secondary is still sending
+	events[0] = eventhub.NewEventFromString("second")
+	events = append(events[:0], eventhub.NewEventFromString("third"))
+
+	close(secondary.gate)
+	if err := multi.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if secondary.sent() != 4 || string(secondary.events[0].Data) != "first" {
+		t.Errorf("the secondary should send the events given to the call, got %d events", secondary.sent())
+	}
+}
@@ -0,0 +1,939 @@
+package sender
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/google/uuid"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy tells what the outbox does with a new event when it is full.
+type OverflowPolicy int
+
+const (
+	// OverflowReject fails the send with ErrOutboxFull, the events already in the outbox are kept.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropOldest deletes the oldest segments of the outbox to make room for the new events.
+	OverflowDropOldest
+)
+
+const (
+	defaultOutboxMaxSize          = 1024 * 1024 * 1024
+	defaultOutboxSegmentSize      = 64 * 1024 * 1024
+	defaultOutboxRetryInterval    = time.Second
+	defaultOutboxMaxRetryInterval = time.Minute
+	outboxSendTimeout             = time.Minute
+	outboxSegmentExtension        = ".seg"
+	outboxCorruptedExtension      = ".corrupted"
+	outboxCursorFile              = "cursor"
+	outboxRecordHeaderSize        = 16 // length, crc32 and enqueued time
+)
+
+// outboxPropertyTypes are the types of the properties an event in the outbox can have, by name.
+var outboxPropertyTypes = typesByName("", false, int(0), int8(0), int16(0), int32(0), int64(0), uint(0), uint8(0),
+	uint16(0), uint32(0), uint64(0), float32(0), float64(0), time.Time{}, []byte(nil))
+
+// ErrOutboxFull is returned when an event does not fit in the outbox and the overflow policy is OverflowReject, or
+// when the event alone is larger than MaxSize.
+var ErrOutboxFull = errors.New("outbox is full")
+
+// ErrOutboxCorrupted is reported to OnError when a record of the outbox cannot be read. The segment holding it is set
+// aside, renamed with the ".corrupted" extension, once its readable events before the record are sent.
+var ErrOutboxCorrupted = errors.New("outbox record is corrupted")
+
+type (
+	// OutboxOptions configures the durable outbox of the sender, only Dir is required.
+	OutboxOptions struct {
+		Dir              string         // directory of the outbox files, created if needed
+		MaxSize          int64          // max bytes kept on disk, default 1GB
+		SegmentSize      int64          // size from which a new segment file is started, default 64MB
+		Overflow         OverflowPolicy // what to do when MaxSize is reached, default OverflowReject
+		RetryInterval    time.Duration  // wait after the first failed resend, doubled on every failure, default 1s
+		MaxRetryInterval time.Duration  // max wait between two resends, default 1 minute
+		// OnError is called with the errors of the drainer: the failed resends, and ErrOutboxCorrupted when a record
+		// cannot be read. It is called from the go routine of the drainer, and by GetSender for the corrupted
+		// segments found on start.
+		OnError func(err error)
+	}
+
+	// OutboxStats describes the events waiting in the outbox.
+	OutboxStats struct {
+		Events      int64     // events waiting to be sent
+		Bytes       int64     // bytes of the waiting events on disk
+		Segments    int       // segment files on disk
+		OldestEvent time.Time // time the oldest waiting event entered the outbox, zero when empty
+		OldestAge   time.Duration
+		Dropped     int64 // events dropped by OverflowDropOldest, rejected by event hubs as too large or corrupted
+		Corrupted   int   // segments set aside because a record could not be read
+	}
+
+	// outbox is an append-only log of events split in segment files. Every append is synced to disk before it returns.
+	// The cursor file holds the position of the next event to send, segments before it are deleted.
+	outbox struct {
+		options   OutboxOptions
+		mutex     sync.Mutex
+		segments  []*outboxSegment // oldest first, the last one is the active segment
+		active    *os.File
+		cursor    outboxPosition
+		headAcked int64 // events of the head segment before the cursor
+		events    int64
+		dropped   int64
+		corrupted int
+		notify    chan struct{} // signals the drainer that events were appended
+		changed   chan struct{} // closed, and replaced, every time events leave the outbox
+		cancel    context.CancelFunc
+		done      chan struct{}
+	}
+
+	outboxSegment struct {
+		id        int64
+		size      int64
+		events    int64
+		corrupted bool // set aside instead of deleted once the events before the corrupted record are sent
+	}
+
+	outboxPosition struct {
+		segment int64
+		offset  int64
+	}
+
+	// outboxRecord is the encoded form of an event, the partition key is kept so is the ordering per partition.
+	outboxRecord struct {
+		Data         []byte                    `json:"d"`
+		ID           string                    `json:"id,omitempty"`
+		PartitionKey *string                   `json:"pk,omitempty"`
+		Properties   map[string]outboxProperty `json:"p,omitempty"`
+	}
+
+	// outboxProperty is a property with the name of its type, json alone would turn every number into a float64.
+	outboxProperty struct {
+		Type  string          `json:"t"`
+		Value json.RawMessage `json:"v"`
+	}
+
+	// outboxBatch is a run of events read from the head segment, end is the position after the last one.
+	outboxBatch struct {
+		events  []*eventhub.Event
+		end     outboxPosition
+		dropped int64
+	}
+)
+
+// SetOutbox(options OutboxOptions) keep the events which could not be sent in a durable outbox on disk instead of
+// returning the error. A background drainer sends them again, in order, as soon as event hubs is reachable. While the
+// outbox holds events, new events are appended to it so the order is kept. Events are delivered at least once, an
+// event sent right before a crash may be sent again on restart.
+func (builder *Builder) SetOutbox(options OutboxOptions) ISenderBuilder {
+	builder.outbox = &options
+
+	return builder
+}
+
+// OutboxStats() returns the depth of the outbox and the age of its oldest event, zero values without outbox.
+func (sender *Sender) OutboxStats() OutboxStats {
+	return sender.outbox.stats()
+}
+
+// DrainOutbox(ctx context.Context) waits until every event of the outbox has been sent or ctx is done.
+func (sender *Sender) DrainOutbox(ctx context.Context) error {
+	for {
+		changed, events := sender.outbox.waitChange()
+		if events == 0 {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// openOutbox creates the outbox directory or recovers the events left by a previous run. A record torn by a crash
+// at the end of the last segment is discarded.
+func openOutbox(options OutboxOptions) (*outbox, error) {
+	if strings.TrimSpace(options.Dir) == "" {
+		return nil, errors.New("outbox directory is missing")
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultOutboxMaxSize
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = defaultOutboxSegmentSize
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = defaultOutboxRetryInterval
+	}
+	if options.MaxRetryInterval < options.RetryInterval {
+		options.MaxRetryInterval = defaultOutboxMaxRetryInterval
+		if options.MaxRetryInterval < options.RetryInterval {
+			options.MaxRetryInterval = options.RetryInterval
+		}
+	}
+
+	if err := os.MkdirAll(options.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	box := &outbox{
+		options: options,
+		notify:  make(chan struct{}, 1),
+		changed: make(chan struct{}),
+	}
+
+	if err := box.recover(); err != nil {
+		return nil, err
+	}
+
+	return box, nil
+}
+
+func (box *outbox) recover() error {
+	ids, err := box.segmentIDs()
+	if err != nil {
+		return err
+	}
+
+	cursor, err := box.readCursor()
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if id < cursor.segment {
+			if err := os.Remove(box.segmentPath(id)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		segment, acked, err := box.scanSegment(id, cursor, i == len(ids)-1)
+		if err != nil {
+			return err
+		}
+		if len(box.segments) == 0 {
+			box.headAcked = acked
+		}
+		if segment.corrupted {
+			box.corrupted++
+			box.report(fmt.Errorf("%w: segment %d at %d, the records after it are set aside", ErrOutboxCorrupted,
+				id, segment.size))
+		}
+		box.segments = append(box.segments, segment)
+		box.events += segment.events
+	}
+	box.events -= box.headAcked
+
+	if len(box.segments) == 0 {
+		// every event was sent, the next segment keeps the cursor id so the ids never go back
+		box.cursor = outboxPosition{segment: cursor.segment}
+		return box.rotate()
+	}
+
+	if box.segments[0].id != cursor.segment {
+		cursor = outboxPosition{segment: box.segments[0].id}
+		box.headAcked = 0
+	} else if cursor.offset > box.segments[0].size {
+		cursor.offset = box.segments[0].size
+	}
+	box.cursor = cursor
+
+	active := box.segments[len(box.segments)-1]
+	if active.corrupted {
+		return box.rotate() // the new events must not follow the corrupted record
+	}
+	box.active, err = os.OpenFile(box.segmentPath(active.id), os.O_WRONLY|os.O_APPEND, 0600)
+
+	return err
+}
+
+// scanSegment counts the valid records of a segment. A record torn by a crash at the end of the last segment is
+// truncated, the segment is marked as corrupted when any other invalid record follows the valid ones. acked is the
+// number of records before the cursor.
+func (box *outbox) scanSegment(id int64, cursor outboxPosition, last bool) (*outboxSegment, int64, error) {
+	file, err := os.Open(box.segmentPath(id))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	segment := &outboxSegment{id: id}
+	var acked int64
+	var torn bool
+	reader := bufio.NewReader(file)
+
+	for {
+		if id == cursor.segment && segment.size == cursor.offset {
+			acked = segment.events
+		}
+
+		_, _, size, err := readOutboxRecord(reader)
+		if err != nil {
+			torn = err == io.EOF || err == io.ErrUnexpectedEOF
+			break
+		}
+		segment.size += size
+		segment.events++
+	}
+
+	if info, err := file.Stat(); err == nil && info.Size() > segment.size {
+		if !last || !torn {
+			segment.corrupted = true
+		} else if err := os.Truncate(box.segmentPath(id), segment.size); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return segment, acked, nil
+}
+
+func (box *outbox) segmentIDs() ([]int64, error) {
+	entries, err := ioutil.ReadDir(box.options.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, outboxSegmentExtension) {
+			continue
+		}
+		if id, err := strconv.ParseInt(strings.TrimSuffix(name, outboxSegmentExtension), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (box *outbox) segmentPath(id int64) string {
+	return filepath.Join(box.options.Dir, fmt.Sprintf("%016d%s", id, outboxSegmentExtension))
+}
+
+// removeSegment deletes the file of the segment, a corrupted segment is renamed so it can still be inspected.
+func (box *outbox) removeSegment(segment *outboxSegment) error {
+	if segment.corrupted {
+		return os.Rename(box.segmentPath(segment.id), box.segmentPath(segment.id)+outboxCorruptedExtension)
+	}
+
+	return os.Remove(box.segmentPath(segment.id))
+}
+
+func (box *outbox) readCursor() (outboxPosition, error) {
+	var cursor outboxPosition
+
+	content, err := ioutil.ReadFile(filepath.Join(box.options.Dir, outboxCursorFile))
+	if os.IsNotExist(err) {
+		return cursor, nil
+	} else if err != nil {
+		return cursor, err
+	}
+
+	if _, err := fmt.Sscanf(string(content), "%d %d", &cursor.segment, &cursor.offset); err != nil {
+		return cursor, fmt.Errorf("outbox cursor is corrupted: %v", err)
+	}
+
+	return cursor, nil
+}
+
+// writeCursor replaces the cursor file atomically.
+func (box *outbox) writeCursor() error {
+	path := filepath.Join(box.options.Dir, outboxCursorFile)
+	file, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d %d\n", box.cursor.segment, box.cursor.offset)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// rotate closes the active segment and starts a new one.
+func (box *outbox) rotate() error {
+	id := box.cursor.segment
+	if len(box.segments) > 0 {
+		id = box.segments[len(box.segments)-1].id + 1
+	}
+
+	file, err := os.OpenFile(box.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	syncDir(box.options.Dir)
+
+	if box.active != nil {
+		box.active.Close()
+	}
+	box.active = file
+	box.segments = append(box.segments, &outboxSegment{id: id})
+	if len(box.segments) == 1 {
+		box.cursor = outboxPosition{segment: id}
+		box.headAcked = 0
+	}
+
+	return nil
+}
+
+// syncDir makes the creation of a file durable, it is not supported on every platform so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// queueing tells if the outbox holds events, new events must be appended after them to keep the order.
+func (box *outbox) queueing() bool {
+	if box == nil {
+		return false
+	}
+
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	return box.events > 0
+}
+
+// keeps tells if the events of a failed send go to the outbox. Cancellations are returned to the caller.
+func (box *outbox) keeps(ctx context.Context, err error) bool {
+	return box != nil && ctx.Err() == nil && err != ErrMaxDurationElapsed && !errors.Is(err, ErrEventTooLarge)
+}
+
+// enqueue appends the events to the active segment and syncs it to disk.
+func (box *outbox) enqueue(events ...*eventhub.Event) error {
+	var buffer bytes.Buffer
+
+	now := time.Now()
+	for _, event := range events {
+		if err := writeOutboxRecord(&buffer, event, now); err != nil {
+			return err
+		}
+	}
+
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	if box.active == nil {
+		return ErrSenderClosed
+	}
+
+	size := int64(buffer.Len())
+	if size > box.options.MaxSize {
+		return ErrOutboxFull // dropping every event would not make room for it
+	}
+	for box.pendingBytes()+size > box.options.MaxSize {
+		if box.options.Overflow != OverflowDropOldest || box.events == 0 {
+			return ErrOutboxFull
+		}
+		if err := box.dropHead(); err != nil {
+			return err
+		}
+	}
+
+	if active := box.segments[len(box.segments)-1]; active.size > 0 && active.size+size > box.options.SegmentSize {
+		if err := box.rotate(); err != nil {
+			return err
+		}
+		if err := box.advance(); err != nil { // the previous segment may have been sent completely
+			return err
+		}
+	}
+
+	active := box.segments[len(box.segments)-1]
+	if _, err := box.active.Write(buffer.Bytes()); err != nil {
+		box.active.Truncate(active.size)
+		return err
+	}
+	if err := box.active.Sync(); err != nil {
+		return err
+	}
+
+	active.size += size
+	active.events += int64(len(events))
+	box.events += int64(len(events))
+
+	select {
+	case box.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (box *outbox) pendingBytes() int64 {
+	var size int64
+	for _, segment := range box.segments {
+		size += segment.size
+	}
+
+	return size - box.cursor.offset
+}
+
+// dropHead deletes the oldest segment, the active segment is rotated first.
+func (box *outbox) dropHead() error {
+	if len(box.segments) == 1 {
+		if err := box.rotate(); err != nil {
+			return err
+		}
+	}
+
+	head := box.segments[0]
+	lost := head.events - box.headAcked
+	if err := box.removeSegment(head); err != nil {
+		return err
+	}
+
+	box.segments = box.segments[1:]
+	box.cursor = outboxPosition{segment: box.segments[0].id}
+	box.headAcked = 0
+	box.events -= lost
+	box.dropped += lost
+	box.signalChange()
+
+	return box.writeCursor()
+}
+
+// advance deletes the head segment once it has been sent completely, the active segment is kept.
+func (box *outbox) advance() error {
+	for len(box.segments) > 1 && box.cursor.offset >= box.segments[0].size {
+		if err := box.removeSegment(box.segments[0]); err != nil {
+			return err
+		}
+		box.segments = box.segments[1:]
+		box.cursor = outboxPosition{segment: box.segments[0].id}
+		box.headAcked = 0
+	}
+
+	return nil
+}
+
+func (box *outbox) signalChange() {
+	close(box.changed)
+	box.changed = make(chan struct{})
+}
+
+// next reads the events following the cursor which fit in a single batch message, nil when the outbox is empty. A
+// record which cannot be read ends the batch, when it is the first one the head segment is set aside and the error
+// wraps ErrOutboxCorrupted.
+func (box *outbox) next() (*outboxBatch, error) {
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	if err := box.advance(); err != nil {
+		return nil, err
+	}
+	if box.events == 0 {
+		return nil, nil
+	}
+
+	head := box.segments[0]
+	file, err := os.Open(box.segmentPath(head.id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(box.cursor.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	batch := &outboxBatch{end: box.cursor}
+	eventBatch := eventhub.NewEventBatch(uuid.New().String(), nil)
+	reader := bufio.NewReader(io.LimitReader(file, head.size-box.cursor.offset))
+
+	for batch.end.offset < head.size {
+		event, _, size, err := readOutboxRecord(reader)
+		if err != nil {
+			if len(batch.events) > 0 || batch.dropped > 0 {
+				break // the events read are sent first, the next call sets the segment aside
+			}
+			return nil, box.setAside(head, err)
+		}
+
+		if len(batch.events) == 0 {
+			eventBatch.PartitionKey = event.PartitionKey
+		} else if !samePartitionKey(eventBatch.PartitionKey, event.PartitionKey) {
+			break
+		}
+
+		if ok, err := eventBatch.Add(copyForSizing(event)); err != nil {
+			return nil, err
+		} else if !ok {
+			if len(batch.events) > 0 {
+				break
+			}
+			batch.dropped++ // never fits, sending it would block the outbox forever
+		} else {
+			batch.events = append(batch.events, event)
+		}
+
+		batch.end.offset += size
+	}
+
+	return batch, nil
+}
+
+// setAside gives up the records of the head segment from the cursor, the first of them cannot be read. The segment is
+// renamed instead of deleted and the events appended later go to a new segment.
+func (box *outbox) setAside(head *outboxSegment, cause error) error {
+	lost := head.events - box.headAcked
+	head.size = box.cursor.offset
+	head.events = box.headAcked
+	head.corrupted = true
+	box.events -= lost
+	box.dropped += lost
+	box.corrupted++
+	box.signalChange()
+
+	if len(box.segments) == 1 {
+		if err := box.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := box.advance(); err != nil {
+		return err
+	}
+	if err := box.writeCursor(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: segment %d at %d, %d events set aside: %v", ErrOutboxCorrupted, head.id, head.size, lost,
+		cause)
+}
+
+// ack moves the cursor after a batch returned by next once it has been sent.
+func (box *outbox) ack(batch *outboxBatch) error {
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	if batch.end.segment != box.cursor.segment || batch.end.offset <= box.cursor.offset {
+		return nil // the segment has been dropped meanwhile
+	}
+
+	count := int64(len(batch.events)) + batch.dropped
+	box.cursor = batch.end
+	box.headAcked += count
+	box.events -= count
+	box.dropped += batch.dropped
+	box.signalChange()
+
+	if err := box.advance(); err != nil {
+		return err
+	}
+
+	return box.writeCursor()
+}
+
+// oldest returns the time the event at the cursor entered the outbox.
+func (box *outbox) oldest() time.Time {
+	if box.events == 0 || len(box.segments) == 0 {
+		return time.Time{}
+	}
+
+	for _, segment := range box.segments {
+		offset := int64(0)
+		if segment.id == box.cursor.segment {
+			offset = box.cursor.offset
+		}
+		if offset >= segment.size {
+			continue
+		}
+
+		file, err := os.Open(box.segmentPath(segment.id))
+		if err != nil {
+			return time.Time{}
+		}
+		header := make([]byte, outboxRecordHeaderSize)
+		_, err = file.ReadAt(header, offset)
+		file.Close()
+		if err != nil {
+			return time.Time{}
+		}
+
+		return time.Unix(0, int64(binary.BigEndian.Uint64(header[8:])))
+	}
+
+	return time.Time{}
+}
+
+func (box *outbox) stats() OutboxStats {
+	if box == nil {
+		return OutboxStats{}
+	}
+
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	stats := OutboxStats{
+		Events:      box.events,
+		Bytes:       box.pendingBytes(),
+		Segments:    len(box.segments),
+		OldestEvent: box.oldest(),
+		Dropped:     box.dropped,
+		Corrupted:   box.corrupted,
+	}
+	if !stats.OldestEvent.IsZero() {
+		stats.OldestAge = time.Since(stats.OldestEvent)
+	}
+
+	return stats
+}
+
+// waitChange returns a channel closed on the next change and the current number of events.
+func (box *outbox) waitChange() (<-chan struct{}, int64) {
+	if box == nil {
+		return nil, 0
+	}
+
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	return box.changed, box.events
+}
+
+// start runs the drainer until stop is called.
+func (box *outbox) start(sender *Sender) {
+	ctx, cancel := context.WithCancel(context.Background())
+	box.cancel = cancel
+	box.done = make(chan struct{})
+
+	go func() {
+		defer close(box.done)
+		box.drain(ctx, sender)
+	}()
+}
+
+// drain sends the events of the outbox in order, waiting longer after every consecutive failure.
+func (box *outbox) drain(ctx context.Context, sender *Sender) {
+	interval := box.options.RetryInterval
+
+	for {
+		batch, err := box.next()
+		if err == nil && batch == nil {
+			select {
+			case <-box.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err == nil {
+			err = box.send(ctx, sender, batch)
+		}
+		if err == nil {
+			err = box.ack(batch)
+		}
+
+		if err == nil {
+			interval = box.options.RetryInterval
+			continue
+		}
+
+		box.report(err)
+		if errors.Is(err, ErrOutboxCorrupted) {
+			continue // the corrupted segment is set aside, the events after it can be sent
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+		if interval *= 2; interval > box.options.MaxRetryInterval {
+			interval = box.options.MaxRetryInterval
+		}
+	}
+}
+
+// report gives the error to OnError.
+func (box *outbox) report(err error) {
+	if box.options.OnError != nil {
+		box.options.OnError(err)
+	}
+}
+
+func (box *outbox) send(ctx context.Context, sender *Sender, batch *outboxBatch) error {
+	if len(batch.events) == 0 {
+		return nil
+	}
+
+	hub, err := sender.hub()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+	defer cancel()
+
+	return hub.SendBatch(ctx, eventhub.NewEventBatchIterator(batch.events...))
+}
+
+// stop ends the drainer and closes the active segment, the events left are sent by the next sender using the same
+// directory.
+func (box *outbox) stop() {
+	if box == nil {
+		return
+	}
+
+	if box.cancel != nil {
+		box.cancel()
+		<-box.done
+	}
+
+	box.mutex.Lock()
+	defer box.mutex.Unlock()
+
+	if box.active != nil {
+		box.active.Close()
+		box.active = nil
+	}
+}
+
+// writeOutboxRecord appends a record: length, crc32 of the enqueued time and the payload, enqueued time and the json
+// payload.
+func writeOutboxRecord(w io.Writer, event *eventhub.Event, enqueued time.Time) error {
+	record := outboxRecord{Data: event.Data, ID: event.ID, PartitionKey: event.PartitionKey}
+	if len(event.Properties) > 0 {
+		record.Properties = make(map[string]outboxProperty, len(event.Properties))
+		for key, value := range event.Properties {
+			property, err := newOutboxProperty(value)
+			if err != nil {
+				return fmt.Errorf("property %q: %w", key, err)
+			}
+			record.Properties[key] = property
+		}
+	}
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, outboxRecordHeaderSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint64(header[8:], uint64(enqueued.UnixNano()))
+	crc := crc32.NewIEEE()
+	crc.Write(header[8:])
+	crc.Write(payload)
+	binary.BigEndian.PutUint32(header[4:], crc.Sum32())
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+
+	return err
+}
+
+// readOutboxRecord reads the next record and returns the event, its enqueued time and its size on disk.
+func readOutboxRecord(r io.Reader) (*eventhub.Event, time.Time, int64, error) {
+	header := make([]byte, outboxRecordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, time.Time{}, 0, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, time.Time{}, 0, err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[8:])
+	crc.Write(payload)
+	if crc.Sum32() != binary.BigEndian.Uint32(header[4:]) {
+		return nil, time.Time{}, 0, errors.New("checksum mismatch")
+	}
+
+	var record outboxRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return nil, time.Time{}, 0, err
+	}
+
+	event := eventhub.NewEvent(record.Data)
+	event.ID = record.ID
+	event.PartitionKey = record.PartitionKey
+	if len(record.Properties) > 0 {
+		event.Properties = make(map[string]interface{}, len(record.Properties))
+		for key, property := range record.Properties {
+			value, err := property.value()
+			if err != nil {
+				return nil, time.Time{}, 0, fmt.Errorf("property %q: %v", key, err)
+			}
+			event.Properties[key] = value
+		}
+	}
+
+	enqueued := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:])))
+
+	return event, enqueued, int64(len(header) + len(payload)), nil
+}
+
+// newOutboxProperty tags the value with its type, the types of outboxPropertyTypes only.
+func newOutboxProperty(value interface{}) (outboxProperty, error) {
+	if value == nil {
+		return outboxProperty{}, errors.New("nil value cannot be kept in the outbox")
+	}
+
+	name := reflect.TypeOf(value).String()
+	if outboxPropertyTypes[name] != reflect.TypeOf(value) {
+		return outboxProperty{}, fmt.Errorf("type %T cannot be kept in the outbox", value)
+	}
+
+	encoded, err := json.Marshal(value)
+
+	return outboxProperty{Type: name, Value: encoded}, err
+}
+
+func typesByName(values ...interface{}) map[string]reflect.Type {
+	types := make(map[string]reflect.Type, len(values))
+	for _, value := range values {
+		types[reflect.TypeOf(value).String()] = reflect.TypeOf(value)
+	}
+
+	return types
+}
+
+// value returns the property with the type it had before entering the outbox.
+func (property outboxProperty) value() (interface{}, error) {
+	typ, ok := outboxPropertyTypes[property.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", property.Type)
+	}
+
+	value := reflect.New(typ)
+	if err := json.Unmarshal(property.Value, value.Interface()); err != nil {
+		return nil, err
+	}
+
+	return value.Elem().Interface(), nil
+}
@@ -0,0 +1,407 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newOutboxSender(t *testing.T, hub *fakeHub, options OutboxOptions) *Sender {
+	t.Helper()
+
+	sender, _ := newFakeSender(hub)
+	if options.RetryInterval == 0 {
+		options.RetryInterval = 10 * time.Millisecond
+	}
+
+	box, err := openOutbox(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.outbox = box
+	box.start(sender)
+	t.Cleanup(func() { sender.Close(context.Background()) })
+
+	return sender
+}
+
+func (hub *fakeHub) setSendErr(err error) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.sendErr = err
+}
+
+func TestOutbox_Keeps_The_Failed_Events_In_Order(t *testing.T) {
+	hub := &fakeHub{sendErr: errors.New("connection refused")}
+	sender := newOutboxSender(t, hub, OutboxOptions{Dir: t.TempDir()})
+	sender.numberOfMessages = 1
+
+	for i := 0; i < 5; i++ {
+		if err := sender.SendMessage(strconv.Itoa(i), context.Background()); err != nil {
+			t.Fatalf("the failed send should go to the outbox, got %v", err)
+		}
+	}
+
+	stats := sender.OutboxStats()
+	if stats.Events != 5 || stats.Bytes == 0 || stats.OldestEvent.IsZero() {
+		t.Errorf("expected 5 events in the outbox, got %+v", stats)
+	}
+
+	hub.setSendErr(nil)
+	if err := sender.SendMessage("5", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sender.DrainOutbox(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 6 {
+		t.Fatalf("hub should receive 6 events but received %d", hub.sent())
+	}
+	for i, event := range hub.events {
+		if string(event.Data) != strconv.Itoa(i) {
+			t.Errorf("event %d sent out of order: %q", i, event.Data)
+		}
+	}
+	if stats := sender.OutboxStats(); stats.Events != 0 || stats.OldestAge != 0 {
+		t.Errorf("expected an empty outbox, got %+v", stats)
+	}
+}
+
+func TestOutbox_Events_Are_Reported_As_Queued(t *testing.T) {
+	hub := &fakeHub{sendErr: errors.New("connection refused")}
+	sender := newOutboxSender(t, hub, OutboxOptions{Dir: t.TempDir()})
+	sender.numberOfMessages = 1
+
+	var sent, batches int
+	sender.onAfterSendMessage = func(event *eventhub.Event) { sent++ }
+	sender.onAfterSendBatchMessage = func(batchSizeSent int, workerIndex int) { batches++ }
+
+	if err := sender.SendMessage("kept", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	async, err := sender.NewAsyncSender(AsyncOptions{DeliveryBuffer: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		async.Produce(eventhub.NewEvent([]byte("produced")))
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var queued int
+	for report := range async.Deliveries() {
+		if report.Queued && report.Err == nil {
+			queued++
+		}
+	}
+	if queued != 3 || sent != 0 || batches != 0 {
+		t.Errorf("the events in the outbox should be reported as queued, got %d queued, %d sent and %d batches",
+			queued, sent, batches)
+	}
+	if stats := sender.OutboxStats(); stats.Events != 4 {
+		t.Errorf("expected 4 events in the outbox, got %+v", stats)
+	}
+}
+
+func TestOutbox_Recovers_After_Restart(t *testing.T) {
+	dir := t.TempDir()
+
+	box, err := openOutbox(OutboxOptions{Dir: dir, SegmentSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		event := eventhub.NewEvent([]byte("event " + strconv.Itoa(i)))
+		event.Properties = map[string]interface{}{"index": i, "ratio": 0.5}
+		if err := box.enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	batch, err := box.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := box.ack(batch); err != nil {
+		t.Fatal(err)
+	}
+	sent := len(batch.events)
+	box.stop()
+
+	// a crash in the middle of an append leaves a torn record at the end of the last segment
+	ids, _ := box.segmentIDs()
+	file, _ := os.OpenFile(box.segmentPath(ids[len(ids)-1]), os.O_WRONLY|os.O_APPEND, 0600)
+	file.Write([]byte{0, 0, 0, 42, 1, 2})
+	file.Close()
+
+	box, err = openOutbox(OutboxOptions{Dir: dir, SegmentSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.stop()
+
+	if stats := box.stats(); stats.Events != int64(10-sent) || stats.Segments < 2 {
+		t.Fatalf("expected %d events in several segments, got %+v", 10-sent, stats)
+	}
+
+	var events []*eventhub.Event
+	for {
+		batch, err := box.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batch == nil {
+			break
+		}
+		events = append(events, batch.events...)
+		box.ack(batch)
+	}
+
+	for i, event := range events {
+		if string(event.Data) != "event "+strconv.Itoa(sent+i) {
+			t.Errorf("expected event %d but got %q", sent+i, event.Data)
+		}
+		if event.Properties["index"] != sent+i || event.Properties["ratio"] != 0.5 {
+			t.Errorf("properties were not restored: %v", event.Properties)
+		}
+	}
+
+	if err := box.enqueue(eventhub.NewEvent([]byte("after"))); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+outboxSegmentExtension)); len(files) != 1 {
+		t.Errorf("the sent segments should be deleted, found %v", files)
+	}
+}
+
+func TestOutbox_Keeps_The_Property_Types(t *testing.T) {
+	sentAt := time.Date(2024, 2, 1, 10, 30, 0, 123000000, time.UTC)
+	properties := map[string]interface{}{
+		"count": int32(7), "size": uint64(1) << 60, "flag": true, "ratio": float32(0.25),
+		"name": "device-1", "raw": []byte{0, 1, 2}, "sent-at": sentAt,
+	}
+
+	var buffer bytes.Buffer
+	event := eventhub.NewEventFromString("event")
+	event.Properties = properties
+	if err := writeOutboxRecord(&buffer, event, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, _, _, err := readOutboxRecord(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range properties {
+		if key == "sent-at" {
+			if at, ok := replayed.Properties[key].(time.Time); !ok || !at.Equal(sentAt) {
+				t.Errorf("expected %v but got %#v", sentAt, replayed.Properties[key])
+			}
+		} else if !reflect.DeepEqual(replayed.Properties[key], value) {
+			t.Errorf("expected %#v for %s but got %#v", value, key, replayed.Properties[key])
+		}
+	}
+
+	event.Properties = map[string]interface{}{"point": struct{ X int }{1}}
+	if err := writeOutboxRecord(&buffer, event, time.Now()); err == nil {
+		t.Error("expected an error for a property type the outbox cannot restore")
+	}
+}
+
+func TestOutbox_Overflow(t *testing.T) {
+	event := eventhub.NewEvent([]byte("0123456789"))
+
+	box, err := openOutbox(OutboxOptions{Dir: t.TempDir(), MaxSize: 300, SegmentSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.stop()
+
+	var full error
+	for i := 0; i < 20 && full == nil; i++ {
+		full = box.enqueue(event)
+	}
+	if !errors.Is(full, ErrOutboxFull) {
+		t.Errorf("expected ErrOutboxFull but got %v", full)
+	}
+
+	box, err = openOutbox(OutboxOptions{Dir: t.TempDir(), MaxSize: 300, SegmentSize: 100, Overflow: OverflowDropOldest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.stop()
+
+	for i := 0; i < 20; i++ {
+		if err := box.enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := box.stats()
+	if stats.Dropped == 0 || stats.Bytes > 300 || stats.Events+stats.Dropped != 20 {
+		t.Errorf("expected the oldest events to be dropped, got %+v", stats)
+	}
+	before := box.stats()
+	if err := box.enqueue(eventhub.NewEvent(make([]byte, 400))); !errors.Is(err, ErrOutboxFull) {
+		t.Errorf("expected ErrOutboxFull for an event larger than the outbox but got %v", err)
+	}
+	if after := box.stats(); after.Events != before.Events || after.Dropped != before.Dropped {
+		t.Errorf("an event larger than the outbox should not drop the others, got %+v then %+v", before, after)
+	}
+}
+
+// corruptOutboxRecord flips a byte of the payload of the record at index in the segment file.
+func corruptOutboxRecord(t *testing.T, box *outbox, id int64, index int) {
+	t.Helper()
+
+	path := box.segmentPath(id)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bytes.NewReader(content)
+	var offset int64
+	for i := 0; i < index; i++ {
+		_, _, size, err := readOutboxRecord(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += size
+	}
+	content[offset+outboxRecordHeaderSize] ^= 0xff
+
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutbox_Sets_Aside_A_Corrupted_Segment(t *testing.T) {
+	dir := t.TempDir()
+	hub := &fakeHub{sendErr: errors.New("connection refused")}
+
+	var mutex sync.Mutex
+	var reported []error
+	sender := newOutboxSender(t, hub, OutboxOptions{Dir: dir, OnError: func(err error) {
+		mutex.Lock()
+		reported = append(reported, err)
+		mutex.Unlock()
+	}})
+	sender.numberOfMessages = 1
+
+	for i := 0; i < 3; i++ {
+		if err := sender.SendMessage(strconv.Itoa(i), context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sender.outbox.mutex.Lock()
+	corruptOutboxRecord(t, sender.outbox, sender.outbox.segments[0].id, 1)
+	sender.outbox.mutex.Unlock()
+	hub.setSendErr(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sender.DrainOutbox(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendMessage("3", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.DrainOutbox(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 2 || string(hub.events[0].Data) != "0" || string(hub.events[1].Data) != "3" {
+		t.Errorf("the events before and after the corrupted segment should be sent, got %d events", hub.sent())
+	}
+	if stats := sender.OutboxStats(); stats.Corrupted != 1 || stats.Dropped != 2 || stats.Events != 0 {
+		t.Errorf("expected a corrupted segment holding 2 events, got %+v", stats)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+outboxCorruptedExtension)); len(files) != 1 {
+		t.Errorf("the corrupted segment should be kept aside, found %v", files)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	var corrupted int
+	for _, err := range reported {
+		if errors.Is(err, ErrOutboxCorrupted) {
+			corrupted++
+		}
+	}
+	if corrupted != 1 {
+		t.Errorf("the corrupted record should be reported once, got %v", reported)
+	}
+}
+
+func TestOutbox_Reports_A_Corrupted_Segment_On_Restart(t *testing.T) {
+	dir := t.TempDir()
+
+	box, err := openOutbox(OutboxOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := box.enqueue(eventhub.NewEvent([]byte(strconv.Itoa(i)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := box.segments[0].id
+	box.stop()
+	corruptOutboxRecord(t, box, id, 1)
+
+	var reported []error
+	box, err = openOutbox(OutboxOptions{Dir: dir, OnError: func(err error) { reported = append(reported, err) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer box.stop()
+
+	if len(reported) != 1 || !errors.Is(reported[0], ErrOutboxCorrupted) {
+		t.Fatalf("expected the corrupted segment to be reported, got %v", reported)
+	}
+	if err := box.enqueue(eventhub.NewEvent([]byte("after"))); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for {
+		batch, err := box.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batch == nil {
+			break
+		}
+		for _, event := range batch.events {
+			events = append(events, string(event.Data))
+		}
+		box.ack(batch)
+	}
+
+	if strings.Join(events, ",") != "0,after" {
+		t.Errorf("the record after the corrupted one should not be truncated into the new events, got %v", events)
+	}
+	if stats := box.stats(); stats.Corrupted != 1 || stats.Events != 0 {
+		t.Errorf("expected an empty outbox with a corrupted segment, got %+v", stats)
+	}
+}
@@ -0,0 +1,160 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/google/uuid"
+	"math"
+)
+
+// ErrEventTooLarge is the error wrapped by EventTooLargeError, use errors.Is to check for it.
+var ErrEventTooLarge = errors.New("event exceeds the maximum batch size")
+
+// EventTooLargeError is returned when a single event does not fit in an empty batch.
+type EventTooLargeError struct {
+	Index   int64 // position of the event in the sequence being packed
+	Size    int   // encoded size of the event in bytes
+	MaxSize int   // maximum size of a batch in bytes
+}
+
+func (e *EventTooLargeError) Error() string {
+	return fmt.Sprintf("event %d has %d bytes encoded and exceeds the maximum batch size of %d bytes",
+		e.Index, e.Size, e.MaxSize)
+}
+
+func (e *EventTooLargeError) Unwrap() error {
+	return ErrEventTooLarge
+}
+
+// packedBatch is a sequence of events which fits in a single event hubs batch message.
+type packedBatch struct {
+	events []*eventhub.Event
+	size   int // encoded size of the batch message in bytes
+}
+
+// batchPacker adds events one by one to an event hubs batch, tracking the real encoded size. A batch is closed
+// exactly when the next event would overflow the max size, events with different partition keys never share a batch.
+type batchPacker struct {
+	maxSize eventhub.MaxMessageSizeInBytes
+	batch   *eventhub.EventBatch
+	events  []*eventhub.Event
+	index   int64
+}
+
+func newBatchPacker(maxSize eventhub.MaxMessageSizeInBytes) *batchPacker {
+	if maxSize == 0 {
+		maxSize = eventhub.DefaultMaxMessageSizeInBytes
+	}
+
+	return &batchPacker{maxSize: maxSize}
+}
+
+// add appends the event to the open batch. When the event closes the open batch, the closed batch is returned.
+func (packer *batchPacker) add(event *eventhub.Event) (*packedBatch, error) {
+	var closed *packedBatch
+	index := packer.index
+	packer.index++
+
+	if packer.batch != nil && !samePartitionKey(packer.batch.PartitionKey, event.PartitionKey) {
+		closed = packer.flush()
+	}
+
+	if packer.batch == nil {
+		packer.open(event)
+	}
+
+	ok, err := packer.batch.Add(copyForSizing(event))
+	if err != nil {
+		return closed, err
+	}
+
+	if !ok {
+		if len(packer.events) == 0 {
+			packer.batch = nil
+			return closed, &EventTooLargeError{Index: index, Size: encodedSize(event), MaxSize: int(packer.maxSize)}
+		}
+
+		closed = packer.flush()
+		packer.open(event)
+
+		if ok, err = packer.batch.Add(copyForSizing(event)); err != nil {
+			return closed, err
+		} else if !ok {
+			packer.batch = nil
+			return closed, &EventTooLargeError{Index: index, Size: encodedSize(event), MaxSize: int(packer.maxSize)}
+		}
+	}
+
+	packer.events = append(packer.events, event)
+
+	return closed, nil
+}
+
+// flush closes the open batch and returns it, nil when there is nothing buffered.
+func (packer *batchPacker) flush() *packedBatch {
+	if packer.batch == nil || len(packer.events) == 0 {
+		packer.batch = nil
+		return nil
+	}
+
+	batch := &packedBatch{events: packer.events, size: packer.batch.Size()}
+	packer.batch = nil
+	packer.events = nil
+
+	return batch
+}
+
+func (packer *batchPacker) open(event *eventhub.Event) {
+	packer.batch = eventhub.NewEventBatch(uuid.New().String(), &eventhub.BatchOptions{MaxSize: packer.maxSize})
+	packer.batch.PartitionKey = event.PartitionKey
+	packer.events = nil
+}
+
+// packEvents splits events into batches using the real encoded size of every event.
+func packEvents(events []*eventhub.Event, maxSize eventhub.MaxMessageSizeInBytes) ([]*packedBatch, error) {
+	var batches []*packedBatch
+	packer := newBatchPacker(maxSize)
+
+	for _, event := range events {
+		batch, err := packer.add(event)
+		if batch != nil {
+			batches = append(batches, batch)
+		}
+		if err != nil {
+			return batches, err
+		}
+	}
+
+	if batch := packer.flush(); batch != nil {
+		batches = append(batches, batch)
+	}
+
+	return batches, nil
+}
+
+// copyForSizing returns a shallow copy of the event, EventBatch.Add overwrites the partition key of the added event.
+func copyForSizing(event *eventhub.Event) *eventhub.Event {
+	eventCopy := *event
+	return &eventCopy
+}
+
+// encodedSize returns the number of bytes the event takes inside a batch message.
+func encodedSize(event *eventhub.Event) int {
+	eb := eventhub.NewEventBatch(uuid.New().String(), &eventhub.BatchOptions{MaxSize: math.MaxInt32})
+	sizeBeforeEvent := eb.Size()
+
+	if _, err := eb.Add(copyForSizing(event)); err != nil {
+		return 0
+	}
+
+	return eb.Size() - sizeBeforeEvent
+}
+
+func samePartitionKey(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return *a == *b
+}
@@ -0,0 +1,139 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+)
+
+func TestPackEvents_Mixed_Sizes_Fill_The_Batches(t *testing.T) {
+	var events []*eventhub.Event
+	for i := 0; i < 200; i++ {
+		size := 100
+		if i%50 == 0 {
+			size = 200000
+		}
+		events = append(events, eventhub.NewEvent([]byte(strings.Repeat("a", size))))
+	}
+
+	batches, err := packEvents(events, eventhub.DefaultMaxMessageSizeInBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 4 big events + 196 small ones hold in a single batch, estimating by the biggest event would create 5
+	if len(batches) != 1 {
+		t.Errorf("events should be packed in 1 batch but were packed in %v", len(batches))
+	}
+	if batches[0].size > int(eventhub.DefaultMaxMessageSizeInBytes) {
+		t.Errorf("batch size %v is bigger than the max size", batches[0].size)
+	}
+}
+
+func TestPackEvents_Starts_A_New_Batch_On_Overflow(t *testing.T) {
+	var events []*eventhub.Event
+	for i := 0; i < 30; i++ {
+		events = append(events, eventhub.NewEvent([]byte(strings.Repeat("a", 100000))))
+	}
+
+	batches, err := packEvents(events, eventhub.DefaultMaxMessageSizeInBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var count int
+	for i, batch := range batches {
+		count += len(batch.events)
+		if batch.size > int(eventhub.DefaultMaxMessageSizeInBytes) {
+			t.Errorf("batch %v has %v bytes and overflows the max size", i, batch.size)
+		}
+		if i < len(batches)-1 && batch.size+encodedSize(events[0]) <= int(eventhub.DefaultMaxMessageSizeInBytes) {
+			t.Errorf("batch %v was closed while the next event still fits", i)
+		}
+	}
+	if count != 30 || len(batches) != 4 {
+		t.Errorf("expected 30 events in 4 batches but got %v events in %v batches", count, len(batches))
+	}
+}
+
+func TestPackEvents_Event_Too_Large(t *testing.T) {
+	events := []*eventhub.Event{
+		eventhub.NewEvent([]byte("small")),
+		eventhub.NewEvent([]byte(strings.Repeat("a", 1100000))),
+	}
+
+	_, err := packEvents(events, eventhub.DefaultMaxMessageSizeInBytes)
+
+	var tooLarge *EventTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrEventTooLarge) {
+		t.Fatalf("expected EventTooLargeError but got %v", err)
+	}
+	if tooLarge.Index != 1 || tooLarge.Size < 1100000 {
+		t.Errorf("error should report the event index and size, got %v", tooLarge)
+	}
+}
+
+func TestPackEvents_Splits_By_PartitionKey(t *testing.T) {
+	keyA, keyB := "a", "b"
+	events := []*eventhub.Event{
+		{Data: []byte("1"), PartitionKey: &keyA},
+		{Data: []byte("2"), PartitionKey: &keyA},
+		{Data: []byte("3"), PartitionKey: &keyB},
+	}
+
+	batches, _ := packEvents(events, eventhub.DefaultMaxMessageSizeInBytes)
+
+	if len(batches) != 2 || len(batches[0].events) != 2 {
+		t.Errorf("events with different partition keys should not share a batch")
+	}
+	if events[2].PartitionKey == nil || *events[2].PartitionKey != "b" {
+		t.Error("packing should not change the event partition key")
+	}
+}
+
+func TestSender_SendEventsAsBatch_Cycles_The_Events(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 10
+	sender.workers = 2
+
+	events := []*eventhub.Event{eventhub.NewEvent([]byte("1")), eventhub.NewEvent([]byte("2")), eventhub.NewEvent([]byte("3"))}
+	if err := sender.SendEventsAsBatch(context.Background(), &events); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hub.sent() != 10 {
+		t.Errorf("hub should receive 10 events but received %v", hub.sent())
+	}
+}
+
+func TestSender_SendEventsAsBatch_Event_Too_Large(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+
+	events := []*eventhub.Event{eventhub.NewEvent([]byte(strings.Repeat("a", 1100000)))}
+	if err := sender.SendEventsAsBatch(context.Background(), &events); !errors.Is(err, ErrEventTooLarge) {
+		t.Errorf("expected ErrEventTooLarge but got %v", err)
+	}
+	if hub.sent() != 0 {
+		t.Error("nothing should be sent")
+	}
+}
+
+func TestSender_SendBatchMessage_Message_Too_Large(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 3
+	message := strings.Repeat("a", 2*1024*1024)
+
+	if err := sender.SendBatchMessage(message, context.Background()); !errors.Is(err, ErrEventTooLarge) {
+		t.Errorf("expected ErrEventTooLarge from the send but got %v", err)
+	}
+	if _, err := sender.Plan(context.Background(), message); !errors.Is(err, ErrEventTooLarge) {
+		t.Errorf("expected ErrEventTooLarge from the plan but got %v", err)
+	}
+	if hub.sent() != 0 {
+		t.Error("nothing should be sent")
+	}
+}
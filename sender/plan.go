@@ -0,0 +1,136 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"github.com/google/uuid"
+	"math"
+	"strings"
+)
+
+type (
+	// SendPlan describes what SendBatchMessage would send, it is built without connecting to event hubs.
+	SendPlan struct {
+		TotalEvents   int64        `json:"totalEvents"`
+		TotalBytes    int64        `json:"totalBytes"`    // estimated size of all the batch messages
+		Batches       int          `json:"batches"`       // number of batch messages
+		Workers       int          `json:"workers"`       // number of go routines sending the batches
+		BatchLimit    int          `json:"batchLimit"`    // events per batch, 0 when the events are packed by their own size
+		MaxBatchBytes int          `json:"maxBatchBytes"` // max size of a batch message
+		WorkerPlans   []WorkerPlan `json:"workerPlans"`
+		BatchPlans    []BatchPlan  `json:"batchPlans"`
+	}
+
+	// WorkerPlan is the share of a single worker in a SendPlan.
+	WorkerPlan struct {
+		Worker  int   `json:"worker"`
+		Batches int   `json:"batches"`
+		Events  int64 `json:"events"`
+		Bytes   int64 `json:"bytes"`
+	}
+
+	// BatchPlan describes a single batch message, in the order the worker sends them.
+	BatchPlan struct {
+		Worker int `json:"worker"`
+		Index  int `json:"index"` // position of the batch in the queue of the worker
+		Events int `json:"events"`
+		Bytes  int `json:"bytes"` // estimated size of the batch message
+		// PartitionKey of the events of the batch, event hubs hashes it to pick the partition. Empty when event hubs
+		// spreads the batches over the partitions. A batch has no partition id: the ids set with AddPartitionId are
+		// not used by the sends, so they are not part of the plan.
+		PartitionKey string `json:"partitionKey,omitempty"`
+	}
+)
+
+// Plan(ctx context.Context, message string) returns what SendBatchMessage(message, ctx) would send: the batches, the
+// events and the estimated bytes of every batch, the worker each batch is assigned to and its partition key. Nothing
+// is sent and the sender does not connect. Events are created as they would be for the send, from copies of the
+// random source, of a SchemaGenerator and of IDFromSequence, so a seeded send after the plan creates the same events
+// as without it. The interceptors, the OnBeforeSendMessage handler, the property providers and the other payload
+// generators are called as for the send, they see the planned events. The payloads are neither encrypted nor stored
+// by the claim check, the events are given the size they would have. The plan does not tell the partition of the
+// batches, only their partition key: event hubs picks the partition and the ids of AddPartitionId are ignored.
+func (sender *Sender) Plan(ctx context.Context, message string) (*SendPlan, error) {
+	numGoRoutines := sender.workerCount()
+	eventBatches, limit, err := sender.createBatches(ctx, message, numGoRoutines, true)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SendPlan{
+		Workers:       numGoRoutines,
+		BatchLimit:    limit,
+		MaxBatchBytes: int(eventhub.DefaultMaxMessageSizeInBytes),
+	}
+
+	for worker := 0; worker < numGoRoutines; worker++ {
+		list := eventBatches[worker]
+		if list == nil {
+			continue
+		}
+
+		workerPlan := WorkerPlan{Worker: worker}
+		for index := 0; index < list.Size(); index++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			events, _ := list.Get(index)
+			batch := BatchPlan{Worker: worker, Index: index, Events: len(events), Bytes: batchSize(events)}
+			if len(events) > 0 && events[0].PartitionKey != nil {
+				batch.PartitionKey = *events[0].PartitionKey
+			}
+
+			plan.BatchPlans = append(plan.BatchPlans, batch)
+			workerPlan.Batches++
+			workerPlan.Events += int64(batch.Events)
+			workerPlan.Bytes += int64(batch.Bytes)
+		}
+
+		plan.WorkerPlans = append(plan.WorkerPlans, workerPlan)
+		plan.Batches += workerPlan.Batches
+		plan.TotalEvents += workerPlan.Events
+		plan.TotalBytes += workerPlan.Bytes
+	}
+
+	return plan, nil
+}
+
+// batchSize returns the size of the batch message holding the events.
+func batchSize(events []*eventhub.Event) int {
+	eb := eventhub.NewEventBatch(uuid.New().String(), &eventhub.BatchOptions{MaxSize: math.MaxInt32})
+	for _, event := range events {
+		if _, err := eb.Add(copyForSizing(event)); err != nil {
+			return 0
+		}
+	}
+
+	return eb.Size()
+}
+
+// String returns the plan formatted as text, one line per worker.
+func (plan *SendPlan) String() string {
+	var sb strings.Builder
+
+	limit := "packed by size"
+	if plan.BatchLimit > 0 {
+		limit = fmt.Sprintf("%d events per batch", plan.BatchLimit)
+	}
+
+	sb.WriteString(fmt.Sprintf("events: %d, batches: %d (%s, max %d bytes), estimated bytes: %d, workers: %d\n",
+		plan.TotalEvents, plan.Batches, limit, plan.MaxBatchBytes, plan.TotalBytes, plan.Workers))
+
+	for _, worker := range plan.WorkerPlans {
+		sb.WriteString(fmt.Sprintf("worker %d: batches: %d, events: %d, bytes: %d\n", worker.Worker, worker.Batches,
+			worker.Events, worker.Bytes))
+	}
+
+	return sb.String()
+}
+
+// JSON returns the plan formatted as indented JSON.
+func (plan *SendPlan) JSON() ([]byte, error) {
+	return json.MarshalIndent(plan, "", "  ")
+}
@@ -0,0 +1,112 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSender_Plan(t *testing.T) {
+	sender, connections := newFakeSender(&fakeHub{})
+	sender.numberOfMessages = 20000
+	sender.workers = 3
+
+	plan, err := sender.Plan(context.Background(), strings.Repeat("a", 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *connections != 0 {
+		t.Error("the plan should not connect to event hubs")
+	}
+	if plan.TotalEvents != 20000 || plan.Workers != 3 || plan.BatchLimit == 0 || plan.Batches != len(plan.BatchPlans) {
+		t.Errorf("unexpected plan %s", plan)
+	}
+
+	var events int64
+	for _, batch := range plan.BatchPlans {
+		if batch.Bytes <= 0 || batch.Bytes > plan.MaxBatchBytes || batch.Events > plan.BatchLimit {
+			t.Errorf("batch %d of worker %d does not fit: %d events, %d bytes", batch.Index, batch.Worker,
+				batch.Events, batch.Bytes)
+		}
+		events += int64(batch.Events)
+	}
+	if events != plan.TotalEvents || len(plan.WorkerPlans) != 3 {
+		t.Errorf("the batches hold %d events spread on %d workers", events, len(plan.WorkerPlans))
+	}
+
+	content, err := plan.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["totalEvents"] != float64(20000) || len(decoded["batchPlans"].([]interface{})) != plan.Batches {
+		t.Errorf("unexpected json %s", content)
+	}
+}
+
+func TestSender_Plan_Packed_Events(t *testing.T) {
+	sender, _ := newFakeSender(&fakeHub{})
+	sender.numberOfMessages = 100
+	sender.workers = 2
+	sender.template = true
+
+	plan, err := sender.Plan(context.Background(), `{"value": "{{randString 20000}}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.BatchLimit != 0 || plan.TotalEvents != 100 || plan.Batches < 2 {
+		t.Errorf("expected the events to be packed in several batches, got %s", plan)
+	}
+}
+
+// plannedSend sends with a seeded sender, planning the send first when plan is true, and returns the sorted ids,
+// bodies and properties of the events.
+func plannedSend(t *testing.T, plan bool) []string {
+	schema := []byte(`{"type": "object", "properties": {"value": {"type": "integer"}, "ref": {"format": "uuid"}}}`)
+	generator, err := NewSchemaGenerator(schema, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := &fakeHub{}
+	sender, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(50).SetWorkers(4).
+		SetTemplate(true).SetRandomMessageSuffix(true).AddProperty("site:{{pick \"a\" \"b\" \"c\"}}").
+		SetPayloadGenerator(generator).SetIDStrategy(IDFromSequence(1)).SetRandomSeed(7).GetSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	if plan {
+		if _, err := sender.Plan(context.Background(), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.SendBatchMessage("", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make([]string, 0, len(hub.events))
+	for _, event := range hub.events {
+		events = append(events, event.ID+" "+string(event.Data)+" "+event.Properties["site"].(string))
+	}
+	sort.Strings(events)
+
+	return events
+}
+
+func TestSender_Plan_Leaves_The_Send_Unchanged(t *testing.T) {
+	planned := plannedSend(t, true)
+	sent := plannedSend(t, false)
+
+	if len(sent) != 50 || strings.Join(planned, "\n") != strings.Join(sent, "\n") {
+		t.Errorf("a seeded send should create the same events with or without a plan before it")
+	}
+}
@@ -0,0 +1,62 @@
+package sender
+
+import (
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"os"
+	"time"
+)
+
+type (
+	// PropertyProvider returns the value of a property for the event at index of the send, nil leaves the property
+	// unset. It is called with the body and the static properties already set.
+	PropertyProvider func(index int64, event *eventhub.Event) interface{}
+
+	// propertyProvider is a PropertyProvider with the key of its property.
+	propertyProvider struct {
+		key     string
+		provide PropertyProvider
+	}
+)
+
+// CreatedAtProvider() returns a PropertyProvider giving the time the event is created, in RFC3339 with nanoseconds.
+// It is not the time the event is sent: the batch sends create every event before the first batch is sent, and the
+// value must be set before the event is signed and packed.
+func CreatedAtProvider() PropertyProvider {
+	return func(index int64, event *eventhub.Event) interface{} {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// SequenceProvider(start int64) returns a PropertyProvider giving start plus the index of the event in the send.
+func SequenceProvider(start int64) PropertyProvider {
+	return func(index int64, event *eventhub.Event) interface{} {
+		return start + index
+	}
+}
+
+// HostNameProvider() returns a PropertyProvider giving the host name of the machine sending the event.
+func HostNameProvider() PropertyProvider {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return func(index int64, event *eventhub.Event) interface{} {
+		return host
+	}
+}
+
+// provideProperties sets the properties given by the providers of the sender on the event.
+func (sender *Sender) provideProperties(index int64, event *eventhub.Event) {
+	for _, provider := range sender.propertyProviders {
+		value := provider.provide(index, event)
+		if value == nil {
+			continue
+		}
+
+		if event.Properties == nil {
+			event.Properties = make(map[string]interface{})
+		}
+		event.Properties[provider.key] = value
+	}
+}
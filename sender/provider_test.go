@@ -0,0 +1,76 @@
+package sender
+
+import (
+	"context"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSender_Property_Providers_Per_Event(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(5).
+		AddProperty("static:value").
+		AddPropertyProvider("createdAt", CreatedAtProvider()).
+		AddPropertyProvider("sequence", SequenceProvider(100)).
+		AddPropertyProvider("host", HostNameProvider()).
+		AddPropertyProvider("length", func(index int64, event *eventhub.Event) interface{} {
+			if index == 0 {
+				return nil
+			}
+			return len(event.Data)
+		}).
+		GetSender()
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	if err := sender.SendMessage("message", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, event := range hub.events {
+		if event.Properties["static"] != "value" || event.Properties["sequence"] != int64(100+i) ||
+			event.Properties["host"] == "" {
+			t.Errorf("unexpected properties %v", event.Properties)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, event.Properties["createdAt"].(string)); err != nil {
+			t.Errorf("invalid createdAt: %v", err)
+		}
+		if _, ok := event.Properties["length"]; ok != (i > 0) {
+			t.Errorf("a nil value should leave the property unset, event %d: %v", i, event.Properties)
+		}
+	}
+}
+
+func TestSender_SendBatchMessage_Property_Values_Growing(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 400
+	sender.workers = 2
+	// the values grow with the index, a limit calculated on the first event would overflow the batches
+	sender.propertyProviders = []propertyProvider{{key: "padding", provide: func(index int64, event *eventhub.Event) interface{} {
+		return strings.Repeat("x", int(index)*30)
+	}}}
+
+	plan, err := sender.Plan(context.Background(), "message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range plan.BatchPlans {
+		if batch.Bytes > plan.MaxBatchBytes {
+			t.Errorf("batch %d of worker %d is %d bytes, over the max of %d", batch.Index, batch.Worker, batch.Bytes,
+				plan.MaxBatchBytes)
+		}
+	}
+
+	if err := sender.SendBatchMessage("message", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 400 {
+		t.Errorf("expected 400 events sent but got %d", hub.sent())
+	}
+	if plan.Batches < 3 || hub.batches != plan.Batches {
+		t.Errorf("expected the events spread over the %d planned batches but got %d", plan.Batches, hub.batches)
+	}
+}
@@ -0,0 +1,157 @@
+package sender
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// seededGenerator is a PayloadGenerator which can be seeded by SetRandomSeed.
+type seededGenerator interface {
+	Seed(seed int64)
+}
+
+// clonedGenerator is a PayloadGenerator which can be copied in its current state, Plan generates the payloads from a
+// copy so the send after it generates the same ones.
+type clonedGenerator interface {
+	clone() PayloadGenerator
+}
+
+type (
+	// randomSource is a seeded math/rand source safe to be used by the workers, the random content of a sender comes
+	// from it so the same seed creates the same content. A nil randomSource uses the global source of math/rand.
+	randomSource struct {
+		mutex  sync.Mutex
+		random *rand.Rand
+		source *replayableSource
+		seed   int64
+	}
+
+	// replayableSource is a math/rand source counting its draws, a copy in the same state is created by replaying
+	// them from the seed since math/rand sources cannot be copied.
+	replayableSource struct {
+		source rand.Source64
+		seed   int64
+		draws  uint64
+	}
+)
+
+// SetRandomSeed(seed int64) seeds the random content of the sender: the message suffix, the random placeholders of
+// the templates and of IDFromTemplate and the payload generators having a Seed(int64) method, as SchemaGenerator.
+// The same seed creates the same content, so a load test can be run again with the same data. Without it the seed is
+// taken from the clock and the generators keep their own seed. The seed is recorded in the SendReport. The ids of
+// IDFromUUID stay random.
+func (builder *Builder) SetRandomSeed(seed int64) ISenderBuilder {
+	builder.randomSeed = &seed
+
+	return builder
+}
+
+func newRandomSource(seed int64) *randomSource {
+	source := newReplayableSource(seed)
+
+	return &randomSource{random: rand.New(source), source: source, seed: seed}
+}
+
+// clone returns a source in the same state, drawing from it leaves the original untouched. The clone of the global
+// source is the global source.
+func (source *randomSource) clone() *randomSource {
+	if source == nil {
+		return nil
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	replayed := source.source.clone()
+
+	return &randomSource{random: rand.New(replayed), source: replayed, seed: source.seed}
+}
+
+func (source *randomSource) Intn(n int) int {
+	if source == nil {
+		return rand.Intn(n)
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	return source.random.Intn(n)
+}
+
+func (source *randomSource) Int63n(n int64) int64 {
+	if source == nil {
+		return rand.Int63n(n)
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	return source.random.Int63n(n)
+}
+
+// Read fills p with random bytes, it makes the source an io.Reader for uuid.NewRandomFromReader. Unlike rand.Read
+// it keeps no bytes from one call to the next, so the state of the source is only its draws.
+func (source *randomSource) Read(p []byte) (int, error) {
+	if source == nil {
+		return rand.Read(p)
+	}
+
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	readBytes(source.random, p)
+
+	return len(p), nil
+}
+
+// Seed returns the seed of the source, 0 for the global source.
+func (source *randomSource) Seed() int64 {
+	if source == nil {
+		return 0
+	}
+
+	return source.seed
+}
+
+func newReplayableSource(seed int64) *replayableSource {
+	return &replayableSource{source: rand.NewSource(seed).(rand.Source64), seed: seed}
+}
+
+func (source *replayableSource) Int63() int64 {
+	source.draws++
+
+	return source.source.Int63()
+}
+
+func (source *replayableSource) Uint64() uint64 {
+	source.draws++
+
+	return source.source.Uint64()
+}
+
+func (source *replayableSource) Seed(seed int64) {
+	source.source.Seed(seed)
+	source.seed = seed
+	source.draws = 0
+}
+
+// clone replays the draws on a new source with the same seed.
+func (source *replayableSource) clone() *replayableSource {
+	result := newReplayableSource(source.seed)
+	for result.draws < source.draws {
+		result.Int63()
+	}
+
+	return result
+}
+
+// readBytes fills p from random without the buffering of rand.Read.
+func readBytes(random *rand.Rand, p []byte) {
+	for i := 0; i < len(p); i += 7 {
+		value := random.Int63()
+		for j := i; j < i+7 && j < len(p); j++ {
+			p[j] = byte(value)
+			value >>= 8
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package sender
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// seededPayloads sends the message with the seed and returns the sorted bodies and properties of the events.
+func seededPayloads(t *testing.T, seed int64, generator PayloadGenerator) []string {
+	hub := &fakeHub{}
+	builder := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(50).SetWorkers(4).
+		SetTemplate(true).SetRandomMessageSuffix(true).AddProperty("site:{{pick \"a\" \"b\" \"c\"}}").
+		SetRandomSeed(seed)
+	if generator != nil {
+		builder.SetPayloadGenerator(generator)
+	}
+	sender, err := builder.GetSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	report, err := sender.SendBatchMessageWithReport(
+		`{"id": "{{uuid}}", "value": {{randInt 1 1000}}, "code": "{{randString 8}}"}`, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RandomSeed != seed || !strings.Contains(report.String(), "random seed: ") {
+		t.Errorf("the report should record the seed %d, got %d", seed, report.RandomSeed)
+	}
+
+	payloads := make([]string, 0, len(hub.events))
+	for _, event := range hub.events {
+		payloads = append(payloads, string(event.Data)+" "+event.Properties["site"].(string))
+	}
+	sort.Strings(payloads)
+
+	return payloads
+}
+
+func TestSender_SetRandomSeed_Reproduces_The_Content(t *testing.T) {
+	first := seededPayloads(t, 7, nil)
+	second := seededPayloads(t, 7, nil)
+	other := seededPayloads(t, 8, nil)
+
+	if len(first) != 50 || strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Error("the same seed should send the same content")
+	}
+	if strings.Join(first, "\n") == strings.Join(other, "\n") {
+		t.Error("another seed should send other content")
+	}
+}
+
+func TestSender_SetRandomSeed_Seeds_The_Generator(t *testing.T) {
+	schema := []byte(`{"type": "object", "properties": {"value": {"type": "integer"}, "name": {"type": "string"}}}`)
+	first, _ := NewSchemaGenerator(schema, 1)
+	second, _ := NewSchemaGenerator(schema, 2)
+
+	if strings.Join(seededPayloads(t, 7, first), "\n") != strings.Join(seededPayloads(t, 7, second), "\n") {
+		t.Error("the seed of the sender should replace the seed of the generator")
+	}
+}
+
+func TestRandomSource_Is_Safe_For_Workers(t *testing.T) {
+	random := newRandomSource(7)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				saltRandString(random, 4)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if random.Seed() != 7 {
+		t.Errorf("unexpected seed %d", random.Seed())
+	}
+}
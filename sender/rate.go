@@ -0,0 +1,306 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	rateBurst          = time.Second            // tokens never accumulate for more than one second of the target rate
+	rateChunk          = 100 * time.Millisecond // with a rate limit a batch holds at most the events of this interval
+	rateMaxWait        = 100 * time.Millisecond // the target rate is checked again at least this often while waiting
+	rateReportInterval = time.Second
+)
+
+// ErrMaxDurationElapsed stops a rate limited send when RateLimit.MaxDuration is reached. It is not an error for the
+// caller of the send methods, they return nil. The AsyncSender reports it for the events left unsent.
+var ErrMaxDurationElapsed = errors.New("rate limit max duration elapsed")
+
+type (
+	// RateProfile returns the target rate, per second, for the time elapsed since the send started.
+	RateProfile func(elapsed time.Duration) float64
+
+	// RateLimit configures a rate limited send. EventsPerSecond and BytesPerSecond can be used together, the slowest
+	// one wins. Bytes are the bytes of the event payload (event.Data).
+	RateLimit struct {
+		EventsPerSecond RateProfile
+		BytesPerSecond  RateProfile
+		MaxDuration     time.Duration // the send stops, without error, when it is reached. Zero means no limit
+	}
+
+	// RateStats is delivered periodically to the handler registered with SetOnRateReport.
+	RateStats struct {
+		Elapsed                 time.Duration
+		TargetEventsPerSecond   float64
+		AchievedEventsPerSecond float64
+		TargetBytesPerSecond    float64
+		AchievedBytesPerSecond  float64
+		TotalEvents             int64
+		TotalBytes              int64
+	}
+)
+
+// ConstantRate(rate float64) keeps the same target rate during the whole send.
+func ConstantRate(rate float64) RateProfile {
+	return func(elapsed time.Duration) float64 {
+		return rate
+	}
+}
+
+// LinearRamp(from float64, to float64, over time.Duration) moves the target rate linearly from "from" to "to" during
+// the "over" interval and keeps "to" afterwards.
+func LinearRamp(from float64, to float64, over time.Duration) RateProfile {
+	return func(elapsed time.Duration) float64 {
+		if over <= 0 || elapsed >= over {
+			return to
+		}
+
+		return from + (to-from)*float64(elapsed)/float64(over)
+	}
+}
+
+// StepRamp(from float64, to float64, step float64, every time.Duration) starts with "from" and moves the target rate
+// by "step" every "every" interval until it reaches "to".
+func StepRamp(from float64, to float64, step float64, every time.Duration) RateProfile {
+	return func(elapsed time.Duration) float64 {
+		if every <= 0 {
+			return to
+		}
+
+		rate := from + math.Abs(step)*math.Copysign(1, to-from)*math.Floor(float64(elapsed)/float64(every))
+		if (to >= from && rate > to) || (to < from && rate < to) {
+			return to
+		}
+
+		return rate
+	}
+}
+
+// rateLimiter is a token bucket whose refill rate follows the RateLimit profiles. A take may leave the bucket in
+// debt, the next take waits until the debt is paid, so batches bigger than the bucket are still allowed.
+type rateLimiter struct {
+	limit    RateLimit
+	onReport func(stats RateStats)
+
+	mutex        sync.Mutex
+	start        time.Time
+	last         time.Time
+	eventTokens  float64
+	byteTokens   float64
+	events       int64
+	bytes        int64
+	reportTime   time.Time
+	reportEvents int64
+	reportBytes  int64
+}
+
+func newRateLimiter(limit RateLimit, onReport func(stats RateStats)) *rateLimiter {
+	if limit.EventsPerSecond == nil && limit.BytesPerSecond == nil && limit.MaxDuration <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	return &rateLimiter{limit: limit, onReport: onReport, start: now, last: now, reportTime: now}
+}
+
+// take blocks until events and bytes can be sent without going over the target rate.
+func (limiter *rateLimiter) take(ctx context.Context, events int, bytes int) error {
+	if limiter == nil {
+		return nil
+	}
+
+	for {
+		limiter.mutex.Lock()
+		now := time.Now()
+		elapsed := now.Sub(limiter.start)
+
+		if limiter.limit.MaxDuration > 0 && elapsed >= limiter.limit.MaxDuration {
+			limiter.mutex.Unlock()
+			return ErrMaxDurationElapsed
+		}
+
+		eventRate, byteRate := limiter.refill(now, elapsed)
+		if allowed(limiter.eventTokens, eventRate) && allowed(limiter.byteTokens, byteRate) {
+			if eventRate >= 0 {
+				limiter.eventTokens -= float64(events)
+			}
+			if byteRate >= 0 {
+				limiter.byteTokens -= float64(bytes)
+			}
+			limiter.mutex.Unlock()
+			return nil
+		}
+
+		wait := math.Max(deficitWait(limiter.eventTokens, eventRate), deficitWait(limiter.byteTokens, byteRate))
+		limiter.mutex.Unlock()
+
+		timer := time.NewTimer(time.Duration(math.Min(wait, float64(rateMaxWait))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// refill adds the tokens accumulated since the last call, a negative rate means the profile is not set.
+func (limiter *rateLimiter) refill(now time.Time, elapsed time.Duration) (float64, float64) {
+	eventRate, byteRate := limiter.targets(elapsed)
+	seconds := now.Sub(limiter.last).Seconds()
+	limiter.last = now
+
+	limiter.eventTokens = refillTokens(limiter.eventTokens, eventRate, seconds)
+	limiter.byteTokens = refillTokens(limiter.byteTokens, byteRate, seconds)
+
+	return eventRate, byteRate
+}
+
+func (limiter *rateLimiter) targets(elapsed time.Duration) (float64, float64) {
+	eventRate, byteRate := -1.0, -1.0
+
+	if limiter.limit.EventsPerSecond != nil {
+		eventRate = math.Max(0, limiter.limit.EventsPerSecond(elapsed))
+	}
+	if limiter.limit.BytesPerSecond != nil {
+		byteRate = math.Max(0, limiter.limit.BytesPerSecond(elapsed))
+	}
+
+	return eventRate, byteRate
+}
+
+func refillTokens(tokens float64, rate float64, seconds float64) float64 {
+	if rate < 0 {
+		return 0
+	}
+
+	tokens += rate * seconds
+	if burst := rate * rateBurst.Seconds(); tokens > burst {
+		tokens = burst
+	}
+
+	return tokens
+}
+
+// allowed reports whether the bucket lets a send go through, a zero target rate pauses the send.
+func allowed(tokens float64, rate float64) bool {
+	return rate < 0 || (rate > 0 && tokens >= 0)
+}
+
+// deficitWait returns how long, in nanoseconds, it takes to pay the debt of the bucket at the given rate.
+func deficitWait(tokens float64, rate float64) float64 {
+	if rate == 0 {
+		return float64(rateMaxWait)
+	}
+	if tokens >= 0 || rate < 0 {
+		return 0
+	}
+
+	return -tokens / rate * float64(time.Second)
+}
+
+// chunk returns how many of the events should be sent at once to keep the rate smooth.
+func (limiter *rateLimiter) chunk(events []*eventhub.Event) int {
+	if limiter == nil || (limiter.limit.EventsPerSecond == nil && limiter.limit.BytesPerSecond == nil) {
+		return len(events)
+	}
+
+	limiter.mutex.Lock()
+	eventRate, byteRate := limiter.targets(time.Since(limiter.start))
+	limiter.mutex.Unlock()
+
+	size := len(events)
+	if eventRate >= 0 {
+		size = int(math.Min(float64(size), math.Max(1, eventRate*rateChunk.Seconds())))
+	}
+	if byteRate >= 0 {
+		maxBytes := byteRate * rateChunk.Seconds()
+		var bytes float64
+		for i := 0; i < size; i++ {
+			bytes += float64(len(events[i].Data))
+			if bytes > maxBytes && i > 0 {
+				size = i
+				break
+			}
+		}
+	}
+
+	return size
+}
+
+// rateReportHandler returns the rate report handler of the sender holding handlerMutex, as the other handlers, the
+// reports are emitted by the workers. It returns nil without handler.
+func (sender *Sender) rateReportHandler() func(stats RateStats) {
+	if sender.onRateReport == nil {
+		return nil
+	}
+
+	return func(stats RateStats) {
+		sender.handlerMutex.Lock()
+		defer sender.handlerMutex.Unlock()
+
+		sender.onRateReport(stats)
+	}
+}
+
+// record accounts events that were sent and reports the achieved rate once per rateReportInterval.
+func (limiter *rateLimiter) record(events int, bytes int) {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mutex.Lock()
+	limiter.events += int64(events)
+	limiter.bytes += int64(bytes)
+	stats, ok := limiter.stats(time.Now(), false)
+	limiter.mutex.Unlock()
+
+	if ok && limiter.onReport != nil {
+		limiter.onReport(stats)
+	}
+}
+
+// finish emits the report of the last interval.
+func (limiter *rateLimiter) finish() {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mutex.Lock()
+	stats, ok := limiter.stats(time.Now(), true)
+	limiter.mutex.Unlock()
+
+	if ok && limiter.onReport != nil {
+		limiter.onReport(stats)
+	}
+}
+
+func (limiter *rateLimiter) stats(now time.Time, force bool) (RateStats, bool) {
+	window := now.Sub(limiter.reportTime)
+	if window <= 0 || (!force && window < rateReportInterval) {
+		return RateStats{}, false
+	}
+
+	elapsed := now.Sub(limiter.start)
+	eventRate, byteRate := limiter.targets(elapsed)
+	stats := RateStats{
+		Elapsed:                 elapsed,
+		TargetEventsPerSecond:   math.Max(0, eventRate),
+		AchievedEventsPerSecond: float64(limiter.events-limiter.reportEvents) / window.Seconds(),
+		TargetBytesPerSecond:    math.Max(0, byteRate),
+		AchievedBytesPerSecond:  float64(limiter.bytes-limiter.reportBytes) / window.Seconds(),
+		TotalEvents:             limiter.events,
+		TotalBytes:              limiter.bytes,
+	}
+
+	limiter.reportTime = now
+	limiter.reportEvents = limiter.events
+	limiter.reportBytes = limiter.bytes
+
+	return stats, true
+}
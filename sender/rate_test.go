@@ -0,0 +1,156 @@
+package sender
+
+import (
+	"context"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateProfiles(t *testing.T) {
+	linear := LinearRamp(100, 2000, 10*time.Second)
+	if linear(0) != 100 || linear(5*time.Second) != 1050 || linear(time.Minute) != 2000 {
+		t.Errorf("unexpected linear ramp values %v %v %v", linear(0), linear(5*time.Second), linear(time.Minute))
+	}
+
+	step := StepRamp(100, 500, 150, time.Second)
+	if step(500*time.Millisecond) != 100 || step(1500*time.Millisecond) != 250 || step(10*time.Second) != 500 {
+		t.Errorf("unexpected step ramp values %v %v %v", step(500*time.Millisecond), step(1500*time.Millisecond), step(10*time.Second))
+	}
+
+	down := StepRamp(500, 100, 150, time.Second)
+	if down(time.Second) != 350 || down(10*time.Second) != 100 {
+		t.Errorf("unexpected descending step ramp values %v %v", down(time.Second), down(10*time.Second))
+	}
+
+	if ConstantRate(42)(time.Hour) != 42 {
+		t.Error("constant rate should not change")
+	}
+}
+
+func TestRateLimiter_Without_Limit_Is_Disabled(t *testing.T) {
+	if newRateLimiter(RateLimit{}, nil) != nil {
+		t.Error("limiter should be nil without limits")
+	}
+}
+
+func TestRateLimiter_Take_Keeps_The_Target_Rate(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{EventsPerSecond: ConstantRate(200)}, nil)
+	start := time.Now()
+
+	for i := 0; i < 61; i++ {
+		if err := limiter.take(context.Background(), 1, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 600*time.Millisecond {
+		t.Errorf("60 events at 200/s should take about 300ms but took %v", elapsed)
+	}
+}
+
+func TestRateLimiter_Take_Bytes(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{BytesPerSecond: ConstantRate(10000)}, nil)
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		_ = limiter.take(context.Background(), 1, 1000)
+	}
+
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("3000 bytes at 10000 bytes/s should take about 300ms but took %v", elapsed)
+	}
+}
+
+func TestRateLimiter_Take_Cancelled(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{EventsPerSecond: ConstantRate(0)}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.take(ctx, 1, 0); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded but got %v", err)
+	}
+}
+
+func TestRateLimiter_Chunk(t *testing.T) {
+	events := make([]*eventhub.Event, 1000)
+	for i := range events {
+		events[i] = eventhub.NewEvent([]byte("0123456789"))
+	}
+
+	limiter := newRateLimiter(RateLimit{EventsPerSecond: ConstantRate(100)}, nil)
+	if size := limiter.chunk(events); size != 10 {
+		t.Errorf("chunk should hold 100ms of events (10) but holds %v", size)
+	}
+
+	limiter = newRateLimiter(RateLimit{BytesPerSecond: ConstantRate(1000)}, nil)
+	if size := limiter.chunk(events); size != 10 {
+		t.Errorf("chunk should hold 100ms of bytes (10 events) but holds %v", size)
+	}
+
+	if size := (*rateLimiter)(nil).chunk(events); size != 1000 {
+		t.Errorf("without limiter the whole batch should be sent but chunk is %v", size)
+	}
+}
+
+func TestSender_SendMessage_Stops_At_MaxDuration(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = math.MaxInt64
+	sender.rateLimit = RateLimit{EventsPerSecond: ConstantRate(500), MaxDuration: 200 * time.Millisecond}
+
+	if err := sender.SendMessage("message", context.Background()); err != nil {
+		t.Errorf("reaching the max duration should not be an error: %v", err)
+	}
+	if hub.sent() < 50 || hub.sent() > 200 {
+		t.Errorf("about 100 events should be sent in 200ms at 500/s but %v were sent", hub.sent())
+	}
+}
+
+func TestSender_SendBatchMessage_With_Rate_Limit(t *testing.T) {
+	var reports []RateStats
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 300
+	sender.workers = 2
+	sender.rateLimit = RateLimit{EventsPerSecond: ConstantRate(1000)}
+	sender.onRateReport = func(stats RateStats) {
+		reports = append(reports, stats)
+	}
+
+	start := time.Now()
+	if err := sender.SendBatchMessage("message", context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("300 events at 1000/s should take about 300ms but took %v", elapsed)
+	}
+	if hub.sent() != 300 || hub.batches < 3 {
+		t.Errorf("300 events should be sent in small batches, sent %v in %v batches", hub.sent(), hub.batches)
+	}
+	if len(reports) == 0 || reports[len(reports)-1].TotalEvents != 300 || reports[len(reports)-1].TargetEventsPerSecond != 1000 {
+		t.Errorf("the last report should account every event, got %+v", reports)
+	}
+}
+
+func TestSender_Rate_Report_Holds_The_Handler_Mutex(t *testing.T) {
+	reported := make(chan RateStats, 1)
+	sender, _ := newFakeSender(&fakeHub{})
+	sender.onRateReport = func(stats RateStats) { reported <- stats }
+
+	sender.handlerMutex.Lock()
+	go sender.rateReportHandler()(RateStats{TotalEvents: 1})
+
+	select {
+	case <-reported:
+		t.Fatal("the report should wait for the other handlers")
+	case <-time.After(50 * time.Millisecond):
+	}
+	sender.handlerMutex.Unlock()
+
+	if stats := <-reported; stats.TotalEvents != 1 {
+		t.Errorf("unexpected report %+v", stats)
+	}
+}
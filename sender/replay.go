@@ -0,0 +1,91 @@
+package sender
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// ReplayAsFastAsPossible is the replay speed which ignores the recorded gaps between the events.
+const ReplayAsFastAsPossible = 0
+
+// ReplayFile(ctx context.Context, path string, speed float64) replays the events recorded in a JSONL file, use "-"
+// as path to read from the standard input. See Replay.
+func (sender *Sender) ReplayFile(ctx context.Context, path string, speed float64) error {
+	var r io.Reader = os.Stdin
+
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	return sender.Replay(ctx, r, speed)
+}
+
+// Replay(ctx context.Context, r io.Reader, speed float64) re-sends recorded events keeping their original timing.
+// The events are read in the JSONL event envelope format and sent one by one, in the file order, keeping the gap
+// between their SystemProperties.EnqueuedTime values divided by speed: 1 is the original timing, 0.5 is twice
+// slower, 10 is ten times faster and ReplayAsFastAsPossible ignores the gaps. Events without EnqueuedTime, or
+// enqueued before the previous one, are sent right after the previous event. ID, PartitionKey and Properties are kept.
+func (sender *Sender) Replay(ctx context.Context, r io.Reader, speed float64) error {
+	var firstEnqueued time.Time
+	var start time.Time
+
+	session, err := sender.newSession(false)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	reader := newJSONLReader(r)
+	for {
+		record, err := reader.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if speed > 0 && record.enqueuedTime != nil {
+			if start.IsZero() {
+				firstEnqueued = *record.enqueuedTime
+				start = time.Now()
+			}
+
+			offset := time.Duration(float64(record.enqueuedTime.Sub(firstEnqueued)) / speed)
+			if err = sleepUntil(ctx, start.Add(offset)); err != nil {
+				return err
+			}
+		}
+
+		if err = sender.sendEvent(ctx, session, record.event); err == ErrMaxDurationElapsed {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// sleepUntil waits until the deadline, it returns immediately when the deadline is in the past.
+func sleepUntil(ctx context.Context, deadline time.Time) error {
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+	"time"
+)
+
+func recording(gaps ...time.Duration) string {
+	var sb strings.Builder
+	enqueued := time.Date(2020, 2, 13, 12, 54, 57, 0, time.UTC)
+
+	for i, gap := range gaps {
+		enqueued = enqueued.Add(gap)
+		sb.WriteString(fmt.Sprintf(`{"Data": "event %d", "PartitionKey": "pk-%d", "Properties": {"index": "%d"}, `+
+			`"SystemProperties": {"EnqueuedTime": "%s"}}`+"\n", i, i%2, i, enqueued.Format(time.RFC3339Nano)))
+	}
+
+	return sb.String()
+}
+
+func TestSender_Replay_Keeps_The_Timing(t *testing.T) {
+	var sentAt []time.Time
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.onAfterSendMessage = func(event *eventhub.Event) {
+		sentAt = append(sentAt, time.Now())
+	}
+
+	start := time.Now()
+	err := sender.Replay(context.Background(), strings.NewReader(recording(0, 400*time.Millisecond, 400*time.Millisecond)), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 380*time.Millisecond || elapsed > 700*time.Millisecond {
+		t.Errorf("800ms replayed at 2x should take about 400ms but took %v", elapsed)
+	}
+	if gap := sentAt[2].Sub(sentAt[1]); gap < 150*time.Millisecond {
+		t.Errorf("gap between events should be about 200ms but was %v", gap)
+	}
+
+	for i, event := range hub.events {
+		if string(event.Data) != fmt.Sprintf("event %d", i) || *event.PartitionKey != fmt.Sprintf("pk-%d", i%2) ||
+			event.Properties["index"] != fmt.Sprint(i) {
+			t.Errorf("event %d was not replayed as recorded: %+v", i, event)
+		}
+	}
+}
+
+func TestSender_Replay_As_Fast_As_Possible(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+
+	start := time.Now()
+	err := sender.Replay(context.Background(), strings.NewReader(recording(0, time.Hour, time.Hour)), ReplayAsFastAsPossible)
+	if err != nil || hub.sent() != 3 {
+		t.Errorf("expected 3 events sent without error, got %v %v", hub.sent(), err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("replay should ignore the gaps")
+	}
+}
+
+func TestSender_Replay_Cancelled(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := sender.Replay(ctx, strings.NewReader(recording(0, time.Hour)), 1)
+	if err != context.DeadlineExceeded || hub.sent() != 1 {
+		t.Errorf("replay should stop on cancellation after the first event, got %v events and %v", hub.sent(), err)
+	}
+}
@@ -0,0 +1,329 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyPrecision is the relative width of the histogram buckets, percentiles are accurate within 2%.
+const latencyPrecision = 1.02
+
+// latencyBounds are the upper bounds of the buckets shown in the report, the last bucket has no upper bound.
+var latencyBounds = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+type (
+	// SendReport summarizes a send: throughput and the latency of every send operation (a single event for
+	// SendMessage, a batch for the batch sends) per worker and overall.
+	SendReport struct {
+		TotalEvents     int64
+		TotalBytes      int64 // bytes of the event payloads (event.Data)
+		Duration        time.Duration
+		EventsPerSecond float64
+		MBPerSecond     float64
+		Latency         LatencyStats
+		Workers         []WorkerReport
+		RandomSeed      int64 // seed of the random content, see SetRandomSeed
+	}
+
+	// WorkerReport is the share of a single worker in a SendReport.
+	WorkerReport struct {
+		Worker  int
+		Events  int64
+		Bytes   int64
+		Latency LatencyStats
+	}
+
+	// LatencyStats holds the percentiles and the histogram of the send latency.
+	LatencyStats struct {
+		Count     int64
+		P50       time.Duration
+		P90       time.Duration
+		P99       time.Duration
+		Max       time.Duration
+		Histogram []HistogramBucket
+	}
+
+	// HistogramBucket counts the sends with a latency up to UpperBound. The last bucket has UpperBound 0 and counts
+	// the sends slower than every other bucket.
+	HistogramBucket struct {
+		UpperBound time.Duration
+		Count      int64
+	}
+)
+
+// String returns the report formatted as text.
+func (report *SendReport) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("events: %d, bytes: %d, duration: %v\n", report.TotalEvents, report.TotalBytes,
+		report.Duration))
+	sb.WriteString(fmt.Sprintf("throughput: %.2f events/s, %.3f MB/s\n", report.EventsPerSecond, report.MBPerSecond))
+	sb.WriteString("latency: " + report.Latency.String() + "\n")
+	sb.WriteString(fmt.Sprintf("random seed: %d\n", report.RandomSeed))
+
+	for _, bucket := range report.Latency.Histogram {
+		bound := "+Inf"
+		if bucket.UpperBound > 0 {
+			bound = bucket.UpperBound.String()
+		}
+		sb.WriteString(fmt.Sprintf("  <= %-8s %d\n", bound, bucket.Count))
+	}
+
+	for _, worker := range report.Workers {
+		sb.WriteString(fmt.Sprintf("worker %d: events: %d, bytes: %d, latency: %s\n", worker.Worker, worker.Events,
+			worker.Bytes, worker.Latency.String()))
+	}
+
+	return sb.String()
+}
+
+// String returns the percentiles formatted as text.
+func (stats LatencyStats) String() string {
+	return fmt.Sprintf("count %d p50 %v p90 %v p99 %v max %v", stats.Count, stats.P50, stats.P90, stats.P99,
+		stats.Max)
+}
+
+// JSON returns the report formatted as indented JSON, durations are in milliseconds.
+func (report *SendReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// MarshalJSON writes durations in milliseconds and uses camel case names.
+func (report *SendReport) MarshalJSON() ([]byte, error) {
+	type workerJSON struct {
+		Worker  int             `json:"worker"`
+		Events  int64           `json:"events"`
+		Bytes   int64           `json:"bytes"`
+		Latency json.RawMessage `json:"latency"`
+	}
+
+	latency, err := report.Latency.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]workerJSON, 0, len(report.Workers))
+	for _, worker := range report.Workers {
+		workerLatency, err := worker.Latency.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, workerJSON{worker.Worker, worker.Events, worker.Bytes, workerLatency})
+	}
+
+	return json.Marshal(struct {
+		TotalEvents     int64           `json:"totalEvents"`
+		TotalBytes      int64           `json:"totalBytes"`
+		DurationMs      float64         `json:"durationMs"`
+		EventsPerSecond float64         `json:"eventsPerSecond"`
+		MBPerSecond     float64         `json:"mbPerSecond"`
+		Latency         json.RawMessage `json:"latency"`
+		Workers         []workerJSON    `json:"workers"`
+		RandomSeed      int64           `json:"randomSeed"`
+	}{report.TotalEvents, report.TotalBytes, milliseconds(report.Duration), report.EventsPerSecond,
+		report.MBPerSecond, latency, workers, report.RandomSeed})
+}
+
+// MarshalJSON writes durations in milliseconds, the open bucket of the histogram has a null upper bound.
+func (stats LatencyStats) MarshalJSON() ([]byte, error) {
+	type bucketJSON struct {
+		UpperBoundMs *float64 `json:"upperBoundMs"`
+		Count        int64    `json:"count"`
+	}
+
+	histogram := make([]bucketJSON, 0, len(stats.Histogram))
+	for _, bucket := range stats.Histogram {
+		var bound *float64
+		if bucket.UpperBound > 0 {
+			ms := milliseconds(bucket.UpperBound)
+			bound = &ms
+		}
+		histogram = append(histogram, bucketJSON{bound, bucket.Count})
+	}
+
+	return json.Marshal(struct {
+		Count     int64        `json:"count"`
+		P50Ms     float64      `json:"p50Ms"`
+		P90Ms     float64      `json:"p90Ms"`
+		P99Ms     float64      `json:"p99Ms"`
+		MaxMs     float64      `json:"maxMs"`
+		Histogram []bucketJSON `json:"histogram"`
+	}{stats.Count, milliseconds(stats.P50), milliseconds(stats.P90), milliseconds(stats.P99),
+		milliseconds(stats.Max), histogram})
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// latencyHistogram stores latencies in exponential buckets of latencyPrecision relative width.
+type latencyHistogram struct {
+	buckets map[int]int64
+	count   int64
+	max     time.Duration
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make(map[int]int64)}
+}
+
+func (histogram *latencyHistogram) add(latency time.Duration) {
+	histogram.buckets[latencyBucket(latency)]++
+	histogram.count++
+	if latency > histogram.max {
+		histogram.max = latency
+	}
+}
+
+func (histogram *latencyHistogram) merge(other *latencyHistogram) {
+	for bucket, count := range other.buckets {
+		histogram.buckets[bucket] += count
+	}
+	histogram.count += other.count
+	if other.max > histogram.max {
+		histogram.max = other.max
+	}
+}
+
+func (histogram *latencyHistogram) stats() LatencyStats {
+	stats := LatencyStats{Count: histogram.count, Max: histogram.max}
+	if histogram.count == 0 {
+		return stats
+	}
+
+	keys := make([]int, 0, len(histogram.buckets))
+	for key := range histogram.buckets {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	percentile := func(p float64) time.Duration {
+		rank := int64(math.Ceil(p * float64(histogram.count)))
+		var seen int64
+		for _, key := range keys {
+			seen += histogram.buckets[key]
+			if seen >= rank {
+				if latency := bucketLatency(key); latency < histogram.max {
+					return latency
+				}
+				return histogram.max
+			}
+		}
+		return histogram.max
+	}
+	stats.P50 = percentile(0.50)
+	stats.P90 = percentile(0.90)
+	stats.P99 = percentile(0.99)
+
+	stats.Histogram = make([]HistogramBucket, len(latencyBounds)+1)
+	for i, bound := range latencyBounds {
+		stats.Histogram[i].UpperBound = bound
+	}
+	for _, key := range keys {
+		index := sort.Search(len(latencyBounds), func(i int) bool {
+			return bucketLatency(key) <= latencyBounds[i]
+		})
+		stats.Histogram[index].Count += histogram.buckets[key]
+	}
+
+	return stats
+}
+
+func latencyBucket(latency time.Duration) int {
+	if latency <= time.Microsecond {
+		return 0
+	}
+
+	return int(math.Ceil(math.Log(float64(latency)/float64(time.Microsecond)) / math.Log(latencyPrecision)))
+}
+
+// bucketLatency returns the upper bound of the bucket.
+func bucketLatency(bucket int) time.Duration {
+	return time.Duration(math.Pow(latencyPrecision, float64(bucket)) * float64(time.Microsecond))
+}
+
+// sendRecorder collects what is needed to build a SendReport, it is shared by the workers of a send.
+type sendRecorder struct {
+	mutex   sync.Mutex
+	start   time.Time
+	workers map[int]*workerRecord
+}
+
+type workerRecord struct {
+	events  int64
+	bytes   int64
+	latency *latencyHistogram
+}
+
+func newSendRecorder() *sendRecorder {
+	return &sendRecorder{start: time.Now(), workers: make(map[int]*workerRecord)}
+}
+
+func (recorder *sendRecorder) record(workerIndex int, events int, bytes int, latency time.Duration) {
+	if recorder == nil {
+		return
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	worker, ok := recorder.workers[workerIndex]
+	if !ok {
+		worker = &workerRecord{latency: newLatencyHistogram()}
+		recorder.workers[workerIndex] = worker
+	}
+
+	worker.events += int64(events)
+	worker.bytes += int64(bytes)
+	worker.latency.add(latency)
+}
+
+func (recorder *sendRecorder) report() *SendReport {
+	if recorder == nil {
+		return nil
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	report := &SendReport{Duration: time.Since(recorder.start)}
+	overall := newLatencyHistogram()
+
+	indexes := make([]int, 0, len(recorder.workers))
+	for index := range recorder.workers {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		worker := recorder.workers[index]
+		report.TotalEvents += worker.events
+		report.TotalBytes += worker.bytes
+		overall.merge(worker.latency)
+		report.Workers = append(report.Workers, WorkerReport{
+			Worker:  index,
+			Events:  worker.events,
+			Bytes:   worker.bytes,
+			Latency: worker.latency.stats(),
+		})
+	}
+
+	report.Latency = overall.stats()
+	if seconds := report.Duration.Seconds(); seconds > 0 {
+		report.EventsPerSecond = float64(report.TotalEvents) / seconds
+		report.MBPerSecond = float64(report.TotalBytes) / 1e6 / seconds
+	}
+
+	return report
+}
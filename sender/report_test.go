@@ -0,0 +1,103 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram_Percentiles(t *testing.T) {
+	histogram := newLatencyHistogram()
+	for i := 1; i <= 100; i++ {
+		histogram.add(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := histogram.stats()
+	expect := func(name string, value time.Duration, expected time.Duration) {
+		if diff := float64(value-expected) / float64(expected); diff < -0.03 || diff > 0.03 {
+			t.Errorf("%s should be about %v but is %v", name, expected, value)
+		}
+	}
+	expect("p50", stats.P50, 50*time.Millisecond)
+	expect("p90", stats.P90, 90*time.Millisecond)
+	expect("p99", stats.P99, 99*time.Millisecond)
+	if stats.Max != 100*time.Millisecond || stats.Count != 100 {
+		t.Errorf("unexpected max %v or count %v", stats.Max, stats.Count)
+	}
+
+	var count int64
+	for _, bucket := range stats.Histogram {
+		count += bucket.Count
+	}
+	if count != 100 {
+		t.Errorf("histogram should count 100 sends but counts %v", count)
+	}
+}
+
+func TestSendRecorder_Report(t *testing.T) {
+	recorder := newSendRecorder()
+	recorder.record(0, 100, 1000, 10*time.Millisecond)
+	recorder.record(1, 50, 500, 20*time.Millisecond)
+	recorder.record(1, 50, 500, 30*time.Millisecond)
+
+	report := recorder.report()
+	if report.TotalEvents != 200 || report.TotalBytes != 2000 || len(report.Workers) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Workers[1].Events != 100 || report.Workers[1].Latency.Count != 2 || report.Latency.Count != 3 {
+		t.Errorf("unexpected worker report %+v", report.Workers[1])
+	}
+	if report.Latency.Max != 30*time.Millisecond || report.EventsPerSecond <= 0 {
+		t.Errorf("unexpected overall stats %+v", report)
+	}
+}
+
+func TestSendReport_Text_And_JSON(t *testing.T) {
+	recorder := newSendRecorder()
+	recorder.record(0, 10, 100, 3*time.Millisecond)
+	report := recorder.report()
+
+	if text := report.String(); !strings.Contains(text, "events: 10") || !strings.Contains(text, "worker 0") {
+		t.Errorf("unexpected text report:\n%s", text)
+	}
+
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	latency := decoded["latency"].(map[string]interface{})
+	if decoded["totalEvents"].(float64) != 10 || latency["maxMs"].(float64) != 3 {
+		t.Errorf("unexpected json report %s", data)
+	}
+}
+
+func TestSender_Send_With_Report(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.numberOfMessages = 20
+	sender.workers = 2
+
+	report, err := sender.SendMessageWithReport("message", context.Background())
+	if err != nil || report.TotalEvents != 20 || report.TotalBytes != 20*7 || report.Latency.Count != 20 {
+		t.Errorf("unexpected SendMessage report %+v, error %v", report, err)
+	}
+
+	report, err = sender.SendBatchMessageWithReport("message", context.Background())
+	if err != nil || report.TotalEvents != 20 {
+		t.Errorf("unexpected SendBatchMessage report %+v, error %v", report, err)
+	}
+
+	events := []*eventhub.Event{eventhub.NewEvent([]byte("1")), eventhub.NewEvent([]byte("2"))}
+	report, err = sender.SendEventsAsBatchWithReport(context.Background(), &events)
+	if err != nil || report.TotalEvents != 20 || report.TotalBytes != 20 {
+		t.Errorf("unexpected SendEventsAsBatch report %+v, error %v", report, err)
+	}
+}
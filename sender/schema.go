@@ -0,0 +1,497 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSchemaRange     = 1000
+	defaultSchemaMaxLength = 16
+	defaultSchemaMaxItems  = 3
+	maxSchemaDepth         = 16 // recursive schemas stop adding optional properties and items below this depth
+)
+
+// PayloadGenerator creates the body of the events sent by SendBatchMessage and SendMessage in place of the message,
+// index is the position of the event in the send. It must be safe to be called from multiple go routines.
+type PayloadGenerator interface {
+	Generate(index int64) []byte
+}
+
+type (
+	// SchemaGenerator is a PayloadGenerator creating random json documents valid against a JSON Schema. It supports
+	// type, enum, const, properties, required, items, minItems, maxItems, minimum, maximum, exclusiveMinimum,
+	// exclusiveMaximum, multipleOf, minLength, maxLength, anyOf, oneOf, local $ref and the formats uuid, date-time,
+	// date, time, email, uri, hostname and ipv4. Optional properties are present half of the time.
+	SchemaGenerator struct {
+		mutex  sync.Mutex
+		random *rand.Rand
+		source *replayableSource
+		root   map[string]interface{}
+		nodes  map[string]*schemaNode // compiled $ref targets
+		schema *schemaNode
+	}
+
+	schemaNode struct {
+		types            []string
+		enum             []interface{}
+		hasConst         bool
+		constValue       interface{}
+		format           string
+		minimum          *float64
+		maximum          *float64
+		exclusiveMinimum bool
+		exclusiveMaximum bool
+		multipleOf       float64
+		minLength        int
+		maxLength        int
+		properties       map[string]*schemaNode
+		propertyNames    []string
+		required         map[string]bool
+		items            *schemaNode
+		minItems         int
+		maxItems         int
+		choices          []*schemaNode
+		ref              string
+	}
+)
+
+// NewSchemaGenerator(schema []byte, seed int64) compiles the JSON Schema, the same seed generates the same documents.
+func NewSchemaGenerator(schema []byte, seed int64) (*SchemaGenerator, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("schema: %v", err)
+	}
+
+	generator := &SchemaGenerator{root: root, nodes: make(map[string]*schemaNode)}
+	generator.Seed(seed)
+
+	node, err := generator.compile(root, "#")
+	if err != nil {
+		return nil, err
+	}
+	generator.schema = node
+
+	return generator, nil
+}
+
+// LoadSchemaGenerator(path string, seed int64) is NewSchemaGenerator reading the schema from a file.
+func LoadSchemaGenerator(path string, seed int64) (*SchemaGenerator, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSchemaGenerator(content, seed)
+}
+
+// Seed(seed int64) restarts the generator with another seed, SetRandomSeed seeds the generator of the sender.
+func (generator *SchemaGenerator) Seed(seed int64) {
+	generator.mutex.Lock()
+	generator.source = newReplayableSource(seed)
+	generator.random = rand.New(generator.source)
+	generator.mutex.Unlock()
+}
+
+// clone returns a generator in the same state, the documents it generates are the next ones of the generator.
+func (generator *SchemaGenerator) clone() PayloadGenerator {
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+
+	source := generator.source.clone()
+
+	return &SchemaGenerator{random: rand.New(source), source: source, root: generator.root, nodes: generator.nodes,
+		schema: generator.schema}
+}
+
+// Generate returns a random json document valid against the schema.
+func (generator *SchemaGenerator) Generate(index int64) []byte {
+	generator.mutex.Lock()
+	value := generator.generate(generator.schema, 0)
+	generator.mutex.Unlock()
+
+	content, _ := json.Marshal(value) // values built from json types always marshal
+
+	return content
+}
+
+// compile reads the keywords of a schema, path locates it in the document for the error messages.
+func (generator *SchemaGenerator) compile(schema map[string]interface{}, path string) (*schemaNode, error) {
+	var err error
+	node := &schemaNode{}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if !strings.HasPrefix(ref, "#") {
+			return nil, fmt.Errorf("schema %s: only local $ref are supported, got %q", path, ref)
+		}
+		node.ref = ref
+		if _, ok := generator.nodes[ref]; ok {
+			return node, nil
+		}
+
+		target, err := generator.lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+		// registered before compiling the target so recursive schemas end here
+		compiled := &schemaNode{}
+		generator.nodes[ref] = compiled
+		targetNode, err := generator.compile(target, ref)
+		if err != nil {
+			return nil, err
+		}
+		*compiled = *targetNode
+
+		return node, nil
+	}
+
+	switch value := schema["type"].(type) {
+	case string:
+		node.types = []string{value}
+	case []interface{}:
+		for _, t := range value {
+			if name, ok := t.(string); ok {
+				node.types = append(node.types, name)
+			}
+		}
+	}
+	for _, t := range node.types {
+		switch t {
+		case "string", "integer", "number", "boolean", "object", "array", "null":
+		default:
+			return nil, fmt.Errorf("schema %s: unknown type %q", path, t)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		if len(enum) == 0 {
+			return nil, fmt.Errorf("schema %s: enum is empty", path)
+		}
+		node.enum = enum
+	}
+	node.constValue, node.hasConst = schema["const"]
+	node.format, _ = schema["format"].(string)
+
+	node.minimum, node.exclusiveMinimum = schemaBound(schema, "minimum", "exclusiveMinimum")
+	node.maximum, node.exclusiveMaximum = schemaBound(schema, "maximum", "exclusiveMaximum")
+	if node.minimum != nil && node.maximum != nil && *node.minimum > *node.maximum {
+		return nil, fmt.Errorf("schema %s: minimum is greater than maximum", path)
+	}
+	node.multipleOf, _ = schema["multipleOf"].(float64)
+
+	if node.minLength, node.maxLength, err = schemaRange(schema, "minLength", "maxLength", 1,
+		defaultSchemaMaxLength); err != nil {
+		return nil, fmt.Errorf("schema %s: %v", path, err)
+	}
+	if node.minItems, node.maxItems, err = schemaRange(schema, "minItems", "maxItems", 1,
+		defaultSchemaMaxItems); err != nil {
+		return nil, fmt.Errorf("schema %s: %v", path, err)
+	}
+
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		node.properties = make(map[string]*schemaNode, len(properties))
+		for name, value := range properties {
+			property, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("schema %s/properties/%s: not an object", path, name)
+			}
+			if node.properties[name], err = generator.compile(property, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+			node.propertyNames = append(node.propertyNames, name)
+		}
+		sort.Strings(node.propertyNames)
+	}
+
+	node.required = make(map[string]bool)
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				node.required[name] = true
+			}
+		}
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if node.items, err = generator.compile(items, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		choices, ok := schema[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, choice := range choices {
+			choiceSchema, ok := choice.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("schema %s/%s/%d: not an object", path, keyword, i)
+			}
+			compiled, err := generator.compile(choiceSchema, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+			if err != nil {
+				return nil, err
+			}
+			node.choices = append(node.choices, compiled)
+		}
+	}
+
+	if len(node.types) == 0 {
+		switch {
+		case node.properties != nil:
+			node.types = []string{"object"}
+		case node.items != nil:
+			node.types = []string{"array"}
+		default:
+			node.types = []string{"string"}
+		}
+	}
+
+	return node, nil
+}
+
+// lookup resolves a local json pointer, ex: "#/definitions/address".
+func (generator *SchemaGenerator) lookup(ref string) (map[string]interface{}, error) {
+	var current interface{} = generator.root
+
+	pointer := strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/")
+	if pointer != "" {
+		for _, token := range strings.Split(pointer, "/") {
+			token, _ = url.PathUnescape(token)
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("schema: $ref %q not found", ref)
+			}
+			if current, ok = object[token]; !ok {
+				return nil, fmt.Errorf("schema: $ref %q not found", ref)
+			}
+		}
+	}
+
+	schema, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema: $ref %q is not an object", ref)
+	}
+
+	return schema, nil
+}
+
+// resolve follows the $ref of a node.
+func (generator *SchemaGenerator) resolve(node *schemaNode) *schemaNode {
+	for node.ref != "" {
+		node = generator.nodes[node.ref]
+	}
+
+	return node
+}
+
+func (generator *SchemaGenerator) generate(node *schemaNode, depth int) interface{} {
+	node = generator.resolve(node)
+	random := generator.random
+
+	if depth > 2*maxSchemaDepth {
+		return nil // a required property refers to itself, the schema has no finite document
+	}
+
+	switch {
+	case node.hasConst:
+		return node.constValue
+	case len(node.enum) > 0:
+		return node.enum[random.Intn(len(node.enum))]
+	case len(node.choices) > 0:
+		return generator.generate(node.choices[random.Intn(len(node.choices))], depth+1)
+	}
+
+	switch node.types[random.Intn(len(node.types))] {
+	case "null":
+		return nil
+	case "boolean":
+		return random.Intn(2) == 1
+	case "integer":
+		return generator.integer(node)
+	case "number":
+		return generator.number(node)
+	case "object":
+		object := make(map[string]interface{}, len(node.properties))
+		for _, name := range node.propertyNames {
+			if node.required[name] || (depth < maxSchemaDepth && random.Intn(2) == 1) {
+				object[name] = generator.generate(node.properties[name], depth+1)
+			}
+		}
+		return object
+	case "array":
+		size := node.minItems
+		if depth < maxSchemaDepth {
+			size += random.Intn(node.maxItems - node.minItems + 1)
+		}
+		array := make([]interface{}, size)
+		for i := range array {
+			if node.items != nil {
+				array[i] = generator.generate(node.items, depth+1)
+			} else {
+				array[i] = generator.randomString(1, defaultSchemaMaxLength)
+			}
+		}
+		return array
+	}
+
+	return generator.formatted(node)
+}
+
+func (generator *SchemaGenerator) integer(node *schemaNode) int64 {
+	low, high := numberRange(node)
+	low, high = math.Ceil(low), math.Floor(high)
+	if node.exclusiveMinimum && node.minimum != nil && low == *node.minimum {
+		low++
+	}
+	if node.exclusiveMaximum && node.maximum != nil && high == *node.maximum {
+		high--
+	}
+
+	step := int64(1)
+	if node.multipleOf >= 1 && node.multipleOf == math.Trunc(node.multipleOf) {
+		step = int64(node.multipleOf)
+	}
+
+	first := int64(math.Ceil(low/float64(step))) * step
+	count := (int64(high)-first)/step + 1
+	if count <= 0 {
+		return first
+	}
+
+	return first + generator.random.Int63n(count)*step
+}
+
+func (generator *SchemaGenerator) number(node *schemaNode) float64 {
+	low, high := numberRange(node)
+
+	if node.multipleOf > 0 {
+		first := math.Ceil(low / node.multipleOf)
+		count := math.Floor(high/node.multipleOf) - first + 1
+		if node.exclusiveMinimum && node.minimum != nil && first*node.multipleOf == *node.minimum {
+			first++
+			count--
+		}
+		if node.exclusiveMaximum && node.maximum != nil && (first+count-1)*node.multipleOf == *node.maximum {
+			count--
+		}
+		if count >= 1 {
+			return (first + float64(generator.random.Int63n(int64(count)))) * node.multipleOf
+		}
+	}
+
+	// two decimals keep the documents readable, the bounds are checked again after rounding
+	value := math.Round((low+generator.random.Float64()*(high-low))*100) / 100
+	if value < low || (node.exclusiveMinimum && value == low) || value > high || (node.exclusiveMaximum && value == high) {
+		value = low + (high-low)/2
+	}
+
+	return value
+}
+
+// numberRange returns the bounds of a number, a missing bound is set defaultSchemaRange away from the other one.
+func numberRange(node *schemaNode) (float64, float64) {
+	switch {
+	case node.minimum != nil && node.maximum != nil:
+		return *node.minimum, *node.maximum
+	case node.minimum != nil:
+		return *node.minimum, *node.minimum + defaultSchemaRange
+	case node.maximum != nil:
+		return *node.maximum - defaultSchemaRange, *node.maximum
+	}
+
+	return 0, defaultSchemaRange
+}
+
+func (generator *SchemaGenerator) formatted(node *schemaNode) string {
+	random := generator.random
+	instant := func() time.Time {
+		return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(random.Int63n(int64(5 * 365 * 24 * time.Hour))))
+	}
+
+	switch node.format {
+	case "uuid":
+		b := make([]byte, 16)
+		readBytes(random, b)
+		b[6] = (b[6] & 0x0f) | 0x40 // version 4
+		b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "date-time":
+		return instant().Format(time.RFC3339)
+	case "date":
+		return instant().Format("2006-01-02")
+	case "time":
+		return instant().Format("15:04:05Z")
+	case "email":
+		return strings.ToLower(generator.randomString(5, 10)) + "@example.com"
+	case "hostname":
+		return strings.ToLower(generator.randomString(5, 10)) + ".example.com"
+	case "uri":
+		return "https://example.com/" + strings.ToLower(generator.randomString(5, 10))
+	case "ipv4":
+		return strconv.Itoa(random.Intn(256)) + "." + strconv.Itoa(random.Intn(256)) + "." +
+			strconv.Itoa(random.Intn(256)) + "." + strconv.Itoa(random.Intn(256))
+	}
+
+	return generator.randomString(node.minLength, node.maxLength)
+}
+
+func (generator *SchemaGenerator) randomString(minLength int, maxLength int) string {
+	size := minLength + generator.random.Intn(maxLength-minLength+1)
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = mLetterBytes[generator.random.Intn(len(mLetterBytes))]
+	}
+
+	return string(b)
+}
+
+// schemaBound reads a numeric bound, exclusive is either a boolean (draft 4) or the bound itself (draft 6 and later).
+func schemaBound(schema map[string]interface{}, inclusiveKey string, exclusiveKey string) (*float64, bool) {
+	if value, ok := schema[exclusiveKey].(float64); ok {
+		return &value, true
+	}
+
+	value, ok := schema[inclusiveKey].(float64)
+	if !ok {
+		return nil, false
+	}
+	exclusive, _ := schema[exclusiveKey].(bool)
+
+	return &value, exclusive
+}
+
+// schemaRange reads a length range, a missing max is set defaultMax above the min.
+func schemaRange(schema map[string]interface{}, minKey string, maxKey string, defaultMin int,
+	defaultMax int) (int, int, error) {
+
+	low, hasLow := schema[minKey].(float64)
+	high, hasHigh := schema[maxKey].(float64)
+
+	switch {
+	case !hasLow && !hasHigh:
+		return defaultMin, defaultMax, nil
+	case !hasLow:
+		if int(high) < defaultMin {
+			return int(high), int(high), nil
+		}
+		return defaultMin, int(high), nil
+	case !hasHigh:
+		return int(low), int(low) + defaultMax, nil
+	case low > high:
+		return 0, 0, fmt.Errorf("%s is greater than %s", minKey, maxKey)
+	}
+
+	return int(low), int(high), nil
+}
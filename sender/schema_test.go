@@ -0,0 +1,159 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const orderSchema = `{
+  "type": "object",
+  "required": ["id", "createdAt", "customer", "status", "quantity", "price", "lines"],
+  "properties": {
+    "id": {"type": "string", "format": "uuid"},
+    "createdAt": {"type": "string", "format": "date-time"},
+    "customer": {"$ref": "#/definitions/customer"},
+    "status": {"enum": ["new", "paid", "shipped"]},
+    "quantity": {"type": "integer", "minimum": 1, "maximum": 10},
+    "price": {"type": "number", "exclusiveMinimum": 0, "maximum": 99.5},
+    "discount": {"type": "integer", "minimum": 0, "maximum": 50, "multipleOf": 5},
+    "lines": {"type": "array", "minItems": 2, "maxItems": 4, "items": {"type": "string", "minLength": 3, "maxLength": 5}},
+    "gift": {"type": "boolean"}
+  },
+  "definitions": {
+    "customer": {
+      "type": "object",
+      "required": ["email"],
+      "properties": {
+        "email": {"type": "string", "format": "email"},
+        "referrer": {"$ref": "#/definitions/customer"}
+      }
+    }
+  }
+}`
+
+type generatedOrder struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Customer  struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+	Status   string   `json:"status"`
+	Quantity int      `json:"quantity"`
+	Price    float64  `json:"price"`
+	Discount *int     `json:"discount"`
+	Lines    []string `json:"lines"`
+}
+
+func TestSchemaGenerator_Honors_The_Schema(t *testing.T) {
+	generator, err := NewSchemaGenerator([]byte(orderSchema), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for i := int64(0); i < 200; i++ {
+		document := generator.Generate(i)
+
+		var order generatedOrder
+		if err := json.Unmarshal(document, &order); err != nil {
+			t.Fatalf("invalid document %s: %v", document, err)
+		}
+
+		if !uuidPattern.MatchString(order.ID) {
+			t.Errorf("invalid uuid %q", order.ID)
+		}
+		if order.CreatedAt.IsZero() || !strings.HasSuffix(order.Customer.Email, "@example.com") {
+			t.Errorf("invalid date-time or email in %s", document)
+		}
+		if order.Status != "new" && order.Status != "paid" && order.Status != "shipped" {
+			t.Errorf("status %q is not in the enum", order.Status)
+		}
+		if order.Quantity < 1 || order.Quantity > 10 || order.Price <= 0 || order.Price > 99.5 {
+			t.Errorf("quantity %d or price %v out of range", order.Quantity, order.Price)
+		}
+		if order.Discount != nil && (*order.Discount%5 != 0 || *order.Discount > 50) {
+			t.Errorf("discount %d is not a multiple of 5 up to 50", *order.Discount)
+		}
+		if len(order.Lines) < 2 || len(order.Lines) > 4 {
+			t.Errorf("expected 2 to 4 lines but got %d", len(order.Lines))
+		}
+		for _, line := range order.Lines {
+			if len(line) < 3 || len(line) > 5 {
+				t.Errorf("line %q length out of range", line)
+			}
+		}
+	}
+}
+
+func TestSchemaGenerator_Same_Seed_Same_Documents(t *testing.T) {
+	first, _ := NewSchemaGenerator([]byte(orderSchema), 42)
+	second, _ := NewSchemaGenerator([]byte(orderSchema), 42)
+	other, _ := NewSchemaGenerator([]byte(orderSchema), 43)
+
+	var different bool
+	for i := int64(0); i < 10; i++ {
+		document := first.Generate(i)
+		if !bytes.Equal(document, second.Generate(i)) {
+			t.Fatalf("the same seed should generate the same documents")
+		}
+		if !bytes.Equal(document, other.Generate(i)) {
+			different = true
+		}
+	}
+	if !different {
+		t.Error("another seed should generate other documents")
+	}
+}
+
+func TestSchemaGenerator_Invalid_Schemas(t *testing.T) {
+	for _, schema := range []string{
+		`not json`,
+		`{"type": "decimal"}`,
+		`{"type": "integer", "minimum": 10, "maximum": 1}`,
+		`{"type": "string", "minLength": 10, "maxLength": 1}`,
+		`{"enum": []}`,
+		`{"$ref": "#/definitions/missing"}`,
+		`{"$ref": "other.json#/definitions/a"}`,
+	} {
+		if _, err := NewSchemaGenerator([]byte(schema), 1); err == nil {
+			t.Errorf("expected an error for %s", schema)
+		}
+	}
+}
+
+func TestSender_SendBatchMessage_With_Schema(t *testing.T) {
+	generator, err := NewSchemaGenerator([]byte(orderSchema), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.payloadGenerator = generator
+	sender.numberOfMessages = 50
+	sender.workers = 2
+
+	if err := sender.SendBatchMessage("", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if hub.sent() != 50 {
+		t.Fatalf("hub should receive 50 events but received %d", hub.sent())
+	}
+	bodies := make(map[string]bool)
+	for _, event := range hub.events {
+		var order generatedOrder
+		if err := json.Unmarshal(event.Data, &order); err != nil || order.ID == "" {
+			t.Errorf("expected a generated order but got %s", event.Data)
+		}
+		bodies[string(event.Data)] = true
+	}
+	if len(bodies) != 50 {
+		t.Errorf("expected 50 different bodies but got %d", len(bodies))
+	}
+}
@@ -12,10 +12,10 @@ import (
 	"context"
 	"errors"
 	eventhub "github.com/Azure/azure-event-hubs-go/v3"
-	"log"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 type (
@@ -25,12 +25,32 @@ type (
 		AddPartitionIds(partitionIds []string) ISenderBuilder
 		AddProperty(filter string) ISenderBuilder
 		AddProperties(filters []string) ISenderBuilder
+		AddPropertyProvider(key string, provider PropertyProvider) ISenderBuilder
 		SetBase64(is64base bool) ISenderBuilder
 		SetNumberOfMessages(amount int64) ISenderBuilder
 		SetRandomMessageSuffix(withSuffix bool) ISenderBuilder
+		SetTemplate(isTemplate bool) ISenderBuilder
+		SetPayloadGenerator(generator PayloadGenerator) ISenderBuilder
+		SetRandomSeed(seed int64) ISenderBuilder
+		SetCompression(algorithm Compression, level int) ISenderBuilder
+		SetCompressionThreshold(minSize int) ISenderBuilder
+		SetIDStrategy(strategy IDStrategy) ISenderBuilder
+		SetCorrelationID(correlationID string) ISenderBuilder
+		SetContentType(contentType string) ISenderBuilder
+		SetEncryption(provider KeyProvider) ISenderBuilder
+		SetSigning(keyID string, secret []byte, properties []string) ISenderBuilder
+		SetChunking(chunkSize int) ISenderBuilder
+		SetClaimCheck(store BlobStore, threshold int) ISenderBuilder
+		SetOutbox(options OutboxOptions) ISenderBuilder
+		SetStreamLinger(linger time.Duration) ISenderBuilder
 		SetConnectionString(connStr string) ISenderBuilder
+		SetWorkers(workers int) ISenderBuilder
+		SetAdaptiveWorkers(minWorkers int, maxWorkers int) ISenderBuilder
+		SetRateLimit(limit RateLimit) ISenderBuilder
+		SetOnRateReport(handler func(stats RateStats)) ISenderBuilder
 		SetOnAfterSendMessage(handler func(event *eventhub.Event)) ISenderBuilder
 		SetOnBeforeSendMessage(handler func(event *eventhub.Event)) ISenderBuilder
+		AddInterceptor(interceptor Interceptor) ISenderBuilder
 		SetOnAfterSendBatchMessage(handler func(batchSizeSent int, workerIndex int)) ISenderBuilder
 		SetOnBeforeSendBatchMessage(handler func(batchSize int, workerIndex int)) ISenderBuilder
 		GetSender() (*Sender, error)
@@ -42,10 +62,33 @@ type (
 		connString               string
 		numberOfMessages         int64
 		messageSuffix            bool
+		template                 bool
+		payloadGenerator         PayloadGenerator
+		randomSeed               *int64
+		compression              Compression
+		compressionLevel         int
+		compressionThreshold     int
+		idStrategy               IDStrategy
+		correlationID            string
+		contentType              string
+		keyProvider              KeyProvider
+		signing                  *signingOptions
+		chunkSize                int
+		claimCheck               *claimCheckOptions
+		outbox                   *OutboxOptions
+		streamLinger             time.Duration
 		partitionIds             []string
 		properties               []string
+		propertyProviders        []propertyProvider
+		workers                  int
+		adaptiveWorkers          bool
+		minWorkers               int
+		maxWorkers               int
+		rateLimit                RateLimit
+		onRateReport             func(stats RateStats)
 		onAfterSendMessage       func(event *eventhub.Event)
 		onBeforeSendMessage      func(event *eventhub.Event)
+		interceptors             []Interceptor
 		onAfterSendBatchMessage  func(batchSizeSent int, workerIndex int)
 		onBeforeSendBatchMessage func(batchSize int, workerIndex int)
 	}
@@ -55,22 +98,53 @@ type (
 		AddProperties(properties map[string]string)
 		SendMessage(message string, ctx context.Context) error
 		SendBatchMessage(message string, ctx context.Context) error
-		SendEventsAsBatch(events *[]*eventhub.Event) error
+		SendEventsAsBatch(ctx context.Context, events *[]*eventhub.Event) error
+		SendMessageWithReport(message string, ctx context.Context) (*SendReport, error)
+		SendBatchMessageWithReport(message string, ctx context.Context) (*SendReport, error)
+		SendEventsAsBatchWithReport(ctx context.Context, events *[]*eventhub.Event) (*SendReport, error)
+		Plan(ctx context.Context, message string) (*SendPlan, error)
+		OutboxStats() OutboxStats
+		DrainOutbox(ctx context.Context) error
+		Close(ctx context.Context) error
 	}
 
 	// Sender struct implements ISender interface methods.
 	Sender struct {
 		//internal fields
-		eHub             *eventhub.Hub
+		eHub             hubClient
+		newHub           func(connStr string) (hubClient, error)
+		connMutex        sync.Mutex
+		closed           bool
+		handlerMutex     sync.Mutex
 		base64String     bool
 		connString       string
 		numberOfMessages int64
 		messageSuffix    bool
+		template         bool
+		payloadGenerator PayloadGenerator
+		random           *randomSource
+		compression      *compressor
+		idStrategy       IDStrategy
+		correlationID    string
+		contentType      string
+		encryption       *encryptor
+		signing          *signer
+		chunking         *chunker
+		claimCheck       *claimChecker
+		outbox           *outbox
+		streamLinger     time.Duration
 		partitionIds     []string
 		properties       []string
+		propertyProviders []propertyProvider
+		workers          int
+		adaptiveWorkers  bool
+		minWorkers       int
+		maxWorkers       int
+		rateLimit        RateLimit
+		onRateReport     func(stats RateStats)
 		//onBatchesCreated         func(ctx context.Context, event *eventhub.Event) error
 		onAfterSendMessage       func(event *eventhub.Event)
-		onBeforeSendMessage      func(event *eventhub.Event)
+		interceptors             []Interceptor
 		onAfterSendBatchMessage  func(batchSizeSent int, workerIndex int)
 		onBeforeSendBatchMessage func(batchSize int, workerIndex int)
 	}
@@ -78,7 +152,7 @@ type (
 
 // NewSenderBuilder() creates instance of Builder.
 func NewSenderBuilder() *Builder {
-	return &Builder{}
+	return &Builder{compressionThreshold: DefaultCompressionThreshold}
 }
 
 // AddProperty(filter string) add a single property to the event, the format expected is: "propertyKey:propertyValue"
@@ -99,6 +173,17 @@ func (builder *Builder) AddProperties(filters []string) ISenderBuilder {
 	return builder
 }
 
+// AddPropertyProvider(key string, provider PropertyProvider) adds a property whose value is given by the provider
+// for every event created from the message, ex: the time it is sent or a counter. The events are then packed by their
+// own size since the values can differ in size. A provider is called one event at a time.
+func (builder *Builder) AddPropertyProvider(key string, provider PropertyProvider) ISenderBuilder {
+	if len(strings.TrimSpace(key)) > 0 && provider != nil {
+		builder.propertyProviders = append(builder.propertyProviders, propertyProvider{key: key, provide: provider})
+	}
+
+	return builder
+}
+
 // AddPartitionId(partitionId string) add single partition. Format expected: "0" (a integer among 0 to 32, it will depends of your Event Hubs settings)
 func (builder *Builder) AddPartitionId(partitionId string) ISenderBuilder {
 	if len(strings.TrimSpace(partitionId)) > 0 {
@@ -147,6 +232,74 @@ func (builder *Builder) SetRandomMessageSuffix(withSuffix bool) ISenderBuilder{
 	return builder
 }
 
+// SetTemplate(isTemplate bool) set true to evaluate the placeholders of the message and of the property values for
+// every event. Available placeholders:
+// {{uuid}}, {{seq}} (index of the event in the send, starting at 0), {{now}} or {{now "2006-01-02"}} (UTC time, RFC3339
+// with nanoseconds by default), {{randInt 1 100}} (both ends included), {{pick "a" "b" "c"}} and {{randString 8}}.
+// ex: "{\"id\": \"{{uuid}}\", \"temperature\": {{randInt 10 40}}}"
+func (builder *Builder) SetTemplate(isTemplate bool) ISenderBuilder {
+	builder.template = isTemplate
+
+	return builder
+}
+
+// SetPayloadGenerator(generator PayloadGenerator) generate the body of every event instead of repeating the message
+// given to SendBatchMessage or SendMessage, which is ignored. ex: random documents valid against a JSON Schema:
+// generator, err := sender.LoadSchemaGenerator("order.schema.json", 42)
+// builder.SetPayloadGenerator(generator)
+func (builder *Builder) SetPayloadGenerator(generator PayloadGenerator) ISenderBuilder {
+	builder.payloadGenerator = generator
+
+	return builder
+}
+
+// SetCompression(algorithm Compression, level int) compress the payload of the events created from the message, the
+// ContentEncodingProperty of a compressed event tells the consumers how to decompress it. Level 0 selects the default
+// level of the algorithm. The batch limit accounts for the compressed size, so more events fit in a batch.
+// Events given to SendEventsAsBatch or read from a file are sent as they are.
+func (builder *Builder) SetCompression(algorithm Compression, level int) ISenderBuilder {
+	builder.compression = algorithm
+	builder.compressionLevel = level
+
+	return builder
+}
+
+// SetCompressionThreshold(minSize int) payloads smaller than minSize bytes are sent uncompressed, compressing them
+// saves little and costs cpu on both sides. Default value is DefaultCompressionThreshold.
+func (builder *Builder) SetCompressionThreshold(minSize int) ISenderBuilder {
+	if minSize >= 0 {
+		builder.compressionThreshold = minSize
+	}
+
+	return builder
+}
+
+// SetIDStrategy(strategy IDStrategy) set the message id of every event sent, it lets the consumers correlate and
+// dedupe the events. Available strategies: IDFromUUID(), IDFromSequence(start), IDFromTemplate(template) and
+// IDFromPayloadField(path), or any function as IDStrategyFunc. It overrides the id of the events given to
+// SendEventsAsBatch and SendStream.
+func (builder *Builder) SetIDStrategy(strategy IDStrategy) ISenderBuilder {
+	builder.idStrategy = strategy
+
+	return builder
+}
+
+// SetCorrelationID(correlationID string) set the correlation id of every event sent, in the CorrelationIDProperty
+// property.
+func (builder *Builder) SetCorrelationID(correlationID string) ISenderBuilder {
+	builder.correlationID = strings.TrimSpace(correlationID)
+
+	return builder
+}
+
+// SetContentType(contentType string) set the content type of every event sent, ex: "application/json", in the
+// ContentTypeProperty property.
+func (builder *Builder) SetContentType(contentType string) ISenderBuilder {
+	builder.contentType = strings.TrimSpace(contentType)
+
+	return builder
+}
+
 // SetConnectionString(connStr string) Required field. Connection string format is something like:
 // "Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=<AccessKey>;EntityPath=<topic>'""
 // note SharedAccessKeyName, there are two available values possible: send and listen. To this library must be SEND
@@ -158,6 +311,58 @@ func (builder *Builder) SetConnectionString(connStr string) ISenderBuilder {
 	return builder
 }
 
+// SetWorkers(workers int) set the number of go routines used to send batches in parallel. Default value is the number
+// of cpus available. It disables the adaptive mode.
+func (builder *Builder) SetWorkers(workers int) ISenderBuilder {
+	if workers > 0 {
+		builder.workers = workers
+		builder.adaptiveWorkers = false
+	}
+
+	return builder
+}
+
+// SetAdaptiveWorkers(minWorkers int, maxWorkers int) let the sender decide how many batches are sent in parallel.
+// It starts with minWorkers and raises the concurrency while the send latency stays stable, it lowers the concurrency
+// when the latency grows and halves it when event hubs throttles the sender (throughput units exhausted).
+// The concurrency never leaves the [minWorkers, maxWorkers] bounds.
+func (builder *Builder) SetAdaptiveWorkers(minWorkers int, maxWorkers int) ISenderBuilder {
+	if minWorkers <= 0 {
+		minWorkers = defaultMinWorkers
+	}
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
+
+	builder.adaptiveWorkers = true
+	builder.minWorkers = minWorkers
+	builder.maxWorkers = maxWorkers
+
+	return builder
+}
+
+// SetRateLimit(limit RateLimit) send at a controlled rate instead of as fast as possible. The target can be given in
+// events/s, bytes/s or both, constant or following a ramp, ex: 2000 events/s for 10 minutes ramping from 100 during
+// the first minute:
+// builder.SetRateLimit(sender.RateLimit{EventsPerSecond: sender.LinearRamp(100, 2000, time.Minute), MaxDuration: 10 * time.Minute})
+// It applies to SendMessage and to every batch send.
+func (builder *Builder) SetRateLimit(limit RateLimit) ISenderBuilder {
+	builder.rateLimit = limit
+
+	return builder
+}
+
+// SetOnRateReport(handler func(stats RateStats)) If you wish to compare the achieved rate with the target rate of a
+// rate limited send, you can register to this handler. It is called after each send of a batch or an event, at most
+// once per second, and once more when the send ends.
+func (builder *Builder) SetOnRateReport(handler func(stats RateStats)) ISenderBuilder {
+	if handler != nil {
+		builder.onRateReport = handler
+	}
+
+	return builder
+}
+
 // SetOnAfterSendMessage(handler func(event *eventhub.Event)) If you wish to see which event was sent to event hubs, you can
 // register to this handler.
 func (builder *Builder) SetOnAfterSendMessage(handler func(event *eventhub.Event)) ISenderBuilder {
@@ -169,7 +374,8 @@ func (builder *Builder) SetOnAfterSendMessage(handler func(event *eventhub.Event
 }
 
 // SetOnBeforeSendMessage(handler func(event *eventhub.Event)) If you wish to see which event is about to be sent to event hubs, you can
-// register to this handler.
+// register to this handler. It runs after the interceptors, on the batch sends as well, use AddInterceptor to change
+// or drop the events.
 func (builder *Builder) SetOnBeforeSendMessage(handler func(event *eventhub.Event)) ISenderBuilder {
 	if handler != nil {
 		builder.onBeforeSendMessage = handler
@@ -178,6 +384,16 @@ func (builder *Builder) SetOnBeforeSendMessage(handler func(event *eventhub.Even
 	return builder
 }
 
+// AddInterceptor(interceptor Interceptor) adds an interceptor called with every event before it is sent, it can
+// change the event, drop it or abort the send. The interceptors run in the order they are added.
+func (builder *Builder) AddInterceptor(interceptor Interceptor) ISenderBuilder {
+	if interceptor != nil {
+		builder.interceptors = append(builder.interceptors, interceptor)
+	}
+
+	return builder
+}
+
 // SetOnAfterSendBatchMessage(handler func(batchSizeSent int, workerIndex int)) If you wish to see which amount of message was sent by batch
 // you can register to this handle, it will delivery the amount of messages sent by a batch and with worker associated to that batch.
 func (builder *Builder) SetOnAfterSendBatchMessage(handler func(batchSizeSent int, workerIndex int)) ISenderBuilder {
@@ -205,96 +421,247 @@ func (builder *Builder) GetSender() (*Sender, error) {
 		return nil, errors.New("connection string is missing")
 	}
 
+	compression, err := newCompressor(builder.compression, builder.compressionLevel, builder.compressionThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	signing, err := newSigner(builder.signing)
+	if err != nil {
+		return nil, err
+	}
+
+	chunking, err := newChunker(builder.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	claimCheck, err := newClaimChecker(builder.claimCheck)
+	if err != nil {
+		return nil, err
+	}
+
 	sender := &Sender{}
 	sender.base64String = builder.base64String
 	sender.connString = builder.connString
 	sender.numberOfMessages = builder.numberOfMessages
 	sender.messageSuffix = builder.messageSuffix
+	sender.template = builder.template
+	sender.payloadGenerator = builder.payloadGenerator
+	sender.random = newRandomSource(time.Now().UnixNano())
+	if builder.randomSeed != nil {
+		sender.random = newRandomSource(*builder.randomSeed)
+		if generator, ok := builder.payloadGenerator.(seededGenerator); ok {
+			generator.Seed(*builder.randomSeed)
+		}
+	}
+	sender.compression = compression
+	sender.idStrategy = builder.idStrategy
+	if strategy, ok := builder.idStrategy.(randomIDStrategy); ok {
+		sender.idStrategy = strategy.withRandom(sender.random)
+	}
+	sender.correlationID = builder.correlationID
+	sender.contentType = builder.contentType
+	sender.encryption = newEncryptor(builder.keyProvider)
+	sender.signing = signing
+	sender.chunking = chunking
+	sender.claimCheck = claimCheck
+	sender.streamLinger = builder.streamLinger
 	sender.partitionIds = builder.partitionIds
 	sender.properties =  builder.properties
+	sender.propertyProviders = append([]propertyProvider(nil), builder.propertyProviders...)
+	sender.workers = builder.workers
+	sender.adaptiveWorkers = builder.adaptiveWorkers
+	sender.minWorkers = builder.minWorkers
+	sender.maxWorkers = builder.maxWorkers
+	sender.rateLimit = builder.rateLimit
+	sender.onRateReport = builder.onRateReport
 	sender.onAfterSendMessage = builder.onAfterSendMessage
-	sender.onBeforeSendMessage = builder.onBeforeSendMessage
+	sender.interceptors = append([]Interceptor(nil), builder.interceptors...)
+	if builder.onBeforeSendMessage != nil {
+		sender.interceptors = append(sender.interceptors, beforeSendInterceptor(builder.onBeforeSendMessage))
+	}
 	sender.onAfterSendBatchMessage = builder.onAfterSendBatchMessage
 	sender.onBeforeSendBatchMessage = builder.onBeforeSendBatchMessage
 
-	hub, err := eventhub.NewHubFromConnectionString(sender.connString)
-	if err == nil {
-		sender.eHub = hub
+	if builder.outbox != nil {
+		if sender.outbox, err = openOutbox(*builder.outbox); err != nil {
+			return nil, err
+		}
+		sender.outbox.start(sender)
 	}
 
 	return sender, nil
 }
 
+// SendEventsAsBatch(ctx context.Context, events *[]*eventhub.Event) send the given events to event hubs in batch.
+// Events are added one by one to a batch until the next one would overflow the max batch size, an event that does
+// not fit in an empty batch fails the send with an *EventTooLargeError. When ctx is cancelled, or a batch fails, the
+// workers stop at the next batch and a *PartialSendError tells how many events were sent.
 func (sender* Sender) SendEventsAsBatch(ctx context.Context, events *[]*eventhub.Event) error {
-	limit, err := calcBatchLimitWithEvents(events)
+	_, err := sender.sendEventsAsBatch(ctx, events, false)
+
+	return err
+}
 
-	if err == nil {
-		numGoRoutines := runtime.NumCPU()
+// SendEventsAsBatchWithReport(ctx context.Context, events *[]*eventhub.Event) same as SendEventsAsBatch, it also
+// returns a SendReport with the throughput and the latency of the send.
+func (sender *Sender) SendEventsAsBatchWithReport(ctx context.Context, events *[]*eventhub.Event) (*SendReport, error) {
+	return sender.sendEventsAsBatch(ctx, events, true)
+}
 
-		if sender.numberOfMessages <= 0 {
-			sender.numberOfMessages = int64(len(*events))
-		}
+func (sender *Sender) sendEventsAsBatch(ctx context.Context, events *[]*eventhub.Event, withReport bool) (*SendReport, error) {
+	session, err := sender.newSession(withReport)
+	if err != nil {
+		return nil, err
+	}
+
+	numMessages := sender.numberOfMessages
+	if numMessages <= 0 {
+		numMessages = int64(len(*events))
+	}
 
-		eventBatches := createEventBatchCollectionWithEvents(events, numGoRoutines, int64(limit), sender.numberOfMessages)
-		if len(eventBatches) > 0 {
-			var wg sync.WaitGroup
+	numGoRoutines := sender.workerCount()
+	eventBatches, err := createStampedEventBatchCollection(ctx, sender, events, numGoRoutines, numMessages)
+	if err == nil && len(eventBatches) > 0 {
+		var wg sync.WaitGroup
 
-			sender.triggerBatches(ctx, &wg, numGoRoutines, eventBatches)
-		}
+		err = session.result(ctx, sender.triggerBatches(ctx, session, &wg, numGoRoutines, eventBatches), numMessages)
 	}
 
-	return err
+	return session.close(), err
 }
 
 // SendMessage(message string, ctx context.Context) send a message to event hubs.
+// The connection is opened on the first send and reused by the following ones, call Close when you are done.
+// When ctx is cancelled, or a send fails, a *PartialSendError tells how many events were sent.
 func (sender *Sender) SendMessage(message string, ctx context.Context) error {
-	var err error = nil
+	_, err := sender.sendMessage(ctx, message, false)
+
+	return err
+}
+
+// SendMessageWithReport(message string, ctx context.Context) same as SendMessage, it also returns a SendReport with
+// the throughput and the latency of the send.
+func (sender *Sender) SendMessageWithReport(message string, ctx context.Context) (*SendReport, error) {
+	return sender.sendMessage(ctx, message, true)
+}
+
+func (sender *Sender) sendMessage(ctx context.Context, message string, withReport bool) (*SendReport, error) {
 	var i int64
-	var mutex sync.Mutex
 
-	for i = 0; i < sender.numberOfMessages; i++ {
-		event := createAnEvent(sender.base64String, message, sender.messageSuffix)
-		addProperties(event, sender.properties)
+	factory, err := sender.newEventFactory(message, false)
+	if err != nil {
+		return nil, err
+	}
 
-		if sender.onBeforeSendMessage != nil {
-			mutex.Lock()
-			sender.onBeforeSendMessage(event)
-			mutex.Unlock()
-		}
+	session, err := sender.newSession(withReport)
+	if err != nil {
+		return nil, err
+	}
 
+	for i = 0; i < sender.numberOfMessages && ctx.Err() == nil; i++ {
 		runtime.Gosched()
-		if err = sendMessage(sender.eHub, ctx, event); err != nil {
+		if err = sender.sendEvent(ctx, session, factory.next()); err == ErrMaxDurationElapsed {
+			err = nil
 			break
+		} else if err != nil {
+			break
+		}
+	}
+	err = session.result(ctx, err, sender.numberOfMessages)
+
+	return session.close(), err
+}
+
+// sendEvent prepares a single event, see prepareEvent, and sends the resulting events one by one with the after send
+// handler called once each of them is sent, not for the events kept in the outbox.
+func (sender *Sender) sendEvent(ctx context.Context, session *sendSession, event *eventhub.Event) error {
+	events, err := sender.prepareEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		queued, err := session.send(ctx, event)
+		if err != nil {
+			return err
 		}
 
-		if sender.onAfterSendMessage != nil {
-			mutex.Lock()
+		if !queued && sender.onAfterSendMessage != nil {
+			sender.handlerMutex.Lock()
 			sender.onAfterSendMessage(event)
-			mutex.Unlock()
+			sender.handlerMutex.Unlock()
 		}
 	}
 
-	return err
+	return nil
 }
 
 // SendBatchMessage(message string, ctx context.Context) send a message to event hubs in batch.
 // this function should be used together with SetNumberOfMessages and maybe SetMessageSuffix in the case you are not
-// generating your own random content.
+// generating your own random content. When ctx is cancelled, or a batch fails, the workers stop at the next batch
+// and a *PartialSendError tells how many events were sent.
 func (sender* Sender) SendBatchMessage(message string, ctx context.Context) error {
-	limit, err := calcBatchLimit(sender, message, sender.messageSuffix)
+	_, err := sender.sendBatchMessage(ctx, message, false)
 
-	if err == nil {
-		numGoRoutines := runtime.NumCPU()
-		eventBatches := createEventBatchCollection(sender, numGoRoutines, int64(limit), sender.numberOfMessages,
-			message, sender.messageSuffix)
-		if len(eventBatches) > 0 {
-			var wg sync.WaitGroup
+	return err
+}
 
-			sender.triggerBatches(ctx, &wg, numGoRoutines, eventBatches)
-		}
+// SendBatchMessageWithReport(message string, ctx context.Context) same as SendBatchMessage, it also returns a
+// SendReport with the throughput and the latency of the send.
+func (sender *Sender) SendBatchMessageWithReport(message string, ctx context.Context) (*SendReport, error) {
+	return sender.sendBatchMessage(ctx, message, true)
+}
+
+func (sender *Sender) sendBatchMessage(ctx context.Context, message string, withReport bool) (*SendReport, error) {
+	numGoRoutines := sender.workerCount()
+	eventBatches, _, err := sender.createBatches(ctx, message, numGoRoutines, false)
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	session, err := sender.newSession(withReport)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(eventBatches) > 0 {
+		var wg sync.WaitGroup
+
+		err = session.result(ctx, sender.triggerBatches(ctx, session, &wg, numGoRoutines, eventBatches),
+			sender.numberOfMessages)
+	}
+
+	return session.close(), err
+}
+
+// createBatches creates the events of a batch send and spreads the batches among the workers. limit is the number of
+// events per batch when every event has the same size, 0 when the events are packed by their own size. With dryRun
+// the events are prepared without side effects, see prepare.
+func (sender *Sender) createBatches(ctx context.Context, message string, numGoRoutines int,
+	dryRun bool) (map[int]*List, int, error) {
+	factory, err := sender.newEventFactory(message, dryRun)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !sender.fixedSizeEvents() {
+		// every event has its own size, they are packed by their real size instead of using a fixed limit
+		eventBatches, err := packEventBatchCollection(numGoRoutines, sender.numberOfMessages,
+			func(index int64) ([]*eventhub.Event, error) {
+				return sender.prepare(ctx, factory.next(), dryRun)
+			})
+		return eventBatches, 0, err
+	}
+
+	limit, err := calcBatchLimit(sender, message, sender.messageSuffix, factory.random)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return createEventBatchCollection(sender, numGoRoutines, int64(limit), sender.numberOfMessages, message,
+		sender.messageSuffix, factory.random), limit, nil
 }
 
 // AddProperties(properties map[string]interface{}) can be used to add properties using map format.
@@ -308,14 +675,3 @@ func (sender *Sender) AddProperties(properties map[string]string) {
 		}
 	}
 }
-
-func sendMessage(hub* eventhub.Hub, ctx context.Context, event* eventhub.Event) error {
-	defer func () {
-		err := hub.Close(ctx)
-		if err != nil {
-			log.Println("error on close event hub connection: ", err)
-		}
-	} ()
-
-	return hub.Send(ctx, event)
-}
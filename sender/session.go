@@ -0,0 +1,216 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PartialSendError is returned when a send stops before every event has been sent, because ctx was cancelled or a
+// send failed. Sent events were confirmed by event hubs, Err is the cause: use errors.Is(err, context.Canceled) to
+// tell a cancellation from a failure.
+type PartialSendError struct {
+	Sent  int64 // events confirmed by event hubs, a chunked event counts once all its chunks are confirmed
+	Total int64 // events the send was asked for
+	Err   error
+}
+
+func (e *PartialSendError) Error() string {
+	return fmt.Sprintf("%d of %d events sent: %v", e.Sent, e.Total, e.Err)
+}
+
+func (e *PartialSendError) Unwrap() error {
+	return e.Err
+}
+
+// sendSession holds the state shared by everything sent in a single call to one of the send methods.
+type sendSession struct {
+	hub        hubClient
+	controller *concurrencyController
+	limiter    *rateLimiter
+	recorder   *sendRecorder
+	outbox     *outbox
+	sent       int64 // events confirmed by event hubs, updated atomically
+	randomSeed int64
+	chunkMutex sync.Mutex
+	chunksLeft map[string]int // chunks not confirmed yet of the chunked events, by group id
+}
+
+// newSession connects the sender, if needed, and prepares the state of a send call. withReport enables the
+// collection of the data returned in a SendReport.
+func (sender *Sender) newSession(withReport bool) (*sendSession, error) {
+	hub, err := sender.hub()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &sendSession{
+		hub:        hub,
+		controller: sender.newConcurrencyController(),
+		limiter:    newRateLimiter(sender.rateLimit, sender.rateReportHandler()),
+		outbox:     sender.outbox,
+		randomSeed: sender.random.Seed(),
+	}
+	if withReport {
+		session.recorder = newSendRecorder()
+	}
+
+	return session, nil
+}
+
+// send sends a single event, waiting for the rate limiter when there is one. With an outbox, the event is appended
+// to the outbox when the send fails or when the outbox still holds older events, queued tells it was not sent yet.
+func (session *sendSession) send(ctx context.Context, event *eventhub.Event) (queued bool, err error) {
+	if session.outbox.queueing() {
+		return true, session.outbox.enqueue(event)
+	}
+
+	if err := session.limiter.take(ctx, 1, len(event.Data)); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	if err := session.hub.Send(ctx, event); err != nil {
+		if session.outbox.keeps(ctx, err) {
+			return true, session.outbox.enqueue(event)
+		}
+		return false, err
+	}
+	session.confirm(event)
+	session.recorder.record(0, 1, len(event.Data), time.Since(start))
+	session.limiter.record(1, len(event.Data))
+
+	return false, nil
+}
+
+// sendBatch sends a batch, waiting for a free slot when the concurrency is adaptive. With a rate limit the batch is
+// split in chunks small enough to keep the target rate smooth. With an outbox, the chunks which fail are appended to
+// the outbox, like send does, and returned as queued. sent counts the events accepted by event hubs, the chunks are
+// sent in order so on error the first sent + len(queued) events are done and the others are not sent.
+func (session *sendSession) sendBatch(ctx context.Context, workerIndex int,
+	events []*eventhub.Event) (queued []*eventhub.Event, sent int, err error) {
+	for len(events) > 0 {
+		size := session.limiter.chunk(events)
+		chunk := events[:size]
+		events = events[size:]
+
+		if session.outbox.queueing() {
+			if err := session.outbox.enqueue(chunk...); err != nil {
+				return queued, sent, err
+			}
+			queued = append(queued, chunk...)
+			continue
+		}
+
+		bytes := payloadSize(chunk)
+		if err := session.limiter.take(ctx, len(chunk), bytes); err != nil {
+			return queued, sent, err
+		}
+
+		latency, err := session.sendChunk(ctx, chunk)
+		if err != nil && session.outbox.keeps(ctx, err) {
+			if err = session.outbox.enqueue(chunk...); err != nil {
+				return queued, sent, err
+			}
+			queued = append(queued, chunk...)
+			continue
+		} else if err != nil {
+			return queued, sent, err
+		}
+		sent += len(chunk)
+		session.confirm(chunk...)
+		session.recorder.record(workerIndex, len(chunk), bytes, latency)
+		session.limiter.record(len(chunk), bytes)
+	}
+
+	return queued, sent, nil
+}
+
+// sendChunk sends the events in a single batch message and returns how long event hubs took to accept it.
+func (session *sendSession) sendChunk(ctx context.Context, events []*eventhub.Event) (time.Duration, error) {
+	if session.controller != nil {
+		session.controller.acquire()
+	}
+
+	start := time.Now()
+	err := session.hub.SendBatch(ctx, eventhub.NewEventBatchIterator(events...))
+	latency := time.Since(start)
+
+	if session.controller != nil {
+		session.controller.release(latency, err)
+	}
+
+	return latency, err
+}
+
+// confirm counts the events accepted by event hubs in the unit of the total given to result: a chunk counts when it
+// is the last chunk of its event to be confirmed.
+func (session *sendSession) confirm(events ...*eventhub.Event) {
+	var sent int64
+
+	for _, event := range events {
+		group, ok := event.Properties[ChunkGroupProperty].(string)
+		if !ok {
+			sent++
+			continue
+		}
+
+		session.chunkMutex.Lock()
+		if session.chunksLeft == nil {
+			session.chunksLeft = make(map[string]int)
+		}
+		left, ok := session.chunksLeft[group]
+		if !ok {
+			count, _ := event.Properties[ChunkCountProperty].(int64)
+			left = int(count)
+		}
+		if left--; left <= 0 {
+			delete(session.chunksLeft, group)
+			sent++
+		} else {
+			session.chunksLeft[group] = left
+		}
+		session.chunkMutex.Unlock()
+	}
+
+	atomic.AddInt64(&session.sent, sent)
+}
+
+// result returns the error of a send of total events. A send stopped by ctx, or by err, before every event was sent
+// returns a *PartialSendError.
+func (session *sendSession) result(ctx context.Context, err error, total int64) error {
+	sent := atomic.LoadInt64(&session.sent)
+	if err == nil && ctx.Err() != nil && sent < total {
+		err = ctx.Err()
+	}
+	if err == nil {
+		return nil
+	}
+
+	return &PartialSendError{Sent: sent, Total: total, Err: err}
+}
+
+// close releases the resources of the session and emits the last rate report. It returns the SendReport when the
+// session was created with report, nil otherwise.
+func (session *sendSession) close() *SendReport {
+	session.limiter.finish()
+
+	report := session.recorder.report()
+	if report != nil {
+		report.RandomSeed = session.randomSeed
+	}
+
+	return report
+}
+
+func payloadSize(events []*eventhub.Event) int {
+	var size int
+	for _, event := range events {
+		size += len(event.Data)
+	}
+
+	return size
+}
@@ -0,0 +1,173 @@
+package sender
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"sort"
+	"strings"
+)
+
+const (
+	// SignatureAlgorithm is the algorithm of the event signatures.
+	SignatureAlgorithm = "HMAC-SHA256"
+
+	// SignatureProperty holds the signature of the event, in base64.
+	SignatureProperty = "signature"
+	// SignatureKeyIDProperty holds the id of the key which signed the event.
+	SignatureKeyIDProperty = "signature-key-id"
+	// SignedPropertiesProperty holds the comma separated names of the properties covered by the signature.
+	SignedPropertiesProperty = "signed-properties"
+
+	minSigningKeySize = 16
+)
+
+type (
+	// signer signs the events with an HMAC-SHA256 over the body and a set of properties.
+	signer struct {
+		keyID      string
+		secret     []byte
+		properties []string
+		names      string
+	}
+
+	signingOptions struct {
+		keyID      string
+		secret     []byte
+		properties []string
+	}
+)
+
+// SetSigning(keyID string, secret []byte, properties []string) signs every event with an HMAC-SHA256 of the body and
+// the given properties, so the receiver can tell the events were not changed nor sent by a producer without the key.
+// The signature is computed once the event is encrypted, the secret must have at least 16 bytes. The signed properties
+// must be strings or integers, the send fails for an event with a signed property of another type.
+func (builder *Builder) SetSigning(keyID string, secret []byte, properties []string) ISenderBuilder {
+	builder.signing = &signingOptions{keyID: strings.TrimSpace(keyID), secret: secret, properties: properties}
+
+	return builder
+}
+
+// newSigner returns nil without options, a nil signer leaves the events as they are.
+func newSigner(options *signingOptions) (*signer, error) {
+	if options == nil {
+		return nil, nil
+	}
+
+	if options.keyID == "" {
+		return nil, errors.New("signing key id is missing")
+	}
+	if len(options.secret) < minSigningKeySize {
+		return nil, fmt.Errorf("signing key must have at least %d bytes", minSigningKeySize)
+	}
+
+	seen := make(map[string]bool)
+	var properties []string
+	for _, name := range options.properties {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if strings.Contains(name, ",") {
+			return nil, fmt.Errorf("signed property %q cannot contain a comma", name)
+		}
+		seen[name] = true
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+
+	secret := append([]byte(nil), options.secret...)
+
+	return &signer{keyID: options.keyID, secret: secret, properties: properties,
+		names: strings.Join(properties, ",")}, nil
+}
+
+// sign sets the signature properties of the event, it fails when a signed property is neither a string nor an integer.
+func (sign *signer) sign(event *eventhub.Event) error {
+	if sign == nil {
+		return nil
+	}
+
+	input, err := signatureInput(event, sign.keyID, sign.names, sign.properties)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, sign.secret)
+	mac.Write(input)
+
+	event.Set(SignatureKeyIDProperty, sign.keyID)
+	event.Set(SignedPropertiesProperty, sign.names)
+	event.Set(SignatureProperty, b64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+// signatureInput returns the bytes covered by the signature: the key id, the names of the signed properties, the body
+// and the signed properties, each of them prefixed with its length. A signed property is a tag followed by its value:
+// 0 when it is missing, 1 and the length prefixed utf-8 bytes for a string, 2 and 8 big endian bytes for a signed
+// integer, 3 and 8 big endian bytes for an unsigned integer. The other types cannot be signed.
+func signatureInput(event *eventhub.Event, keyID string, names string, properties []string) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	write := func(value []byte) {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(value)))
+		buffer.Write(size[:])
+		buffer.Write(value)
+	}
+	writeInteger := func(tag byte, value uint64) {
+		var integer [8]byte
+		binary.BigEndian.PutUint64(integer[:], value)
+		buffer.WriteByte(tag)
+		buffer.Write(integer[:])
+	}
+
+	write([]byte(keyID))
+	write([]byte(names))
+	write(event.Data)
+	for _, name := range properties {
+		write([]byte(name))
+
+		value, ok := event.Properties[name]
+		if !ok {
+			buffer.WriteByte(0)
+			continue
+		}
+
+		switch value := value.(type) {
+		case string:
+			buffer.WriteByte(1)
+			write([]byte(value))
+		case int:
+			writeInteger(2, uint64(value))
+		case int8:
+			writeInteger(2, uint64(value))
+		case int16:
+			writeInteger(2, uint64(value))
+		case int32:
+			writeInteger(2, uint64(value))
+		case int64:
+			writeInteger(2, uint64(value))
+		case uint:
+			writeInteger(3, uint64(value))
+		case uint8:
+			writeInteger(3, uint64(value))
+		case uint16:
+			writeInteger(3, uint64(value))
+		case uint32:
+			writeInteger(3, uint64(value))
+		case uint64:
+			writeInteger(3, value)
+		default:
+			return nil, fmt.Errorf("signed property %q is a %T, only strings and integers can be signed", name, value)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package sender
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"strings"
+	"testing"
+	"time"
+)
+
+var signingSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSender_Signing(t *testing.T) {
+	hub := &fakeHub{}
+	sender, err := NewSenderBuilder().SetConnectionString("endpoint://...").SetNumberOfMessages(3).
+		AddProperty("tenant:contoso").
+		AddPropertyProvider("sequence", SequenceProvider(1)).
+		SetSigning("s1", signingSecret, []string{"tenant", "sequence", "tenant", "missing"}).
+		GetSender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.newHub = func(connStr string) (hubClient, error) { return hub, nil }
+
+	if err := sender.SendBatchMessage("message", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range hub.events {
+		if event.Properties[SignatureKeyIDProperty] != "s1" ||
+			event.Properties[SignedPropertiesProperty] != "missing,sequence,tenant" {
+			t.Fatalf("unexpected signature properties %v", event.Properties)
+		}
+
+		properties := strings.Split(event.Properties[SignedPropertiesProperty].(string), ",")
+		sign := func() string {
+			input, err := signatureInput(event, "s1", "missing,sequence,tenant", properties)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mac := hmac.New(sha256.New, signingSecret)
+			mac.Write(input)
+			return b64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		if event.Properties[SignatureProperty] != sign() {
+			t.Error("the signature should cover the body and the properties")
+		}
+
+		event.Properties["tenant"] = "fabrikam"
+		if event.Properties[SignatureProperty] == sign() {
+			t.Error("a changed property should change the signature")
+		}
+	}
+}
+
+func TestSender_Signing_Known_Answer(t *testing.T) {
+	sign, err := newSigner(&signingOptions{keyID: "s1", secret: signingSecret,
+		properties: []string{"tenant", "sequence", "missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := eventhub.NewEventFromString("message")
+	event.Set("tenant", "contoso")
+	event.Set("sequence", int64(7))
+	if err := sign.sign(event); err != nil {
+		t.Fatal(err)
+	}
+
+	// computed apart from signatureInput, the receiver test checks the same value
+	if event.Properties[SignatureProperty] != "Lk2RYSIeOb62L2WzWFLgiVcr76Q/jzNJrRQEi9vwf+o=" {
+		t.Errorf("unexpected signature %v", event.Properties[SignatureProperty])
+	}
+
+	event.Set("sequence", time.Now())
+	if err := sign.sign(event); err == nil {
+		t.Error("expected an error for a signed property which is neither a string nor an integer")
+	}
+}
+
+func TestSender_Signing_Invalid_Settings(t *testing.T) {
+	for name, builder := range map[string]ISenderBuilder{
+		"key id":   NewSenderBuilder().SetSigning(" ", signingSecret, nil),
+		"short":    NewSenderBuilder().SetSigning("s1", []byte("short"), nil),
+		"property": NewSenderBuilder().SetSigning("s1", signingSecret, []string{"a,b"}),
+	} {
+		if _, err := builder.SetConnectionString("endpoint://...").GetSender(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
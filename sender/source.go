@@ -0,0 +1,380 @@
+package sender
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileFormat is the format of the files read by SendFile.
+type FileFormat int
+
+const (
+	// FormatJSONL one event per line, in the event envelope format: {"Data": ..., "Properties": {...}, "ID": ..., "PartitionKey": ...}
+	// binary bodies are given base64 encoded in "DataBase64" instead of "Data".
+	FormatJSONL FileFormat = iota
+	// FormatCSV a header line followed by one event per line, see CSVOptions for the column mapping.
+	FormatCSV
+	// FormatRaw each line is the body of an event, empty lines are skipped.
+	FormatRaw
+)
+
+const (
+	defaultCSVBodyColumn = "body"
+	maxLineSize          = 4 * 1024 * 1024 // events bigger than a batch are rejected by the packer anyway
+)
+
+type (
+	// CSVOptions maps the columns of a csv file to the event fields. Columns are identified by the header line.
+	CSVOptions struct {
+		BodyColumn         string   // column with the event body, default "body"
+		PropertyColumns    []string // columns sent as properties, default every column not mapped to another field
+		IDColumn           string   // optional column with the event ID
+		PartitionKeyColumn string   // optional column with the event partition key
+		Comma              rune     // field delimiter, default ','
+	}
+
+	// eventEnvelope is the json structure of an event, as documented in the README.
+	eventEnvelope struct {
+		Data             json.RawMessage `json:"Data"`
+		DataBase64       *string         `json:"DataBase64"`
+		PartitionKey     *string         `json:"PartitionKey"`
+		Properties       json.RawMessage `json:"Properties"`
+		ID               string          `json:"ID"`
+		SystemProperties *struct {
+			EnqueuedTime *time.Time `json:"EnqueuedTime"`
+		} `json:"SystemProperties"`
+	}
+
+	// recordedEvent is an event read from a file with the time it was enqueued when it was recorded.
+	recordedEvent struct {
+		event        *eventhub.Event
+		enqueuedTime *time.Time
+	}
+
+	jsonlReader struct {
+		scanner *bufio.Scanner
+		line    int64
+	}
+
+	csvReader struct {
+		reader     *csv.Reader
+		body       int
+		id         int
+		partition  int
+		properties map[string]int
+	}
+
+	rawReader struct {
+		scanner *bufio.Scanner
+	}
+)
+
+// NewJSONLEventReader(r io.Reader) returns an iterator over the events of a JSONL stream, one event envelope per line.
+// A string Data is sent as is and a json object or array is sent as its json text. A binary body is given base64
+// encoded in DataBase64 instead of Data, the encoding is never guessed so a text which happens to be valid base64 is
+// not altered. Integral numbers of the Properties are read as int64, the other numbers as float64. SystemProperties
+// are ignored, they are set by event hubs.
+func NewJSONLEventReader(r io.Reader) EventIterator {
+	return newJSONLReader(r)
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{scanner: newLineScanner(r)}
+}
+
+func (reader *jsonlReader) Next() (*eventhub.Event, error) {
+	record, err := reader.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return record.event, nil
+}
+
+func (reader *jsonlReader) next() (*recordedEvent, error) {
+	for reader.scanner.Scan() {
+		reader.line++
+		line := strings.TrimSpace(reader.scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		var envelope eventEnvelope
+		if err := json.Unmarshal([]byte(line), &envelope); err != nil {
+			return nil, fmt.Errorf("jsonl line %d: %v", reader.line, err)
+		}
+
+		data, err := envelopeData(envelope.Data, envelope.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("jsonl line %d: %v", reader.line, err)
+		}
+
+		properties, err := envelopeProperties(envelope.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("jsonl line %d: %v", reader.line, err)
+		}
+
+		event := eventhub.NewEvent(data)
+		event.ID = envelope.ID
+		event.PartitionKey = envelope.PartitionKey
+		event.Properties = properties
+
+		record := &recordedEvent{event: event}
+		if envelope.SystemProperties != nil {
+			record.enqueuedTime = envelope.SystemProperties.EnqueuedTime
+		}
+
+		return record, nil
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// envelopeData returns the body of an envelope, from DataBase64 when it is set or from Data.
+func envelopeData(raw json.RawMessage, base64 *string) ([]byte, error) {
+	if base64 != nil {
+		if len(raw) > 0 && string(raw) != "null" {
+			return nil, errors.New("Data and DataBase64 cannot be both set")
+		}
+		decoded, err := b64.StdEncoding.DecodeString(*base64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DataBase64: %v", err)
+		}
+		return decoded, nil
+	}
+
+	if len(raw) == 0 || string(raw) == "null" {
+		return []byte{}, nil
+	}
+
+	if raw[0] != '"' {
+		return []byte(raw), nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return nil, err
+	}
+
+	return []byte(text), nil
+}
+
+// envelopeProperties returns the properties of an envelope, json alone would turn every number into a float64 so the
+// integral ones are read as int64.
+func envelopeProperties(raw json.RawMessage) (map[string]interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var properties map[string]interface{}
+	if err := decoder.Decode(&properties); err != nil {
+		return nil, fmt.Errorf("invalid Properties: %v", err)
+	}
+	for key, value := range properties {
+		properties[key] = envelopeNumbers(value)
+	}
+
+	return properties, nil
+}
+
+// envelopeNumbers replaces the json numbers of the value by int64 when they are integral and float64 otherwise.
+func envelopeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return number
+		}
+		number, _ := v.Float64()
+		return number
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = envelopeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = envelopeNumbers(item)
+		}
+	}
+
+	return value
+}
+
+// NewCSVEventReader(r io.Reader, options CSVOptions) returns an iterator over the lines of a csv stream. The first
+// line must be the header, it is read immediately to validate the mapping.
+func NewCSVEventReader(r io.Reader, options CSVOptions) (EventIterator, error) {
+	reader := csv.NewReader(r)
+	if options.Comma != 0 {
+		reader.Comma = options.Comma
+	}
+	reader.FieldsPerRecord = 0
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv: header line is missing")
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if index, ok := columns[name]; ok {
+			return index, nil
+		}
+		return -1, fmt.Errorf("csv: column %q not found in the header", name)
+	}
+
+	result := &csvReader{reader: reader, properties: make(map[string]int)}
+	bodyColumn := options.BodyColumn
+	if bodyColumn == "" {
+		bodyColumn = defaultCSVBodyColumn
+	}
+	if result.body, err = column(bodyColumn); err != nil {
+		return nil, err
+	}
+	if result.id, err = column(options.IDColumn); err != nil {
+		return nil, err
+	}
+	if result.partition, err = column(options.PartitionKeyColumn); err != nil {
+		return nil, err
+	}
+
+	if len(options.PropertyColumns) > 0 {
+		for _, name := range options.PropertyColumns {
+			index, err := column(name)
+			if err != nil {
+				return nil, err
+			}
+			result.properties[name] = index
+		}
+	} else {
+		for name, index := range columns {
+			if index != result.body && index != result.id && index != result.partition {
+				result.properties[name] = index
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (reader *csvReader) Next() (*eventhub.Event, error) {
+	record, err := reader.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	field := func(index int) string {
+		if index < 0 || index >= len(record) {
+			return ""
+		}
+		return record[index]
+	}
+
+	event := eventhub.NewEvent([]byte(field(reader.body)))
+	event.ID = field(reader.id)
+	if reader.partition >= 0 {
+		partitionKey := field(reader.partition)
+		event.PartitionKey = &partitionKey
+	}
+
+	if len(reader.properties) > 0 {
+		event.Properties = make(map[string]interface{}, len(reader.properties))
+		for name, index := range reader.properties {
+			event.Properties[name] = field(index)
+		}
+	}
+
+	return event, nil
+}
+
+// NewRawEventReader(r io.Reader) returns an iterator sending each line of the stream as the body of an event.
+func NewRawEventReader(r io.Reader) EventIterator {
+	return &rawReader{scanner: newLineScanner(r)}
+}
+
+func (reader *rawReader) Next() (*eventhub.Event, error) {
+	for reader.scanner.Scan() {
+		line := strings.TrimRight(reader.scanner.Text(), "\r")
+		if len(line) > 0 {
+			return eventhub.NewEvent([]byte(line)), nil
+		}
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	return scanner
+}
+
+// SendFile(ctx context.Context, path string, format FileFormat) send every event of the file in batch, use "-" as
+// path to read from the standard input. Csv files use the default CSVOptions, for a custom mapping use
+// NewCSVEventReader with SendIterator.
+func (sender *Sender) SendFile(ctx context.Context, path string, format FileFormat) error {
+	var r io.Reader = os.Stdin
+
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	return sender.SendReader(ctx, r, format)
+}
+
+// SendReader(ctx context.Context, r io.Reader, format FileFormat) same as SendFile, reading the events from r.
+func (sender *Sender) SendReader(ctx context.Context, r io.Reader, format FileFormat) error {
+	var iterator EventIterator
+
+	switch format {
+	case FormatJSONL:
+		iterator = NewJSONLEventReader(r)
+	case FormatCSV:
+		csvIterator, err := NewCSVEventReader(r, CSVOptions{})
+		if err != nil {
+			return err
+		}
+		iterator = csvIterator
+	case FormatRaw:
+		iterator = NewRawEventReader(r)
+	default:
+		return fmt.Errorf("unknown file format %d", format)
+	}
+
+	return sender.SendIterator(ctx, iterator)
+}
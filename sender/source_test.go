@@ -0,0 +1,165 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, iterator EventIterator) []*eventhub.Event {
+	var events []*eventhub.Event
+	for {
+		event, err := iterator.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestJSONLEventReader(t *testing.T) {
+	input := `{"DataBase64": "bXkgbWVzc2FnZQ==", "PartitionKey": "pk-1", "ID": "MyId", "Properties": {"property1": "123"}, "SystemProperties": {"SequenceNumber": 1, "EnqueuedTime": "2020-02-13T12:54:57.642Z"}}
+
+{"Data": {"temperature": 21}, "PartitionKey": null, "ID": "2"}
+{"Data": "not base64!"}
+{"Data": "ping"}
+`
+	events := readAll(t, NewJSONLEventReader(strings.NewReader(input)))
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events but got %v", len(events))
+	}
+	if string(events[0].Data) != "my message" || events[0].ID != "MyId" || *events[0].PartitionKey != "pk-1" ||
+		events[0].Properties["property1"] != "123" || events[0].SystemProperties != nil {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+	if string(events[1].Data) != `{"temperature": 21}` || events[1].PartitionKey != nil {
+		t.Errorf("json data should be sent as is, got %s", events[1].Data)
+	}
+	if string(events[2].Data) != "not base64!" || string(events[3].Data) != "ping" {
+		t.Errorf("plain strings should be sent as is, got %s and %s", events[2].Data, events[3].Data)
+	}
+
+	for _, line := range []string{`{"DataBase64": "not base64!"}`, `{"Data": "ping", "DataBase64": "cGluZw=="}`} {
+		if _, err := NewJSONLEventReader(strings.NewReader(line)).Next(); err == nil {
+			t.Errorf("expected an error for %s", line)
+		}
+	}
+}
+
+func TestJSONLEventReader_Property_Numbers_Round_Trip(t *testing.T) {
+	properties := map[string]interface{}{
+		"count":  int64(42),
+		"big":    int64(9007199254740993), // not representable as a float64
+		"ratio":  0.5,
+		"name":   "sensor",
+		"ok":     true,
+		"nested": map[string]interface{}{"n": int64(-7), "values": []interface{}{int64(1), 2.5}},
+	}
+	line, err := json.Marshal(map[string]interface{}{"Data": "ping", "Properties": properties})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := readAll(t, NewJSONLEventReader(bytes.NewReader(line)))
+
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Properties, properties) {
+		t.Errorf("expected the properties %v but got %v", properties, events[0].Properties)
+	}
+	if _, err := NewJSONLEventReader(strings.NewReader(`{"Data": "a", "Properties": [1]}`)).Next(); err == nil {
+		t.Error("expected an error for properties which are not an object")
+	}
+}
+
+func TestJSONLEventReader_Invalid_Line(t *testing.T) {
+	_, err := NewJSONLEventReader(strings.NewReader("{\"Data\": \"a\"}\n{broken\n")).Next()
+	if err != nil {
+		t.Fatalf("first line is valid: %v", err)
+	}
+
+	reader := NewJSONLEventReader(strings.NewReader("{broken\n"))
+	if _, err = reader.Next(); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("error should report the line, got %v", err)
+	}
+}
+
+func TestCSVEventReader(t *testing.T) {
+	input := "id,body,device,site\n1,\"hello, world\",dev-1,north\n2,bye,dev-2,south\n"
+
+	reader, err := NewCSVEventReader(strings.NewReader(input), CSVOptions{IDColumn: "id"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := readAll(t, reader)
+
+	if len(events) != 2 || string(events[0].Data) != "hello, world" || events[0].ID != "1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if len(events[0].Properties) != 2 || events[0].Properties["device"] != "dev-1" || events[1].Properties["site"] != "south" {
+		t.Errorf("unmapped columns should be properties, got %v", events[0].Properties)
+	}
+}
+
+func TestCSVEventReader_Mapping(t *testing.T) {
+	input := "payload;device;site;key\nhello;dev-1;north;k1\n"
+
+	reader, err := NewCSVEventReader(strings.NewReader(input), CSVOptions{
+		BodyColumn: "payload", PropertyColumns: []string{"site"}, PartitionKeyColumn: "key", Comma: ';'})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := readAll(t, reader)
+
+	if len(events) != 1 || string(events[0].Data) != "hello" || *events[0].PartitionKey != "k1" ||
+		len(events[0].Properties) != 1 || events[0].Properties["site"] != "north" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+
+	if _, err = NewCSVEventReader(strings.NewReader(input), CSVOptions{}); err == nil {
+		t.Error("a missing body column should be reported")
+	}
+	if _, err = NewCSVEventReader(strings.NewReader(""), CSVOptions{}); err == nil {
+		t.Error("a missing header should be reported")
+	}
+}
+
+func TestRawEventReader(t *testing.T) {
+	events := readAll(t, NewRawEventReader(strings.NewReader("first\r\n\nsecond\nthird")))
+
+	if len(events) != 3 || string(events[0].Data) != "first" || string(events[2].Data) != "third" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestSender_SendFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.txt")
+	content := strings.Repeat(strings.Repeat("a", 10000)+"\n", 500)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	if err := sender.SendFile(context.Background(), path, FormatRaw); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hub.sent() != 500 || hub.batches < 5 {
+		t.Errorf("5MB file should be sent in at least 5 batches, sent %v events in %v batches", hub.sent(), hub.batches)
+	}
+
+	if err := sender.SendFile(context.Background(), filepath.Join(dir, "missing"), FormatRaw); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a not exist error but got %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package sender
+
+import (
+	"context"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultStreamLinger = 5 * time.Millisecond
+
+// EventIterator is a source of events consumed by SendIterator.
+type EventIterator interface {
+	// Next returns the next event to be sent, io.EOF when there are no more events.
+	Next() (*eventhub.Event, error)
+}
+
+// SetStreamLinger(linger time.Duration) sets the max time the open batch of SendStream and SendIterator waits for
+// more events before it is sent, default 5ms. A slow producer never holds its events back longer than linger.
+func (builder *Builder) SetStreamLinger(linger time.Duration) ISenderBuilder {
+	builder.streamLinger = linger
+
+	return builder
+}
+
+// SendStream(ctx context.Context, events <-chan *eventhub.Event) send the events received from the channel until it is
+// closed. Events are packed into batches and sent while the producer is still writing to the channel, a batch leaves
+// when it is full or when its first event has waited for the linger time, see SetStreamLinger.
+func (sender *Sender) SendStream(ctx context.Context, events <-chan *eventhub.Event) error {
+	return sender.sendStream(ctx, func() (*eventhub.Event, error) {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil, io.EOF
+			}
+			return event, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// SendIterator(ctx context.Context, iterator EventIterator) send the events returned by the iterator until it returns
+// io.EOF. Any other error returned by the iterator stops the send and is returned in a *PartialSendError, as the send
+// errors. A send which stops early does not wait for a Next call in progress, Next is not called again.
+func (sender *Sender) SendIterator(ctx context.Context, iterator EventIterator) error {
+	return sender.sendStream(ctx, iterator.Next)
+}
+
+// sendStream packs the events returned by next and hands the batches to the workers as soon as they are closed, when
+// full or after the linger time of their first event. next is called from a reader go routine so the linger timer
+// fires while it waits. When the send stops early, sendStream does not wait for a next call in progress: the reader
+// exits once it returns, without calling next again. A send stopped by an error or by ctx returns a
+// *PartialSendError, Total being the events read from the stream. The channel between the packer and the workers
+// holds one batch per worker, so at most 2 * workers + 1 batches and the event held by the reader are kept in memory
+// and a slow hub slows down the producer (backpressure).
+func (sender *Sender) sendStream(ctx context.Context, next func() (*eventhub.Event, error)) error {
+	session, err := sender.newSession(false)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	numGoRoutines := sender.workerCount()
+	batches := make(chan []*eventhub.Event, numGoRoutines)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var sendErr error
+	var stopped bool
+	fail := func(err error) {
+		errOnce.Do(func() {
+			sendErr = err
+			cancel()
+		})
+	}
+	stop := func() {
+		errOnce.Do(func() {
+			stopped = true
+			cancel()
+		})
+	}
+
+	wg.Add(numGoRoutines)
+	for j := 0; j < numGoRoutines; j++ {
+		go func(workerIndex int) {
+			defer wg.Done()
+
+			for events := range batches {
+				if ctx.Err() != nil {
+					continue // drain the channel so the packer never blocks
+				}
+
+				if sender.onBeforeSendBatchMessage != nil {
+					sender.handlerMutex.Lock()
+					sender.onBeforeSendBatchMessage(len(events), workerIndex)
+					sender.handlerMutex.Unlock()
+				}
+
+				queued, _, err := session.sendBatch(ctx, workerIndex, events)
+				if err == ErrMaxDurationElapsed {
+					stop()
+					continue
+				} else if err != nil {
+					fail(err)
+					continue
+				}
+
+				if sender.onAfterSendBatchMessage != nil && len(queued) < len(events) {
+					sender.handlerMutex.Lock()
+					sender.onAfterSendBatchMessage(len(events)-len(queued), workerIndex)
+					sender.handlerMutex.Unlock()
+				}
+			}
+		}(j)
+	}
+
+	publish := func(batch *packedBatch) bool {
+		if batch == nil {
+			return true
+		}
+
+		select {
+		case batches <- batch.events:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	type streamItem struct {
+		event *eventhub.Event
+		err   error
+	}
+	items := make(chan streamItem)
+	go func() {
+		for ctx.Err() == nil {
+			event, err := next()
+			select {
+			case items <- streamItem{event: event, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	lingerTime := sender.streamLinger
+	if lingerTime <= 0 {
+		lingerTime = defaultStreamLinger
+	}
+	var timer *time.Timer
+	var linger <-chan time.Time
+	stopLinger := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, linger = nil, nil
+		}
+	}
+
+	packer := newBatchPacker(eventhub.DefaultMaxMessageSizeInBytes)
+	add := func(event *eventhub.Event) bool {
+		batch, err := packer.add(event)
+		if batch != nil {
+			stopLinger()
+		}
+		if !publish(batch) {
+			return false
+		}
+		if err != nil {
+			fail(err)
+			return false
+		}
+		if timer == nil && len(packer.events) > 0 {
+			timer = time.NewTimer(lingerTime)
+			linger = timer.C
+		}
+
+		return true
+	}
+
+	var index int64
+loop:
+	for {
+		select {
+		case item := <-items:
+			if item.err == io.EOF {
+				publish(packer.flush())
+				break loop
+			}
+			if item.err != nil {
+				fail(item.err)
+				break loop
+			}
+
+			event := item.event
+			if sender.hasEventMetadata() || sender.preparesEvents() {
+				event = copyEvent(event) // the events of the caller are left as they are
+				sender.stampEvent(sender.idStrategy, index, event)
+			}
+			index++
+			events, err := sender.prepareEvent(ctx, event)
+			if err != nil {
+				fail(err)
+				break loop
+			}
+
+			for _, event := range events {
+				if !add(event) {
+					break loop
+				}
+			}
+		case <-linger:
+			timer, linger = nil, nil
+			if !publish(packer.flush()) {
+				break loop
+			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	stopLinger()
+
+	close(batches)
+	wg.Wait()
+
+	err = sendErr
+	if err == nil && !stopped && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		return nil
+	}
+
+	return &PartialSendError{Sent: atomic.LoadInt64(&session.sent), Total: index, Err: err}
+}
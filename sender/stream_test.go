@@ -0,0 +1,204 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type sliceIterator struct {
+	events []*eventhub.Event
+	err    error
+}
+
+func (iterator *sliceIterator) Next() (*eventhub.Event, error) {
+	if len(iterator.events) == 0 {
+		if iterator.err != nil {
+			return nil, iterator.err
+		}
+		return nil, io.EOF
+	}
+
+	event := iterator.events[0]
+	iterator.events = iterator.events[1:]
+
+	return event, nil
+}
+
+func TestSender_SendStream(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.workers = 3
+
+	events := make(chan *eventhub.Event)
+	go func() {
+		for i := 0; i < 5000; i++ {
+			events <- eventhub.NewEvent([]byte(strings.Repeat("a", 1000)))
+		}
+		close(events)
+	}()
+
+	if err := sender.SendStream(context.Background(), events); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hub.sent() != 5000 {
+		t.Errorf("hub should receive 5000 events but received %v", hub.sent())
+	}
+	if hub.batches < 5 {
+		t.Errorf("5MB of events should be sent in at least 5 batches, sent %v", hub.batches)
+	}
+}
+
+func TestSender_SendStream_Sends_The_Open_Batch_After_Linger(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.streamLinger = 20 * time.Millisecond
+
+	events := make(chan *eventhub.Event)
+	done := make(chan error, 1)
+	go func() { done <- sender.SendStream(context.Background(), events) }()
+
+	for i := 0; i < 3; i++ {
+		events <- eventhub.NewEvent([]byte("event"))
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.sent() != 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hub.sent() != 3 {
+		t.Errorf("the open batch should be sent after the linger time while the stream is open, sent %d", hub.sent())
+	}
+
+	close(events)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSender_SendIterator(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+
+	iterator := &sliceIterator{}
+	for i := 0; i < 100; i++ {
+		iterator.events = append(iterator.events, eventhub.NewEvent([]byte("message")))
+	}
+
+	if err := sender.SendIterator(context.Background(), iterator); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hub.sent() != 100 {
+		t.Errorf("hub should receive 100 events but received %v", hub.sent())
+	}
+}
+
+func TestSender_SendIterator_Returns_Iterator_Error(t *testing.T) {
+	sender, _ := newFakeSender(&fakeHub{})
+	expected := errors.New("broken source")
+
+	err := sender.SendIterator(context.Background(), &sliceIterator{err: expected})
+	if !errors.Is(err, expected) {
+		t.Errorf("expected the iterator error but got %v", err)
+	}
+}
+
+// blockingIterator returns a single event then blocks until release is closed, as a source reading a socket.
+type blockingIterator struct {
+	release chan struct{}
+	calls   int32
+}
+
+func (iterator *blockingIterator) Next() (*eventhub.Event, error) {
+	if atomic.AddInt32(&iterator.calls, 1) == 1 {
+		return eventhub.NewEvent([]byte("event")), nil
+	}
+
+	<-iterator.release
+	return nil, io.EOF
+}
+
+func TestSender_SendIterator_Returns_While_Next_Blocks(t *testing.T) {
+	sender, _ := newFakeSender(&fakeHub{sendErr: errors.New("amqp failure")})
+	iterator := &blockingIterator{release: make(chan struct{})}
+	defer close(iterator.release)
+
+	done := make(chan error, 1)
+	go func() { done <- sender.SendIterator(context.Background(), iterator) }()
+
+	select {
+	case err := <-done:
+		var partial *PartialSendError
+		if !errors.As(err, &partial) || partial.Sent != 0 || partial.Total != 1 || partial.Err.Error() != "amqp failure" {
+			t.Errorf("expected a partial send of 0 of 1 events but got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the send should fail without waiting for the blocked iterator")
+	}
+}
+
+func TestSender_SendStream_Returns_Send_Error(t *testing.T) {
+	sender, _ := newFakeSender(&fakeHub{sendErr: errors.New("amqp failure")})
+
+	events := make(chan *eventhub.Event, 10)
+	for i := 0; i < 10; i++ {
+		events <- eventhub.NewEvent([]byte("message"))
+	}
+	close(events)
+
+	var partial *PartialSendError
+	err := sender.SendStream(context.Background(), events)
+	if !errors.As(err, &partial) || partial.Sent != 0 || partial.Err.Error() != "amqp failure" {
+		t.Errorf("expected the send error but got %v", err)
+	}
+}
+
+func TestSender_SendStream_Applies_Backpressure(t *testing.T) {
+	hub := &fakeHub{gate: make(chan struct{})}
+	sender, _ := newFakeSender(hub)
+	sender.workers = 2
+
+	var produced int64
+	events := make(chan *eventhub.Event)
+	go func() {
+		for i := 0; i < 300; i++ {
+			events <- eventhub.NewEvent([]byte(strings.Repeat("a", 300000))) // 3 events per batch
+			atomic.AddInt64(&produced, 1)
+		}
+		close(events)
+	}()
+
+	done := make(chan error)
+	go func() {
+		done <- sender.SendStream(context.Background(), events)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	// 2 batches held by the workers + 2 in the channel + 1 being packed, 1 event held by the reader
+	if count := atomic.LoadInt64(&produced); count > 5*3+2 {
+		t.Errorf("producer should be blocked by the hub but produced %v events", count)
+	}
+
+	close(hub.gate)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hub.sent() != 300 {
+		t.Errorf("hub should receive 300 events but received %v", hub.sent())
+	}
+}
+
+func TestSender_SendStream_Cancelled(t *testing.T) {
+	sender, _ := newFakeSender(&fakeHub{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := sender.SendStream(ctx, make(chan *eventhub.Event)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package sender
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	templateOpen  = "{{"
+	templateClose = "}}"
+)
+
+type (
+	// messageTemplate is a message with placeholders evaluated for every event, ex:
+	// {"id": "{{uuid}}", "seq": {{seq}}, "at": "{{now}}", "temp": {{randInt 1 100}}, "site": "{{pick "a" "b"}}"}
+	messageTemplate struct {
+		parts  []templatePart
+		random *randomSource // source of the random placeholders, the global one when nil
+	}
+
+	// templatePart is either a literal text or a placeholder.
+	templatePart struct {
+		literal string
+		render  func(seq int64, random *randomSource) string
+	}
+)
+
+// parseTemplate compiles the text, unknown placeholders or invalid arguments are reported as errors.
+func parseTemplate(text string) (*messageTemplate, error) {
+	tmpl := &messageTemplate{}
+
+	for len(text) > 0 {
+		start := strings.Index(text, templateOpen)
+		if start < 0 {
+			tmpl.parts = append(tmpl.parts, templatePart{literal: text})
+			break
+		}
+
+		end := strings.Index(text[start:], templateClose)
+		if end < 0 {
+			return nil, fmt.Errorf("template: unclosed placeholder at position %d", start)
+		}
+		end += start
+
+		if start > 0 {
+			tmpl.parts = append(tmpl.parts, templatePart{literal: text[:start]})
+		}
+
+		render, err := parsePlaceholder(strings.TrimSpace(text[start+len(templateOpen) : end]))
+		if err != nil {
+			return nil, err
+		}
+		tmpl.parts = append(tmpl.parts, templatePart{render: render})
+
+		text = text[end+len(templateClose):]
+	}
+
+	return tmpl, nil
+}
+
+// render evaluates the placeholders for the event with the given sequence number.
+func (tmpl *messageTemplate) render(seq int64) string {
+	var sb strings.Builder
+
+	for _, part := range tmpl.parts {
+		if part.render != nil {
+			sb.WriteString(part.render(seq, tmpl.random))
+		} else {
+			sb.WriteString(part.literal)
+		}
+	}
+
+	return sb.String()
+}
+
+func parsePlaceholder(placeholder string) (func(seq int64, random *randomSource) string, error) {
+	fields, err := splitTemplateArgs(placeholder)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("template: empty placeholder")
+	}
+
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "uuid":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("template: uuid takes no arguments")
+		}
+		return func(seq int64, random *randomSource) string {
+			if random == nil {
+				return uuid.New().String()
+			}
+			return uuid.Must(uuid.NewRandomFromReader(random)).String()
+		}, nil
+	case "seq":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("template: seq takes no arguments")
+		}
+		return func(seq int64, random *randomSource) string {
+			return strconv.FormatInt(seq, 10)
+		}, nil
+	case "now":
+		layout := time.RFC3339Nano
+		if len(args) == 1 {
+			layout = args[0]
+		} else if len(args) > 1 {
+			return nil, fmt.Errorf("template: now takes an optional layout")
+		}
+		return func(seq int64, random *randomSource) string {
+			return time.Now().UTC().Format(layout)
+		}, nil
+	case "randInt":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("template: randInt takes a min and a max value")
+		}
+		low, errLow := strconv.ParseInt(args[0], 10, 64)
+		high, errHigh := strconv.ParseInt(args[1], 10, 64)
+		if errLow != nil || errHigh != nil || high < low || high-low+1 <= 0 { // the width must fit in an int64
+			return nil, fmt.Errorf("template: invalid randInt range %q %q", args[0], args[1])
+		}
+		return func(seq int64, random *randomSource) string {
+			return strconv.FormatInt(low+random.Int63n(high-low+1), 10)
+		}, nil
+	case "pick":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("template: pick takes at least one value")
+		}
+		return func(seq int64, random *randomSource) string {
+			return args[random.Intn(len(args))]
+		}, nil
+	case "randString":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("template: randString takes a length")
+		}
+		size, err := strconv.Atoi(args[0])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("template: invalid randString length %q", args[0])
+		}
+		return func(seq int64, random *randomSource) string {
+			return saltRandString(random, size)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("template: unknown placeholder %q", name)
+}
+
+// splitTemplateArgs splits a placeholder by spaces, double quoted arguments may contain spaces and \" escapes.
+func splitTemplateArgs(placeholder string) ([]string, error) {
+	var fields []string
+	var sb strings.Builder
+	var quoted, inField bool
+
+	for i := 0; i < len(placeholder); i++ {
+		c := placeholder[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(placeholder):
+			i++
+			sb.WriteByte(placeholder[i])
+		case c == '"':
+			quoted = !quoted
+			inField = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inField {
+				fields = append(fields, sb.String())
+				sb.Reset()
+				inField = false
+			}
+		default:
+			sb.WriteByte(c)
+			inField = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("template: unterminated quote in %q", placeholder)
+	}
+	if inField {
+		fields = append(fields, sb.String())
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,137 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTemplate_Render(t *testing.T) {
+	tmpl, err := parseTemplate(`{"id": "{{uuid}}", "seq": {{seq}}, "at": "{{now}}", "value": {{randInt 1 100}}, ` +
+		`"site": "{{pick "north site" "south"}}", "code": "{{randString 8}}"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var payload struct {
+		ID    string `json:"id"`
+		Seq   int64  `json:"seq"`
+		At    string `json:"at"`
+		Value int    `json:"value"`
+		Site  string `json:"site"`
+		Code  string `json:"code"`
+	}
+	if err = json.Unmarshal([]byte(tmpl.render(7)), &payload); err != nil {
+		t.Fatalf("rendered template is not valid json: %v", err)
+	}
+
+	if len(payload.ID) != 36 || payload.Seq != 7 || payload.Value < 1 || payload.Value > 100 || len(payload.Code) != 8 {
+		t.Errorf("unexpected rendered values %+v", payload)
+	}
+	if payload.Site != "north site" && payload.Site != "south" {
+		t.Errorf("pick returned an unexpected value %q", payload.Site)
+	}
+	if _, err = time.Parse(time.RFC3339Nano, payload.At); err != nil {
+		t.Errorf("now should be RFC3339: %v", err)
+	}
+}
+
+func TestParseTemplate_Now_Defaults_To_RFC3339Nano(t *testing.T) {
+	tmpl, _ := parseTemplate(`{{now}}`)
+
+	// RFC3339Nano drops the trailing zeros of the fraction, a clock tick on a whole second renders none
+	var rendered string
+	for i := 0; i < 3 && !strings.Contains(rendered, "."); i++ {
+		rendered = tmpl.render(0)
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, rendered)
+	if err != nil || at.Format(time.RFC3339Nano) != rendered || !strings.Contains(rendered, ".") ||
+		!strings.HasSuffix(rendered, "Z") {
+		t.Errorf("now should default to RFC3339Nano in UTC, got %q", rendered)
+	}
+}
+
+func TestParseTemplate_Now_Layout(t *testing.T) {
+	tmpl, _ := parseTemplate(`{{now "2006"}}`)
+
+	if tmpl.render(0) != strconv.Itoa(time.Now().UTC().Year()) {
+		t.Errorf("unexpected formatted time %q", tmpl.render(0))
+	}
+}
+
+func TestParseTemplate_Errors(t *testing.T) {
+	for _, text := range []string{"{{unknown}}", "{{uuid", "{{randInt 5 1}}", "{{randInt a b}}",
+		"{{randInt -9223372036854775808 9223372036854775807}}", "{{randInt -1 9223372036854775807}}", "{{pick}}",
+		"{{randString -1}}", `{{pick "a}}`, "{{}}"} {
+		if _, err := parseTemplate(text); err == nil {
+			t.Errorf("template %q should not be valid", text)
+		}
+	}
+}
+
+func TestParseTemplate_Without_Placeholders(t *testing.T) {
+	tmpl, err := parseTemplate("plain message")
+
+	if err != nil || tmpl.render(0) != "plain message" {
+		t.Errorf("plain text should be kept, got %q %v", tmpl.render(0), err)
+	}
+}
+
+func TestEventFactory_Template_Properties(t *testing.T) {
+	sender := &Sender{template: true, properties: []string{"seq:{{seq}};at:{{now \"15:04\"}}", "static:value"}}
+
+	factory, err := sender.newEventFactory("message-{{seq}}", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	factory.next()
+	event := factory.next()
+	if string(event.Data) != "message-1" || event.Properties["seq"] != "1" || event.Properties["static"] != "value" {
+		t.Errorf("unexpected event %s %v", event.Data, event.Properties)
+	}
+	if at := event.Properties["at"].(string); len(at) != 5 || !strings.Contains(at, ":") {
+		t.Errorf("property template with a colon should be rendered, got %q", at)
+	}
+}
+
+func TestSender_SendBatchMessage_Template_Variable_Size(t *testing.T) {
+	hub := &fakeHub{}
+	sender, _ := newFakeSender(hub)
+	sender.template = true
+	sender.numberOfMessages = 2000
+	sender.workers = 2
+
+	if err := sender.SendBatchMessage(`{"data": "{{randString 1}}{{pick "" "`+strings.Repeat("x", 2000)+`"}}"}`,
+		context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hub.sent() != 2000 {
+		t.Errorf("hub should receive 2000 events but received %v", hub.sent())
+	}
+
+	seen := make(map[string]bool)
+	for _, event := range hub.events {
+		seen[string(event.Data)[:11]] = true
+	}
+	if len(seen) < 10 {
+		t.Error("events should be rendered one by one")
+	}
+}
+
+func TestSender_SendMessage_Invalid_Template(t *testing.T) {
+	sender, connections := newFakeSender(&fakeHub{})
+	sender.template = true
+	sender.numberOfMessages = 1
+
+	if err := sender.SendMessage("{{nope}}", context.Background()); err == nil {
+		t.Error("an invalid template should fail the send")
+	}
+	if *connections != 0 {
+		t.Error("an invalid template should fail before connecting")
+	}
+}
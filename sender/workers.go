@@ -0,0 +1,128 @@
+package sender
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	latencySmoothing  = 0.2 // weight of the newest sample in the latency moving average
+	latencyTolerance  = 2.0 // a batch slower than tolerance * average latency reduces the concurrency
+	defaultMinWorkers = 1
+)
+
+// workerCount returns the number of go routines used to send batches. In adaptive mode it is the upper bound, the
+// concurrencyController decides how many of them are allowed to send at the same time.
+func (sender *Sender) workerCount() int {
+	if sender.adaptiveWorkers {
+		return sender.maxWorkers
+	}
+
+	if sender.workers > 0 {
+		return sender.workers
+	}
+
+	return runtime.NumCPU()
+}
+
+// newConcurrencyController returns the controller used by the batch workers, nil when the concurrency is fixed.
+func (sender *Sender) newConcurrencyController() *concurrencyController {
+	if !sender.adaptiveWorkers {
+		return nil
+	}
+
+	return newConcurrencyController(sender.minWorkers, sender.maxWorkers)
+}
+
+// concurrencyController limits the number of batches being sent at once. The limit grows by one after a full window
+// of fast sends and is reduced when the send latency degrades or halved when event hubs throttles the sender.
+type concurrencyController struct {
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	min       int
+	max       int
+	limit     int
+	active    int
+	successes int
+	latency   time.Duration
+}
+
+func newConcurrencyController(minWorkers int, maxWorkers int) *concurrencyController {
+	controller := &concurrencyController{min: minWorkers, max: maxWorkers, limit: minWorkers}
+	controller.cond = sync.NewCond(&controller.mutex)
+
+	return controller
+}
+
+// acquire blocks until a send slot is available.
+func (controller *concurrencyController) acquire() {
+	controller.mutex.Lock()
+	for controller.active >= controller.limit {
+		controller.cond.Wait()
+	}
+	controller.active++
+	controller.mutex.Unlock()
+}
+
+// release returns the send slot and adjusts the limit according to the outcome of the send.
+func (controller *concurrencyController) release(latency time.Duration, err error) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	controller.active--
+
+	switch {
+	case err != nil && isThrottlingError(err):
+		controller.setLimit(controller.limit / 2)
+	case err != nil:
+		// other failures say nothing about the hub capacity
+	case controller.latency > 0 && float64(latency) > latencyTolerance*float64(controller.latency):
+		controller.setLimit(controller.limit - 1)
+	default:
+		controller.successes++
+		if controller.successes >= controller.limit {
+			controller.setLimit(controller.limit + 1)
+		}
+	}
+
+	if err == nil {
+		if controller.latency == 0 {
+			controller.latency = latency
+		} else {
+			controller.latency = time.Duration(latencySmoothing*float64(latency) +
+				(1-latencySmoothing)*float64(controller.latency))
+		}
+	}
+
+	controller.cond.Broadcast()
+}
+
+func (controller *concurrencyController) setLimit(limit int) {
+	if limit < controller.min {
+		limit = controller.min
+	}
+	if limit > controller.max {
+		limit = controller.max
+	}
+
+	controller.limit = limit
+	controller.successes = 0
+}
+
+// currentLimit returns the current number of concurrent sends allowed.
+func (controller *concurrencyController) currentLimit() int {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	return controller.limit
+}
+
+// isThrottlingError reports whether event hubs refused the send because the throughput units are exhausted.
+func isThrottlingError(err error) bool {
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "serverbusy") || strings.Contains(msg, "server-busy") ||
+		strings.Contains(msg, "throttl") || strings.Contains(msg, "quota")
+}
@@ -0,0 +1,109 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSenderBuilder_SetWorkers(t *testing.T) {
+	builder := NewSenderBuilder()
+	builder.SetConnectionString("endpoint://...")
+	builder.SetWorkers(3)
+
+	sender, _ := builder.GetSender()
+	if sender.workerCount() != 3 {
+		t.Errorf("worker count should be 3 but is %v", sender.workerCount())
+	}
+}
+
+func TestSenderBuilder_Default_Workers(t *testing.T) {
+	sender, _ := NewSenderBuilder().SetConnectionString("endpoint://...").GetSender()
+
+	if sender.workerCount() != runtime.NumCPU() {
+		t.Errorf("worker count should default to the number of cpus but is %v", sender.workerCount())
+	}
+}
+
+func TestSenderBuilder_SetAdaptiveWorkers_Bounds(t *testing.T) {
+	builder := NewSenderBuilder()
+	builder.SetAdaptiveWorkers(0, -1)
+
+	if builder.minWorkers != 1 || builder.maxWorkers != 1 || !builder.adaptiveWorkers {
+		t.Errorf("invalid bounds should be normalized, got min %v max %v", builder.minWorkers, builder.maxWorkers)
+	}
+
+	builder.SetAdaptiveWorkers(2, 16)
+	sender, _ := builder.SetConnectionString("endpoint://...").GetSender()
+	if sender.workerCount() != 16 {
+		t.Errorf("adaptive mode should start max workers go routines but starts %v", sender.workerCount())
+	}
+}
+
+func TestConcurrencyController_Grows_With_Stable_Latency(t *testing.T) {
+	controller := newConcurrencyController(1, 4)
+
+	for i := 0; i < 20; i++ {
+		controller.acquire()
+		controller.release(10*time.Millisecond, nil)
+	}
+
+	if controller.currentLimit() != 4 {
+		t.Errorf("limit should grow up to the max bound but is %v", controller.currentLimit())
+	}
+}
+
+func TestConcurrencyController_Halves_On_Throttling(t *testing.T) {
+	controller := newConcurrencyController(1, 16)
+	controller.setLimit(16)
+
+	controller.acquire()
+	controller.release(time.Millisecond, errors.New("amqp: ServerBusy: the request was terminated because the entity is being throttled"))
+
+	if controller.currentLimit() != 8 {
+		t.Errorf("limit should be halved but is %v", controller.currentLimit())
+	}
+
+	for i := 0; i < 10; i++ {
+		controller.acquire()
+		controller.release(time.Millisecond, errors.New("throttled"))
+	}
+	if controller.currentLimit() != 1 {
+		t.Errorf("limit should not go under the min bound but is %v", controller.currentLimit())
+	}
+}
+
+func TestConcurrencyController_Shrinks_On_Slow_Sends(t *testing.T) {
+	controller := newConcurrencyController(1, 8)
+	controller.setLimit(4)
+
+	controller.acquire()
+	controller.release(10*time.Millisecond, nil)
+	controller.acquire()
+	controller.release(100*time.Millisecond, nil)
+
+	if controller.currentLimit() != 3 {
+		t.Errorf("limit should be reduced by one but is %v", controller.currentLimit())
+	}
+}
+
+func TestSender_SendBatchMessage_With_Workers(t *testing.T) {
+	for _, adaptive := range []bool{false, true} {
+		hub := &fakeHub{}
+		sender, _ := newFakeSender(hub)
+		sender.numberOfMessages = 1000
+		sender.workers = 2
+		sender.adaptiveWorkers = adaptive
+		sender.minWorkers = 1
+		sender.maxWorkers = 3
+
+		if err := sender.SendBatchMessage("message", context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if hub.sent() != 1000 {
+			t.Errorf("adaptive %v: hub should receive 1000 events but received %v", adaptive, hub.sent())
+		}
+	}
+}